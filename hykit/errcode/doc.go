@@ -0,0 +1,37 @@
+package errcode
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteMarkdown 输出错误码表和渠道应答码映射, esim errdoc 使用.
+func WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString("# 错误码\n\n")
+	b.WriteString("| code | msg | http status | grpc code |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, e := range All() {
+		fmt.Fprintf(&b, "| %s | %s | %d | %s |\n", e.Code, escape(e.Msg), e.HTTPStatus, e.GRPCCode.String())
+	}
+
+	for _, m := range Mappers() {
+		fmt.Fprintf(&b, "\n## %s 应答码映射\n\n", m.Channel())
+		b.WriteString("| 渠道应答码 | code | msg |\n")
+		b.WriteString("| --- | --- | --- |\n")
+		for _, channelCode := range m.ChannelCodes() {
+			e, _ := m.Lookup(channelCode)
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", channelCode, e.Code, escape(e.Msg))
+		}
+		fmt.Fprintf(&b, "| 其他 | %s | %s |\n", m.Fallback().Code, escape(m.Fallback().Msg))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
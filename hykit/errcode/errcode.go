@@ -0,0 +1,140 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Error 注册的业务错误, Code 和 Msg 返回给调用方, detail 只用于日志.
+type Error struct {
+	Code string
+
+	Msg string
+
+	HTTPStatus int
+
+	GRPCCode codes.Code
+
+	detail string
+}
+
+var (
+	mu sync.RWMutex
+
+	registry = make(map[string]*Error)
+)
+
+var (
+	Success          = Register("0000", "成功", http.StatusOK, codes.OK)
+	SystemErr        = Register("SYSTEMERR", "系统错误", http.StatusInternalServerError, codes.Internal)
+	InvalidParameter = Register("INVALID_PARAMETER", "参数错误", http.StatusBadRequest, codes.InvalidArgument)
+	FormatErr        = Register("FORMAT_ERR", "报文格式错误", http.StatusBadRequest, codes.InvalidArgument)
+	BodyTooLarge     = Register("BODY_TOO_LARGE", "报文过大", http.StatusRequestEntityTooLarge, codes.ResourceExhausted)
+	SignErr          = Register("SIGNERR", "验签失败", http.StatusUnauthorized, codes.Unauthenticated)
+	AuthErr          = Register("AUTHERR", "鉴权失败", http.StatusUnauthorized, codes.Unauthenticated)
+	RiskErr          = Register("RISKERR", "风控限制", http.StatusForbidden, codes.PermissionDenied)
+	RecordNotFound   = Register("RECORDNOTFOUND", "记录不存在", http.StatusNotFound, codes.NotFound)
+	RecordDuplicate  = Register("RECORDDUPLICATE", "记录重复", http.StatusConflict, codes.AlreadyExists)
+	TranCntLimit     = Register("TRANCNTLIMT", "交易次数超限制", http.StatusTooManyRequests, codes.ResourceExhausted)
+	AmtNotEnough     = Register("AMTNOTENG", "余额不足", http.StatusUnprocessableEntity, codes.FailedPrecondition)
+	TranErr          = Register("TRANERR", "支付失败", http.StatusUnprocessableEntity, codes.FailedPrecondition)
+	Timeout          = Register("TIMEOUT", "处理超时", http.StatusGatewayTimeout, codes.DeadlineExceeded)
+	CommErr          = Register("COMMERR", "渠道通信失败", http.StatusBadGateway, codes.Unavailable)
+	ChnlErr          = Register("CHNLERR", "渠道异常", http.StatusBadGateway, codes.Unavailable)
+)
+
+// Register 注册业务错误, code 重复时 panic, 在包初始化时调用.
+// e.g. var OrderClosed = errcode.Register("ORDERCLOSED", "订单已关闭", http.StatusConflict, codes.FailedPrecondition)
+func Register(code, msg string, httpStatus int, grpcCode codes.Code) *Error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := registry[code]; ok {
+		panic(fmt.Sprintf("errcode %s already registered", code))
+	}
+
+	e := &Error{Code: code, Msg: msg, HTTPStatus: httpStatus, GRPCCode: grpcCode}
+	registry[code] = e
+
+	return e
+}
+
+// Lookup 按 code 查找注册的错误.
+func Lookup(code string) (*Error, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	e, ok := registry[code]
+	return e, ok
+}
+
+// All 按 code 排序的全部错误.
+func All() []*Error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	all := make([]*Error, 0, len(registry))
+	for _, e := range registry {
+		all = append(all, e)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Code < all[j].Code
+	})
+
+	return all
+}
+
+func (e *Error) Error() string {
+	if e.detail != "" {
+		return fmt.Sprintf("%s: %s (%s)", e.Code, e.Msg, e.detail)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Code, e.Msg)
+}
+
+// Is code 相同即相等, 支持 errors.Is(err, errcode.Timeout).
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithMsg 替换返回给调用方的信息.
+func (e *Error) WithMsg(msg string) *Error {
+	cp := *e
+	cp.Msg = msg
+	return &cp
+}
+
+// WithDetail 附加只用于日志的信息, e.g. 原始错误、渠道应答码.
+func (e *Error) WithDetail(format string, args ...interface{}) *Error {
+	cp := *e
+	cp.detail = fmt.Sprintf(format, args...)
+	return &cp
+}
+
+func (e *Error) Detail() string {
+	return e.detail
+}
+
+// FromError 转换为注册的错误, 未注册的错误转换为 SystemErr 并保留原始信息.
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	if e = fromGRPCError(err); e != nil {
+		return e
+	}
+
+	return SystemErr.WithDetail("%s", err.Error())
+}
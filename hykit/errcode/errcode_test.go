@@ -0,0 +1,114 @@
+package errcode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	orderClosed = Register("TEST_ORDERCLOSED", "订单已关闭", http.StatusConflict, codes.FailedPrecondition)
+
+	testMapper = NewMapper("testchnl", nil).
+			Map("00", Success).
+			Map("51", AmtNotEnough)
+)
+
+func TestRegister_Duplicate(t *testing.T) {
+	assert.Panics(t, func() {
+		Register(orderClosed.Code, "dup", http.StatusOK, codes.OK)
+	})
+
+	e, ok := Lookup("TEST_ORDERCLOSED")
+	assert.True(t, ok)
+	assert.Equal(t, orderClosed, e)
+}
+
+func TestFromError(t *testing.T) {
+	assert.Nil(t, FromError(nil))
+
+	wrapped := pkgerrors.Wrap(Timeout.WithDetail("call bank"), "pay")
+	assert.True(t, errors.Is(wrapped, Timeout))
+	assert.Equal(t, Timeout.Code, FromError(wrapped).Code)
+	assert.Equal(t, "call bank", FromError(wrapped).Detail())
+
+	e := FromError(errors.New("db down"))
+	assert.True(t, errors.Is(e, SystemErr))
+	assert.Equal(t, "db down", e.Detail())
+	assert.Equal(t, SystemErr.Msg, e.Msg)
+}
+
+func TestGRPCStatus_RoundTrip(t *testing.T) {
+	err := status.Convert(orderClosed.WithMsg("订单 123 已关闭")).Err()
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	e := FromError(err)
+	assert.True(t, errors.Is(e, orderClosed))
+	assert.Equal(t, "订单 123 已关闭", e.Msg)
+
+	// 没有 ErrorInfo 时按 grpc code 映射
+	e = FromError(status.Error(codes.DeadlineExceeded, "deadline"))
+	assert.True(t, errors.Is(e, Timeout))
+
+	e = FromError(status.Error(codes.DataLoss, "lost"))
+	assert.True(t, errors.Is(e, SystemErr))
+}
+
+func TestMapper(t *testing.T) {
+	assert.True(t, testMapper.IsSuccess("00"))
+	assert.False(t, testMapper.IsSuccess("51"))
+
+	e := testMapper.Error("51", "余额不足")
+	assert.True(t, errors.Is(e, AmtNotEnough))
+	assert.Equal(t, "testchnl[51] 余额不足", e.Detail())
+
+	e = testMapper.Error("96", "系统故障")
+	assert.True(t, errors.Is(e, ChnlErr))
+}
+
+func TestJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ok", func(c *gin.Context) {
+		Ok(c, map[string]string{"id": "1"})
+	})
+	router.GET("/fail", func(c *gin.Context) {
+		Fail(c, pkgerrors.Wrap(RecordNotFound, "query order"))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp := Response{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, Success.Code, resp.Code)
+	assert.Equal(t, map[string]interface{}{"id": "1"}, resp.Data)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	resp = Response{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, RecordNotFound.Code, resp.Code)
+	assert.Equal(t, RecordNotFound.Msg, resp.Msg)
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.Nil(t, WriteMarkdown(buf))
+
+	doc := buf.String()
+	assert.Contains(t, doc, "| TEST_ORDERCLOSED | 订单已关闭 | 409 | FailedPrecondition |")
+	assert.Contains(t, doc, "## testchnl 应答码映射")
+	assert.Contains(t, doc, "| 51 | AMTNOTENG | 余额不足 |")
+	assert.Contains(t, doc, "| 其他 | CHNLERR | 渠道异常 |")
+}
@@ -0,0 +1,88 @@
+package errcode
+
+import (
+	"context"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain 放在 ErrorInfo 中, 客户端据此还原业务错误.
+const Domain = "errcode.hykit"
+
+var grpcFallback = map[codes.Code]*Error{
+	codes.InvalidArgument:   InvalidParameter,
+	codes.Unauthenticated:   AuthErr,
+	codes.PermissionDenied:  RiskErr,
+	codes.NotFound:          RecordNotFound,
+	codes.AlreadyExists:     RecordDuplicate,
+	codes.ResourceExhausted: TranCntLimit,
+	codes.DeadlineExceeded:  Timeout,
+	codes.Unavailable:       CommErr,
+}
+
+// GRPCStatus 实现 grpc status 接口, handler 直接返回 *Error 即可.
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.GRPCCode, e.Msg)
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: e.Code, Domain: Domain}); err == nil {
+		return detailed
+	}
+
+	return st
+}
+
+func fromGRPCError(err error) *Error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+
+	return FromGRPCStatus(st)
+}
+
+// FromGRPCStatus 优先使用 ErrorInfo 中的 code, 其次按 grpc code 映射.
+func FromGRPCStatus(st *status.Status) *Error {
+	if st.Code() == codes.OK {
+		return nil
+	}
+
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != Domain {
+			continue
+		}
+
+		if e, ok := Lookup(info.Reason); ok {
+			return e.WithMsg(st.Message())
+		}
+
+		// 服务端注册但本地没有注册的错误
+		fallback := grpcFallback[st.Code()]
+		if fallback == nil {
+			fallback = SystemErr
+		}
+		return &Error{Code: info.Reason, Msg: st.Message(),
+			HTTPStatus: fallback.HTTPStatus, GRPCCode: st.Code()}
+	}
+
+	if e, ok := grpcFallback[st.Code()]; ok {
+		return e.WithDetail("%s", st.Message())
+	}
+
+	return SystemErr.WithDetail("%s", st.Message())
+}
+
+// UnaryServerInterceptor 把 handler 返回的错误统一转换为注册的错误, 未注册的错误不向调用方暴露细节.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, FromError(err)
+		}
+
+		return resp, nil
+	}
+}
@@ -0,0 +1,99 @@
+package errcode
+
+import (
+	"sort"
+)
+
+var mappers []*Mapper
+
+// Mapper 第三方渠道应答码映射为注册的错误.
+// e.g.
+//
+//	var union = errcode.NewMapper("unionpay", errcode.ChnlErr).
+//		Map("00", errcode.Success).
+//		Map("64", errcode.AmtNotEnough)
+//	err := union.Error(resp.RespCode, resp.RespMsg)
+type Mapper struct {
+	channel string
+
+	codes map[string]*Error
+
+	fallback *Error
+}
+
+// NewMapper fallback 为未映射的应答码对应的错误, 为 nil 时使用 ChnlErr.
+func NewMapper(channel string, fallback *Error) *Mapper {
+	if fallback == nil {
+		fallback = ChnlErr
+	}
+
+	m := &Mapper{
+		channel:  channel,
+		codes:    make(map[string]*Error),
+		fallback: fallback,
+	}
+
+	mu.Lock()
+	mappers = append(mappers, m)
+	mu.Unlock()
+
+	return m
+}
+
+func (m *Mapper) Map(channelCode string, e *Error) *Mapper {
+	m.codes[channelCode] = e
+	return m
+}
+
+// Error 渠道应答码和信息放在 detail 中.
+func (m *Mapper) Error(channelCode, channelMsg string) *Error {
+	e, ok := m.codes[channelCode]
+	if !ok {
+		e = m.fallback
+	}
+
+	return e.WithDetail("%s[%s] %s", m.channel, channelCode, channelMsg)
+}
+
+// IsSuccess 应答码映射为 Success.
+func (m *Mapper) IsSuccess(channelCode string) bool {
+	return m.codes[channelCode] == Success
+}
+
+func (m *Mapper) Channel() string {
+	return m.channel
+}
+
+func (m *Mapper) Fallback() *Error {
+	return m.fallback
+}
+
+// ChannelCodes 排序后的渠道应答码.
+func (m *Mapper) ChannelCodes() []string {
+	channelCodes := make([]string, 0, len(m.codes))
+	for code := range m.codes {
+		channelCodes = append(channelCodes, code)
+	}
+	sort.Strings(channelCodes)
+
+	return channelCodes
+}
+
+func (m *Mapper) Lookup(channelCode string) (*Error, bool) {
+	e, ok := m.codes[channelCode]
+	return e, ok
+}
+
+// Mappers 按渠道排序的全部映射.
+func Mappers() []*Mapper {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	all := make([]*Mapper, len(mappers))
+	copy(all, mappers)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].channel < all[j].channel
+	})
+
+	return all
+}
@@ -0,0 +1,48 @@
+package errcode
+
+import (
+	tracerid "code.jshyjdtech.com/godev/hykit/pkg/tracer-id"
+	"github.com/gin-gonic/gin"
+)
+
+// Response 统一的响应结构.
+type Response struct {
+	Code string `json:"code"`
+
+	Msg string `json:"msg"`
+
+	Data interface{} `json:"data"`
+
+	TracerID string `json:"tracer_id,omitempty"`
+}
+
+// JSON err 为 nil 时返回 Success, 否则按注册的 HTTPStatus 返回.
+func JSON(c *gin.Context, data interface{}, err error) {
+	e := Success
+	if err != nil {
+		e = FromError(err)
+	}
+
+	resp := Response{
+		Code:     e.Code,
+		Msg:      e.Msg,
+		Data:     data,
+		TracerID: tracerid.ExtractTracerID(c.Request.Context()),
+	}
+
+	if err != nil {
+		_ = c.Error(e)
+		c.AbortWithStatusJSON(e.HTTPStatus, resp)
+		return
+	}
+
+	c.JSON(e.HTTPStatus, resp)
+}
+
+func Ok(c *gin.Context, data interface{}) {
+	JSON(c, data, nil)
+}
+
+func Fail(c *gin.Context, err error) {
+	JSON(c, struct{}{}, err)
+}
@@ -0,0 +1,164 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// RoundRobin gRPC 内置的轮询.
+	RoundRobin = roundrobin.Name
+
+	// LeastRequest 随机选择两个连接, 使用处理中请求数较少的一个.
+	LeastRequest = "least_request"
+
+	// ConsistentHash 按 metadata 中的 HashKey 一致性哈希, 没有 HashKey 时轮询.
+	ConsistentHash = "consistent_hash"
+
+	// HashKey 一致性哈希使用的 metadata.
+	HashKey = "x-hash-key"
+
+	// 每个连接在哈希环上的虚拟节点数
+	virtualNodes = 100
+)
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(LeastRequest, &leastRequestPickerBuilder{}, base.Config{HealthCheck: true}))
+	balancer.Register(base.NewBalancerBuilder(ConsistentHash, &consistentHashPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// ServiceConfig 返回使用 name 负载均衡的 service config, 用于 grpc.WithDefaultServiceConfig.
+func ServiceConfig(name string) string {
+	return fmt.Sprintf(`{"loadBalancingConfig": [{"%s": {}}]}`, name)
+}
+
+// WithHashKey 设置一致性哈希的 key, e.g. 按商户号路由到同一个实例.
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, HashKey, key)
+}
+
+type leastRequestPickerBuilder struct{}
+
+func (*leastRequestPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	scs := make([]*leastRequestSubConn, 0, len(info.ReadySCs))
+	for sc := range info.ReadySCs {
+		scs = append(scs, &leastRequestSubConn{sc: sc})
+	}
+
+	return &leastRequestPicker{scs: scs}
+}
+
+type leastRequestSubConn struct {
+	sc balancer.SubConn
+
+	inFlight int64
+}
+
+type leastRequestPicker struct {
+	scs []*leastRequestSubConn
+
+	mu sync.Mutex
+
+	rand *rand.Rand
+}
+
+func (p *leastRequestPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	picked := p.scs[0]
+	if len(p.scs) > 1 {
+		p.mu.Lock()
+		if p.rand == nil {
+			p.rand = rand.New(rand.NewSource(rand.Int63()))
+		}
+		a, b := p.rand.Intn(len(p.scs)), p.rand.Intn(len(p.scs)-1)
+		p.mu.Unlock()
+
+		// b 跳过 a, 保证选择两个不同的连接
+		if b >= a {
+			b++
+		}
+
+		picked = p.scs[a]
+		if atomic.LoadInt64(&p.scs[b].inFlight) < atomic.LoadInt64(&picked.inFlight) {
+			picked = p.scs[b]
+		}
+	}
+
+	atomic.AddInt64(&picked.inFlight, 1)
+
+	return balancer.PickResult{
+		SubConn: picked.sc,
+		Done: func(balancer.DoneInfo) {
+			atomic.AddInt64(&picked.inFlight, -1)
+		},
+	}, nil
+}
+
+type consistentHashPickerBuilder struct{}
+
+func (*consistentHashPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	p := &consistentHashPicker{
+		nodes: make(map[uint32]balancer.SubConn),
+	}
+
+	for sc, sci := range info.ReadySCs {
+		p.scs = append(p.scs, sc)
+		for i := 0; i < virtualNodes; i++ {
+			hash := crc32.ChecksumIEEE([]byte(sci.Address.Addr + "#" + strconv.Itoa(i)))
+			p.ring = append(p.ring, hash)
+			p.nodes[hash] = sc
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool {
+		return p.ring[i] < p.ring[j]
+	})
+
+	return p
+}
+
+type consistentHashPicker struct {
+	ring []uint32
+
+	nodes map[uint32]balancer.SubConn
+
+	scs []balancer.SubConn
+
+	next uint32
+}
+
+func (p *consistentHashPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	md, _ := metadata.FromOutgoingContext(info.Ctx)
+	keys := md.Get(HashKey)
+	if len(keys) == 0 || keys[0] == "" {
+		next := atomic.AddUint32(&p.next, 1)
+		return balancer.PickResult{SubConn: p.scs[next%uint32(len(p.scs))]}, nil
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(keys[0]))
+	idx := sort.Search(len(p.ring), func(i int) bool {
+		return p.ring[i] >= hash
+	})
+	if idx == len(p.ring) {
+		idx = 0
+	}
+
+	return balancer.PickResult{SubConn: p.nodes[p.ring[idx]]}, nil
+}
@@ -0,0 +1,94 @@
+package balancer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+type fakeSubConn struct {
+	addr string
+}
+
+func (*fakeSubConn) UpdateAddresses([]resolver.Address) {}
+
+func (*fakeSubConn) Connect() {}
+
+func buildInfo(n int) base.PickerBuildInfo {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for i := 0; i < n; i++ {
+		addr := "10.0.0." + strconv.Itoa(i) + ":50051"
+		info.ReadySCs[&fakeSubConn{addr: addr}] = base.SubConnInfo{Address: resolver.Address{Addr: addr}}
+	}
+
+	return info
+}
+
+func TestLeastRequest(t *testing.T) {
+	picker := (&leastRequestPickerBuilder{}).Build(buildInfo(2))
+
+	// 第一个请求未完成, 后续请求都选择另一个连接
+	first, err := picker.Pick(balancer.PickInfo{})
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		res, err := picker.Pick(balancer.PickInfo{})
+		assert.Nil(t, err)
+		assert.NotEqual(t, first.SubConn, res.SubConn)
+		res.Done(balancer.DoneInfo{})
+	}
+
+	first.Done(balancer.DoneInfo{})
+
+	_, err = (&leastRequestPickerBuilder{}).Build(buildInfo(0)).Pick(balancer.PickInfo{})
+	assert.Equal(t, balancer.ErrNoSubConnAvailable, err)
+}
+
+func TestConsistentHash(t *testing.T) {
+	info := buildInfo(5)
+	picker := (&consistentHashPickerBuilder{}).Build(info)
+
+	pick := func(key string) balancer.SubConn {
+		res, err := picker.Pick(balancer.PickInfo{Ctx: WithHashKey(context.Background(), key)})
+		assert.Nil(t, err)
+		return res.SubConn
+	}
+
+	picked := make(map[string]balancer.SubConn)
+	hit := make(map[balancer.SubConn]bool)
+	for i := 0; i < 100; i++ {
+		key := "merchant" + strconv.Itoa(i)
+		picked[key] = pick(key)
+		assert.Equal(t, picked[key], pick(key))
+		hit[picked[key]] = true
+	}
+	assert.Len(t, hit, 5)
+
+	// 删除一个连接, 只有原来在该连接上的 key 改变
+	var removed balancer.SubConn
+	for sc := range info.ReadySCs {
+		removed = sc
+		delete(info.ReadySCs, sc)
+		break
+	}
+	picker = (&consistentHashPickerBuilder{}).Build(info)
+	for key, sc := range picked {
+		if sc != removed {
+			assert.Equal(t, sc, pick(key))
+		}
+	}
+
+	// 没有 key 时轮询
+	hit = make(map[balancer.SubConn]bool)
+	for i := 0; i < 4; i++ {
+		res, err := picker.Pick(balancer.PickInfo{Ctx: context.Background()})
+		assert.Nil(t, err)
+		hit[res.SubConn] = true
+	}
+	assert.Len(t, hit, 4)
+}
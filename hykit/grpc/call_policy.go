@@ -0,0 +1,293 @@
+package grpc
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// CallPolicy 客户端方法的调用策略, 通过 grpc_client_call_policies 或 WithCallPolicies 配置.
+// e.g.
+//
+//	grpc_client_call_policies:
+//	- {method: '', timeout: 3000}
+//	- {method: '/pay.Pay/', timeout: 5000, maxattempts: 3, retrycodes: ['UNAVAILABLE'], backoff: 100}
+//	- {method: '/pay.Pay/Query', timeout: 1000, maxattempts: 2, hedgingdelay: 200}
+type CallPolicy struct {
+	// 完整的方法名 /pay.Pay/Query, 或服务 /pay.Pay/, 为空时作为默认策略
+	Method string `json:"method" yaml:"method"`
+
+	// 整个调用(包含重试)的超时时间, 单位 ms, 不超过上游 ctx 剩余的时间
+	Timeout int64 `json:"timeout" yaml:"timeout"`
+
+	// 最多发出的请求数, 包含首次请求
+	MaxAttempts int `json:"max_attempts" yaml:"maxattempts"`
+
+	// 重试的错误码, e.g. UNAVAILABLE, 默认 UNAVAILABLE
+	RetryCodes []string `json:"retry_codes" yaml:"retrycodes"`
+
+	// 首次重试的等待时间, 之后翻倍并加入随机抖动, 单位 ms, 默认 50
+	Backoff int64 `json:"backoff" yaml:"backoff"`
+
+	// 重试等待的最长时间, 单位 ms, 默认 1000
+	MaxBackoff int64 `json:"max_backoff" yaml:"maxbackoff"`
+
+	// 大于 0 时使用对冲请求: 超过 HedgingDelay 没有响应时再发出一个请求, 使用最先成功的响应,
+	// 只用于幂等的查询, 单位 ms
+	HedgingDelay int64 `json:"hedging_delay" yaml:"hedgingdelay"`
+
+	retryCodes map[codes.Code]struct{}
+}
+
+var codeNames = func() map[string]codes.Code {
+	names := make(map[string]codes.Code)
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		names[strings.ToUpper(c.String())] = c
+	}
+	// codes.Code.String() 为驼峰, 兼容 grpc service config 中的写法
+	names["DEADLINE_EXCEEDED"] = codes.DeadlineExceeded
+	names["NOT_FOUND"] = codes.NotFound
+	names["ALREADY_EXISTS"] = codes.AlreadyExists
+	names["PERMISSION_DENIED"] = codes.PermissionDenied
+	names["RESOURCE_EXHAUSTED"] = codes.ResourceExhausted
+	names["FAILED_PRECONDITION"] = codes.FailedPrecondition
+	names["OUT_OF_RANGE"] = codes.OutOfRange
+	names["DATA_LOSS"] = codes.DataLoss
+	return names
+}()
+
+func (cp *CallPolicy) init() {
+	if cp.MaxAttempts <= 0 {
+		cp.MaxAttempts = 1
+	}
+
+	if cp.Backoff <= 0 {
+		cp.Backoff = 50
+	}
+
+	if cp.MaxBackoff <= 0 {
+		cp.MaxBackoff = 1000
+	}
+
+	cp.retryCodes = make(map[codes.Code]struct{})
+	for _, name := range cp.RetryCodes {
+		if c, ok := codeNames[strings.ToUpper(name)]; ok {
+			cp.retryCodes[c] = struct{}{}
+		}
+	}
+	if len(cp.retryCodes) == 0 {
+		cp.retryCodes[codes.Unavailable] = struct{}{}
+	}
+}
+
+func (cp *CallPolicy) retryable(err error) bool {
+	_, ok := cp.retryCodes[status.Code(err)]
+	return ok
+}
+
+// backoff 指数退避, 在 [d/2, d] 之间随机.
+func (cp *CallPolicy) backoff(retry int) time.Duration {
+	d := cp.Backoff << uint(retry)
+	if d > cp.MaxBackoff || d <= 0 {
+		d = cp.MaxBackoff
+	}
+
+	half := time.Duration(d) * time.Millisecond / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+type callPolicies struct {
+	methods map[string]*CallPolicy
+
+	services map[string]*CallPolicy
+
+	fallback *CallPolicy
+
+	// 为上游保留的处理时间
+	deadlineReserve time.Duration
+}
+
+func newCallPolicies(policies []CallPolicy, deadlineReserve time.Duration) *callPolicies {
+	cps := &callPolicies{
+		methods:         make(map[string]*CallPolicy),
+		services:        make(map[string]*CallPolicy),
+		deadlineReserve: deadlineReserve,
+	}
+
+	for i := range policies {
+		policy := policies[i]
+		policy.init()
+
+		switch {
+		case policy.Method == "":
+			cps.fallback = &policy
+		case strings.HasSuffix(policy.Method, "/"):
+			cps.services[policy.Method] = &policy
+		default:
+			cps.methods[policy.Method] = &policy
+		}
+	}
+
+	return cps
+}
+
+func (cps *callPolicies) match(method string) *CallPolicy {
+	if policy, ok := cps.methods[method]; ok {
+		return policy
+	}
+
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		if policy, ok := cps.services[method[:i+1]]; ok {
+			return policy
+		}
+	}
+
+	return cps.fallback
+}
+
+// interceptor 位于拦截器链的最外层, 每次重试和对冲都会经过 trace、metrics 等拦截器.
+func (cps *callPolicies) interceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy := cps.match(method)
+
+		ctx, cancel, err := cps.deadline(ctx, policy)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		if policy == nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		if msg, ok := reply.(proto.Message); ok && policy.HedgingDelay > 0 && policy.MaxAttempts > 1 {
+			return policy.hedge(ctx, method, req, msg, cc, invoker, opts...)
+		}
+
+		return policy.retry(ctx, method, req, reply, cc, invoker, opts...)
+	}
+}
+
+// deadline 超时时间取策略的超时和上游剩余时间减去保留时间的较小值.
+func (cps *callPolicies) deadline(ctx context.Context,
+	policy *CallPolicy) (context.Context, context.CancelFunc, error) {
+	var timeout time.Duration
+	if policy != nil && policy.Timeout > 0 {
+		timeout = time.Duration(policy.Timeout) * time.Millisecond
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline) - cps.deadlineReserve
+		if remaining <= 0 {
+			return ctx, func() {}, status.Error(codes.DeadlineExceeded, "no time left for downstream call")
+		}
+
+		if timeout == 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	if timeout == 0 {
+		return ctx, func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+func (cp *CallPolicy) retry(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	var err error
+	for attempt := 0; attempt < cp.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			clientRetries.WithLabelValues(method, status.Code(err).String()).Inc()
+
+			timer := time.NewTimer(cp.backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil || !cp.retryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+type hedgeResult struct {
+	reply proto.Message
+
+	err error
+}
+
+// hedge 超过 HedgingDelay 没有响应或响应可重试的错误时发出新的请求, 返回最先成功的响应.
+func (cp *CallPolicy) hedge(ctx context.Context, method string, req interface{}, reply proto.Message,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, cp.MaxAttempts)
+	send := func() {
+		r := reply.ProtoReflect().New().Interface()
+		go func() {
+			err := invoker(ctx, method, req, r, cc, opts...)
+			results <- hedgeResult{reply: r, err: err}
+		}()
+	}
+
+	send()
+	sent, pending := 1, 1
+
+	delay := time.Duration(cp.HedgingDelay) * time.Millisecond
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var err error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if sent < cp.MaxAttempts {
+				clientHedges.WithLabelValues(method).Inc()
+				send()
+				sent++
+				pending++
+				timer.Reset(delay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				proto.Reset(reply)
+				proto.Merge(reply, res.reply)
+				return nil
+			}
+
+			err = res.err
+			if !cp.retryable(err) {
+				return err
+			}
+
+			// 可重试的错误立即发出下一个请求
+			if sent < cp.MaxAttempts {
+				clientRetries.WithLabelValues(method, status.Code(err).String()).Inc()
+				send()
+				sent++
+				pending++
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,179 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	pb "google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const payQuery = "/pay.Pay/Query"
+
+func TestCallPolicies_Match(t *testing.T) {
+	cps := newCallPolicies([]CallPolicy{
+		{Method: "", Timeout: 1000},
+		{Method: "/pay.Pay/", Timeout: 2000},
+		{Method: payQuery, Timeout: 3000},
+	}, 0)
+
+	assert.Equal(t, int64(3000), cps.match(payQuery).Timeout)
+	assert.Equal(t, int64(2000), cps.match("/pay.Pay/Refund").Timeout)
+	assert.Equal(t, int64(1000), cps.match("/order.Order/Get").Timeout)
+
+	assert.Nil(t, newCallPolicies(nil, 0).match(payQuery))
+}
+
+func TestCallPolicies_Retry(t *testing.T) {
+	cps := newCallPolicies([]CallPolicy{
+		{Method: payQuery, MaxAttempts: 3, RetryCodes: []string{"UNAVAILABLE", "resource_exhausted"}, Backoff: 1},
+	}, 0)
+
+	var calls int32
+	invoker := func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			return status.Error(codes.Unavailable, "unavailable")
+		case 2:
+			return status.Error(codes.ResourceExhausted, "exhausted")
+		}
+		reply.(*wrapperspb.StringValue).Value = "ok"
+		return nil
+	}
+
+	reply := &wrapperspb.StringValue{}
+	err := cps.interceptor()(context.Background(), payQuery, nil, reply, nil, invoker)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", reply.GetValue())
+	assert.Equal(t, int32(3), calls)
+
+	// 不可重试的错误码
+	calls = 0
+	err = cps.interceptor()(context.Background(), payQuery, nil, reply, nil,
+		func(ctx context.Context, method string, req, reply interface{},
+			cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			atomic.AddInt32(&calls, 1)
+			return status.Error(codes.InvalidArgument, "invalid")
+		})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestCallPolicies_Deadline(t *testing.T) {
+	cps := newCallPolicies([]CallPolicy{{Timeout: 1000}}, 100*time.Millisecond)
+
+	var remaining time.Duration
+	invoker := func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		remaining = time.Until(deadline)
+		return nil
+	}
+
+	// 没有上游的超时, 使用策略的超时
+	assert.Nil(t, cps.interceptor()(context.Background(), payQuery, nil, nil, nil, invoker))
+	assert.True(t, remaining > 900*time.Millisecond && remaining <= time.Second)
+
+	// 上游剩余 500ms, 减去保留的 100ms
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	assert.Nil(t, cps.interceptor()(ctx, payQuery, nil, nil, nil, invoker))
+	assert.True(t, remaining > 300*time.Millisecond && remaining <= 400*time.Millisecond)
+
+	// 上游剩余时间不足
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := cps.interceptor()(ctx, payQuery, nil, nil, nil, invoker)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestCallPolicies_Hedge(t *testing.T) {
+	cps := newCallPolicies([]CallPolicy{
+		{Method: payQuery, MaxAttempts: 3, HedgingDelay: 20},
+	}, 0)
+
+	var calls int32
+	invoker := func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		// 第一个请求很慢, 第二个请求先返回
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			case <-time.After(time.Second):
+			}
+			reply.(*wrapperspb.StringValue).Value = "slow"
+			return nil
+		}
+		reply.(*wrapperspb.StringValue).Value = "fast"
+		return nil
+	}
+
+	reply := &wrapperspb.StringValue{}
+	begin := time.Now()
+	err := cps.interceptor()(context.Background(), payQuery, nil, reply, nil, invoker)
+	assert.Nil(t, err)
+	assert.Equal(t, "fast", reply.GetValue())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.True(t, time.Since(begin) < 500*time.Millisecond)
+}
+
+func TestCallPolicies_HedgeRetryable(t *testing.T) {
+	cps := newCallPolicies([]CallPolicy{
+		{Method: payQuery, MaxAttempts: 2, HedgingDelay: 1000},
+	}, 0)
+
+	var calls int32
+	invoker := func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		reply.(*wrapperspb.StringValue).Value = "ok"
+		return nil
+	}
+
+	reply := &wrapperspb.StringValue{}
+	begin := time.Now()
+	err := cps.interceptor()(context.Background(), payQuery, nil, reply, nil, invoker)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", reply.GetValue())
+	// 可重试的错误不等待 HedgingDelay
+	assert.True(t, time.Since(begin) < 500*time.Millisecond)
+}
+
+func TestClient_CallPolicies(t *testing.T) {
+	onceClient = sync.Once{}
+
+	clientOpt := ClientOption{}
+	client := NewClient(
+		clientOpt.WithLogger(logger),
+		clientOpt.WithConf(newMemConfig()),
+		clientOpt.WithCallPolicies(CallPolicy{
+			Method: "/helloworld.Greeter/", Timeout: 1000, MaxAttempts: 3, Backoff: 1,
+		}))
+
+	// 没有服务监听的地址
+	conn, err := client.DialContext(context.Background(), "127.0.0.1:1")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	method := "/helloworld.Greeter/SayHello"
+	before := testutil.ToFloat64(clientRetries.WithLabelValues(method, codes.Unavailable.String()))
+
+	_, err = pb.NewGreeterClient(conn.Conn()).SayHello(context.Background(), &pb.HelloRequest{Name: esim})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	after := testutil.ToFloat64(clientRetries.WithLabelValues(method, codes.Unavailable.String()))
+	assert.Equal(t, float64(2), after-before)
+}
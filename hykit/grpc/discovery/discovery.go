@@ -0,0 +1,136 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+)
+
+// Scheme hykit 服务发现的 gRPC resolver scheme, e.g. hykit:///pay.
+const Scheme = "hykit"
+
+// ErrNoInstance 服务没有可用的实例.
+var ErrNoInstance = errors.New("no available instance")
+
+// Instance 服务实例.
+type Instance struct {
+	Service string `json:"service,omitempty"`
+
+	Addr string `json:"addr"`
+
+	Version string `json:"version,omitempty"`
+
+	Weight int `json:"weight,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Discovery 服务发现.
+type Discovery interface {
+	// Watch 首次和实例变化时推送服务的全部实例, ctx 取消后关闭 channel.
+	Watch(ctx context.Context, service string) (<-chan []Instance, error)
+}
+
+// Registry 服务注册中心, 同时提供服务发现.
+type Registry interface {
+	Discovery
+
+	// Register 注册或续期实例, 超过 ttl 没有续期的实例被移除, ttl <= 0 时不过期.
+	Register(ctx context.Context, inst Instance, ttl time.Duration) error
+
+	Deregister(ctx context.Context, inst Instance) error
+}
+
+// Target 返回 grpc.Dial 使用的地址.
+func Target(service string) string {
+	return Scheme + ":///" + service
+}
+
+type options struct {
+	logger log.Logger
+
+	interval time.Duration
+}
+
+type Option func(*options)
+
+type DiscoveryOptions struct{}
+
+func (DiscoveryOptions) WithLogger(logger log.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithInterval DNS 查询间隔, 默认 30 秒; redis 注册中心的查询间隔, 默认 3 秒.
+func (DiscoveryOptions) WithInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.interval = interval
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.logger == nil {
+		o.logger = log.NewLogger()
+	}
+
+	return o
+}
+
+// sortInstances 按地址排序, 便于比较实例是否变化.
+func sortInstances(insts []Instance) []Instance {
+	sorted := make([]Instance, len(insts))
+	copy(sorted, insts)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Addr < sorted[j].Addr
+	})
+
+	return sorted
+}
+
+func sameInstances(a, b []Instance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Addr != b[i].Addr || a[i].Weight != b[i].Weight || a[i].Version != b[i].Version ||
+			!sameMetadata(a[i].Metadata, b[i].Metadata) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameMetadata(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// send ctx 取消时放弃推送.
+func send(ctx context.Context, ch chan<- []Instance, insts []Instance) bool {
+	select {
+	case ch <- insts:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,154 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func recv(t *testing.T, ch <-chan []Instance) []Instance {
+	select {
+	case insts := <-ch:
+		return insts
+	case <-time.After(3 * time.Second):
+		t.Fatal("recv instances timeout")
+	}
+
+	return nil
+}
+
+func addrs(insts []Instance) []string {
+	res := make([]string, 0, len(insts))
+	for _, inst := range insts {
+		res = append(res, inst.Addr)
+	}
+
+	return res
+}
+
+func TestStaticDiscovery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch, err := NewStaticDiscovery("127.0.0.1:1", "127.0.0.1:2").Watch(ctx, "pay")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, addrs(recv(t, ch)))
+
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	_, err = NewStaticDiscovery().Watch(context.Background(), "pay")
+	assert.Equal(t, ErrNoInstance, err)
+}
+
+func TestMemRegistry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := NewMemRegistry()
+	assert.Nil(t, registry.Register(ctx, Instance{Service: "pay", Addr: "127.0.0.1:2"}, 0))
+
+	ch, err := registry.Watch(ctx, "pay")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"127.0.0.1:2"}, addrs(recv(t, ch)))
+
+	assert.Nil(t, registry.Register(ctx, Instance{Service: "pay", Addr: "127.0.0.1:1"}, 0))
+	assert.Nil(t, registry.Register(ctx, Instance{Service: "order", Addr: "127.0.0.1:3"}, 0))
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, addrs(recv(t, ch)))
+
+	assert.Nil(t, registry.Deregister(ctx, Instance{Service: "pay", Addr: "127.0.0.1:2"}))
+	assert.Equal(t, []string{"127.0.0.1:1"}, addrs(recv(t, ch)))
+}
+
+func TestDNSDiscovery(t *testing.T) {
+	discoveryOptions := DiscoveryOptions{}
+	dd := NewDNSDiscovery(discoveryOptions.WithInterval(10 * time.Millisecond)).(*dnsDiscovery)
+
+	records := make(chan []*net.SRV, 2)
+	records <- []*net.SRV{{Target: "pay-1.pay.", Port: 50051, Weight: 1}}
+	records <- []*net.SRV{
+		{Target: "pay-2.pay.", Port: 50051, Weight: 2},
+		{Target: "pay-1.pay.", Port: 50051, Weight: 1},
+	}
+	last := []*net.SRV{}
+	dd.lookup = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		assert.Equal(t, "_grpc._tcp.pay", name)
+		select {
+		case last = <-records:
+		default:
+			if len(last) == 0 {
+				return "", nil, errors.New("lookup failed")
+			}
+		}
+		return "", last, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := dd.Watch(ctx, "_grpc._tcp.pay")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pay-1.pay:50051"}, addrs(recv(t, ch)))
+
+	insts := recv(t, ch)
+	assert.Equal(t, []string{"pay-1.pay:50051", "pay-2.pay:50051"}, addrs(insts))
+	assert.Equal(t, 2, insts[1].Weight)
+}
+
+func TestFileDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "services.json")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"pay": [{"addr": "127.0.0.1:1"}]}`), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := NewFileDiscovery(file).Watch(ctx, "pay")
+	assert.Nil(t, err)
+	insts := recv(t, ch)
+	assert.Equal(t, []string{"127.0.0.1:1"}, addrs(insts))
+	assert.Equal(t, "pay", insts[0].Service)
+
+	// 通过 rename 替换文件
+	tmp := filepath.Join(dir, "services.json.tmp")
+	assert.Nil(t, ioutil.WriteFile(tmp,
+		[]byte(`{"pay": [{"addr": "127.0.0.1:2"}, {"addr": "127.0.0.1:1"}]}`), 0644))
+	assert.Nil(t, os.Rename(tmp, file))
+
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, addrs(recv(t, ch)))
+}
+
+func TestMemRegistry_TTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := NewMemRegistry()
+	inst := Instance{Service: "pay", Addr: "127.0.0.1:1"}
+	assert.Nil(t, registry.Register(ctx, inst, 50*time.Millisecond))
+
+	ch, err := registry.Watch(ctx, "pay")
+	assert.Nil(t, err)
+	assert.Len(t, recv(t, ch), 1)
+
+	// 续期
+	time.Sleep(30 * time.Millisecond)
+	assert.Nil(t, registry.Register(ctx, inst, 50*time.Millisecond))
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case insts := <-ch:
+		t.Fatalf("instance changed %v", insts)
+	default:
+	}
+
+	assert.Len(t, recv(t, ch), 0)
+}
@@ -0,0 +1,97 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+)
+
+type lookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+type dnsDiscovery struct {
+	*options
+
+	lookup lookupSRV
+}
+
+// NewDNSDiscovery 定时查询 DNS SRV 记录, service 为完整的记录名,
+// e.g. _grpc._tcp.pay.default.svc.cluster.local.
+func NewDNSDiscovery(opts ...Option) Discovery {
+	dd := &dnsDiscovery{
+		options: newOptions(opts...),
+		lookup:  net.DefaultResolver.LookupSRV,
+	}
+
+	if dd.interval == 0 {
+		dd.interval = 30 * time.Second
+	}
+
+	return dd
+}
+
+func (dd *dnsDiscovery) resolve(ctx context.Context, service string) ([]Instance, error) {
+	_, srvs, err := dd.lookup(ctx, "", "", service)
+	if err != nil {
+		return nil, err
+	}
+
+	insts := make([]Instance, 0, len(srvs))
+	for _, srv := range srvs {
+		host := srv.Target
+		if len(host) > 0 && host[len(host)-1] == '.' {
+			host = host[:len(host)-1]
+		}
+		insts = append(insts, Instance{
+			Service: service,
+			Addr:    net.JoinHostPort(host, strconv.Itoa(int(srv.Port))),
+			Weight:  int(srv.Weight),
+		})
+	}
+
+	return sortInstances(insts), nil
+}
+
+func (dd *dnsDiscovery) Watch(ctx context.Context, service string) (<-chan []Instance, error) {
+	insts, err := dd.resolve(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []Instance, 1)
+	ch <- insts
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(dd.interval)
+		defer ticker.Stop()
+
+		last := insts
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			insts, err := dd.resolve(ctx, service)
+			if err != nil {
+				// 查询失败时保留上次的实例
+				dd.logger.Errorc(ctx, "dns discovery %s : %s", service, err.Error())
+				continue
+			}
+
+			if sameInstances(last, insts) {
+				continue
+			}
+			last = insts
+
+			if !send(ctx, ch, insts) {
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
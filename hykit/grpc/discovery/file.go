@@ -0,0 +1,113 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type fileDiscovery struct {
+	*options
+
+	file string
+}
+
+// NewFileDiscovery 从 json 文件读取服务实例, 文件变化时重新加载,
+// 支持 k8s configmap 挂载的文件.
+// e.g.
+//
+//	{"pay": [{"addr": "10.0.0.1:50051"}, {"addr": "10.0.0.2:50051", "weight": 2}]}
+func NewFileDiscovery(file string, opts ...Option) Discovery {
+	return &fileDiscovery{
+		options: newOptions(opts...),
+		file:    file,
+	}
+}
+
+func (fd *fileDiscovery) load(service string) ([]Instance, error) {
+	data, err := ioutil.ReadFile(fd.file)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string][]Instance)
+	if err = json.Unmarshal(data, &services); err != nil {
+		return nil, err
+	}
+
+	insts := services[service]
+	for i := range insts {
+		insts[i].Service = service
+	}
+
+	return sortInstances(insts), nil
+}
+
+func (fd *fileDiscovery) Watch(ctx context.Context, service string) (<-chan []Instance, error) {
+	insts, err := fd.load(service)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// 监听目录, 文件被替换(rename、configmap 的 ..data)后仍能收到事件
+	if err = watcher.Add(filepath.Dir(fd.file)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	ch := make(chan []Instance, 1)
+	ch <- insts
+
+	go func() {
+		defer close(ch)
+		defer watcher.Close()
+
+		last := insts
+		name := filepath.Clean(fd.file)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fd.logger.Errorc(ctx, "file discovery %s : %s", fd.file, err.Error())
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(event.Name) != name && filepath.Base(event.Name) != "..data" {
+					continue
+				}
+
+				insts, err := fd.load(service)
+				if err != nil {
+					// 文件写入过程中可能解析失败, 保留上次的实例
+					fd.logger.Warnc(ctx, "file discovery load %s : %s", fd.file, err.Error())
+					continue
+				}
+
+				if sameInstances(last, insts) {
+					continue
+				}
+				last = insts
+
+				if !send(ctx, ch, insts) {
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,124 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memEntry struct {
+	inst Instance
+
+	// 每次续期更新, 过期回调据此判断是否已续期
+	expireAt time.Time
+}
+
+type memRegistry struct {
+	mu sync.Mutex
+
+	services map[string]map[string]memEntry
+
+	watchers map[string]map[chan []Instance]struct{}
+}
+
+// NewMemRegistry 进程内的注册中心, 用于测试.
+func NewMemRegistry() Registry {
+	return &memRegistry{
+		services: make(map[string]map[string]memEntry),
+		watchers: make(map[string]map[chan []Instance]struct{}),
+	}
+}
+
+func (mr *memRegistry) Register(ctx context.Context, inst Instance, ttl time.Duration) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if mr.services[inst.Service] == nil {
+		mr.services[inst.Service] = make(map[string]memEntry)
+	}
+
+	entry := memEntry{inst: inst}
+	if ttl > 0 {
+		entry.expireAt = time.Now().Add(ttl)
+		time.AfterFunc(ttl, func() {
+			mr.expire(inst.Service, inst.Addr)
+		})
+	}
+
+	_, exists := mr.services[inst.Service][inst.Addr]
+	mr.services[inst.Service][inst.Addr] = entry
+
+	// 续期不通知
+	if !exists {
+		mr.notify(inst.Service)
+	}
+
+	return nil
+}
+
+func (mr *memRegistry) expire(service, addr string) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	entry, ok := mr.services[service][addr]
+	if !ok || entry.expireAt.IsZero() || time.Now().Before(entry.expireAt) {
+		return
+	}
+
+	delete(mr.services[service], addr)
+	mr.notify(service)
+}
+
+func (mr *memRegistry) Deregister(ctx context.Context, inst Instance) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	delete(mr.services[inst.Service], inst.Addr)
+	mr.notify(inst.Service)
+
+	return nil
+}
+
+func (mr *memRegistry) Watch(ctx context.Context, service string) (<-chan []Instance, error) {
+	ch := make(chan []Instance, 1)
+
+	mr.mu.Lock()
+	if mr.watchers[service] == nil {
+		mr.watchers[service] = make(map[chan []Instance]struct{})
+	}
+	mr.watchers[service][ch] = struct{}{}
+	ch <- mr.instances(service)
+	mr.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		mr.mu.Lock()
+		delete(mr.watchers[service], ch)
+		close(ch)
+		mr.mu.Unlock()
+	}()
+
+	return ch, nil
+}
+
+func (mr *memRegistry) instances(service string) []Instance {
+	insts := make([]Instance, 0, len(mr.services[service]))
+	for _, entry := range mr.services[service] {
+		insts = append(insts, entry.inst)
+	}
+
+	return sortInstances(insts)
+}
+
+// notify 只保留最新的实例, 不阻塞注册.
+func (mr *memRegistry) notify(service string) {
+	insts := mr.instances(service)
+	for ch := range mr.watchers[service] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- insts
+	}
+}
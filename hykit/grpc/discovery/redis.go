@@ -0,0 +1,164 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/redis"
+)
+
+// RedisKeyPrefix 每个服务一个 hash, field 为实例地址.
+const RedisKeyPrefix = "hykit:registry:"
+
+// registerScript 写入实例并延长 hash 的过期时间, 服务的实例全部停止续期后 hash 被删除.
+// ttl <= 0 的实例不过期, hash 也不再过期.
+const registerScript = `
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+local ttl = tonumber(ARGV[3])
+if ttl <= 0 then
+	redis.call('PERSIST', KEYS[1])
+	return 1
+end
+local pttl = redis.call('PTTL', KEYS[1])
+if redis.call('HLEN', KEYS[1]) == 1 or (pttl ~= -1 and pttl < ttl) then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1`
+
+// expireScript 实例没有在读取之后续期时才删除, 避免删掉刚续期的实例.
+const expireScript = `
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 0`
+
+type redisEntry struct {
+	Instance
+
+	// 毫秒时间戳, 0 表示不过期
+	ExpireAt int64 `json:"expire_at,omitempty"`
+}
+
+type redisRegistry struct {
+	*options
+
+	getConn func() redis.ContextConn
+}
+
+// NewRedisRegistry 基于 redis hash 的注册中心, 实例带过期时间, Watch 定时查询.
+func NewRedisRegistry(client *redis.Client, opts ...Option) Registry {
+	rr := &redisRegistry{
+		options: newOptions(opts...),
+		getConn: client.GetCtxRedisConn,
+	}
+
+	if rr.interval == 0 {
+		rr.interval = 3 * time.Second
+	}
+
+	return rr
+}
+
+func (rr *redisRegistry) Register(ctx context.Context, inst Instance, ttl time.Duration) error {
+	entry := redisEntry{Instance: inst}
+	if ttl > 0 {
+		entry.ExpireAt = time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	conn := rr.getConn()
+	defer conn.Close()
+
+	_, err = conn.Do(ctx, "EVAL", registerScript, 1, RedisKeyPrefix+inst.Service,
+		inst.Addr, data, ttl.Milliseconds())
+	return err
+}
+
+func (rr *redisRegistry) Deregister(ctx context.Context, inst Instance) error {
+	conn := rr.getConn()
+	defer conn.Close()
+
+	_, err := conn.Do(ctx, "HDEL", RedisKeyPrefix+inst.Service, inst.Addr)
+	return err
+}
+
+func (rr *redisRegistry) instances(ctx context.Context, service string) ([]Instance, error) {
+	conn := rr.getConn()
+	defer conn.Close()
+
+	key := RedisKeyPrefix + service
+	fields, err := redis.StringMap(conn.Do(ctx, "HGETALL", key))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	insts := make([]Instance, 0, len(fields))
+	for addr, data := range fields {
+		entry := redisEntry{}
+		if err = json.Unmarshal([]byte(data), &entry); err != nil {
+			rr.logger.Warnc(ctx, "redis registry %s %s : %s", key, addr, err.Error())
+			continue
+		}
+
+		if entry.ExpireAt != 0 && entry.ExpireAt < now {
+			// 没有续期的实例, e.g. 进程被 kill
+			if _, err = conn.Do(ctx, "EVAL", expireScript, 1, key, addr, data); err != nil {
+				rr.logger.Warnc(ctx, "redis registry expire %s %s : %s", key, addr, err.Error())
+			}
+			continue
+		}
+
+		insts = append(insts, entry.Instance)
+	}
+
+	return sortInstances(insts), nil
+}
+
+func (rr *redisRegistry) Watch(ctx context.Context, service string) (<-chan []Instance, error) {
+	insts, err := rr.instances(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []Instance, 1)
+	ch <- insts
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(rr.interval)
+		defer ticker.Stop()
+
+		last := insts
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			insts, err := rr.instances(ctx, service)
+			if err != nil {
+				rr.logger.Errorc(ctx, "redis registry %s : %s", service, err.Error())
+				continue
+			}
+
+			if sameInstances(last, insts) {
+				continue
+			}
+			last = insts
+
+			if !send(ctx, ch, insts) {
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,156 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHashConn 只支持 HDEL、HGETALL 和 registerScript、expireScript.
+type fakeHashConn struct {
+	mu sync.Mutex
+
+	hashes map[string]map[string]string
+
+	// hash 的过期时间(毫秒), 不含表示不过期
+	pttls map[string]int64
+}
+
+func (fc *fakeHashConn) Close() error { return nil }
+
+func (fc *fakeHashConn) Err() error { return nil }
+
+func (fc *fakeHashConn) Do(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if commandName == "EVAL" {
+		return fc.eval(args[0].(string), args[2].(string), args[3:]...), nil
+	}
+
+	key := args[0].(string)
+	if fc.hashes[key] == nil {
+		fc.hashes[key] = make(map[string]string)
+	}
+
+	switch commandName {
+	case "HDEL":
+		delete(fc.hashes[key], args[1].(string))
+	case "HGETALL":
+		reply := make([]interface{}, 0)
+		for field, value := range fc.hashes[key] {
+			reply = append(reply, []byte(field), []byte(value))
+		}
+		return reply, nil
+	}
+
+	return int64(1), nil
+}
+
+func (fc *fakeHashConn) eval(script, key string, args ...interface{}) interface{} {
+	if fc.hashes[key] == nil {
+		fc.hashes[key] = make(map[string]string)
+	}
+	field := args[0].(string)
+
+	switch script {
+	case registerScript:
+		fc.hashes[key][field] = string(args[1].([]byte))
+		ttl := args[2].(int64)
+		pttl, ok := fc.pttls[key]
+		if ttl <= 0 {
+			delete(fc.pttls, key)
+		} else if len(fc.hashes[key]) == 1 || (ok && pttl < ttl) {
+			fc.pttls[key] = ttl
+		}
+		return int64(1)
+	case expireScript:
+		if fc.hashes[key][field] == args[1].(string) {
+			delete(fc.hashes[key], field)
+			return int64(1)
+		}
+		return int64(0)
+	}
+
+	return nil
+}
+
+func (fc *fakeHashConn) Send(ctx context.Context, commandName string, args ...interface{}) error {
+	return nil
+}
+
+func (fc *fakeHashConn) Flush(ctx context.Context) error { return nil }
+
+func (fc *fakeHashConn) Receive(ctx context.Context) (interface{}, error) { return nil, nil }
+
+func TestRedisRegistry(t *testing.T) {
+	conn := &fakeHashConn{hashes: make(map[string]map[string]string), pttls: make(map[string]int64)}
+	discoveryOptions := DiscoveryOptions{}
+	rr := &redisRegistry{
+		options: newOptions(discoveryOptions.WithInterval(10 * time.Millisecond)),
+		getConn: func() redis.ContextConn { return conn },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inst := Instance{Service: "pay", Addr: "127.0.0.1:1", Version: "1.0.0", Metadata: map[string]string{"zone": "a"}}
+	assert.Nil(t, rr.Register(ctx, inst, time.Minute))
+
+	ch, err := rr.Watch(ctx, "pay")
+	assert.Nil(t, err)
+	assert.Equal(t, []Instance{inst}, recv(t, ch))
+
+	// 没有续期的实例被移除
+	expired := Instance{Service: "pay", Addr: "127.0.0.1:2"}
+	assert.Nil(t, rr.Register(ctx, expired, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	insts, err := rr.instances(ctx, "pay")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"127.0.0.1:1"}, addrs(insts))
+	conn.mu.Lock()
+	assert.NotContains(t, conn.hashes[RedisKeyPrefix+"pay"], "127.0.0.1:2")
+	conn.mu.Unlock()
+
+	assert.Nil(t, rr.Register(ctx, Instance{Service: "pay", Addr: "127.0.0.1:3"}, 0))
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:3"}, addrs(recv(t, ch)))
+
+	assert.Nil(t, rr.Deregister(ctx, inst))
+	assert.Equal(t, []string{"127.0.0.1:3"}, addrs(recv(t, ch)))
+}
+
+func TestRedisRegistry_ExpireAndRenew(t *testing.T) {
+	conn := &fakeHashConn{hashes: make(map[string]map[string]string), pttls: make(map[string]int64)}
+	rr := &redisRegistry{
+		options: newOptions(),
+		getConn: func() redis.ContextConn { return conn },
+	}
+	ctx := context.Background()
+	key := RedisKeyPrefix + "pay"
+
+	inst := Instance{Service: "pay", Addr: "127.0.0.1:1"}
+	assert.Nil(t, rr.Register(ctx, inst, time.Millisecond))
+	assert.Equal(t, int64(1), conn.pttls[key])
+	stale := conn.hashes[key][inst.Addr]
+
+	// 读取之后实例续期, 按旧值删除不影响续期后的实例
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, rr.Register(ctx, inst, time.Minute))
+	assert.Equal(t, int64(0), conn.eval(expireScript, key, inst.Addr, stale))
+	assert.Contains(t, conn.hashes[key], inst.Addr)
+	assert.Equal(t, time.Minute.Milliseconds(), conn.pttls[key])
+
+	// 其他实例的 ttl 更短时不缩短 hash 的过期时间
+	assert.Nil(t, rr.Register(ctx, Instance{Service: "pay", Addr: "127.0.0.1:2"}, time.Second))
+	assert.Equal(t, time.Minute.Milliseconds(), conn.pttls[key])
+
+	// 不过期的实例
+	assert.Nil(t, rr.Register(ctx, Instance{Service: "pay", Addr: "127.0.0.1:3"}, 0))
+	assert.NotContains(t, conn.pttls, key)
+	assert.Nil(t, rr.Register(ctx, inst, time.Minute))
+	assert.NotContains(t, conn.pttls, key)
+}
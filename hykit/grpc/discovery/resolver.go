@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"context"
+	"strings"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+type metadataKey struct{}
+
+// instanceMetadata 实现 Equal, attributes 比较时 map 不能直接使用 ==.
+type instanceMetadata map[string]string
+
+func (im instanceMetadata) Equal(o interface{}) bool {
+	other, ok := o.(instanceMetadata)
+	return ok && sameMetadata(im, other)
+}
+
+// InstanceMetadata 返回 resolver.Address 中的实例 metadata, 供 balancer 使用.
+func InstanceMetadata(addr resolver.Address) map[string]string {
+	if addr.BalancerAttributes == nil {
+		return nil
+	}
+
+	md, _ := addr.BalancerAttributes.Value(metadataKey{}).(instanceMetadata)
+	return md
+}
+
+type resolverBuilder struct {
+	discovery Discovery
+
+	logger log.Logger
+}
+
+// NewResolverBuilder 把 Discovery 包装为 gRPC resolver, 通过 grpc.WithResolvers 使用,
+// 地址为 Target(service).
+func NewResolverBuilder(discovery Discovery, logger log.Logger) resolver.Builder {
+	if logger == nil {
+		logger = log.NewLogger()
+	}
+
+	return &resolverBuilder{discovery: discovery, logger: logger}
+}
+
+func (rb *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+func (rb *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn,
+	opts resolver.BuildOptions) (resolver.Resolver, error) {
+	service := strings.TrimPrefix(target.URL.Path, "/")
+	if service == "" {
+		service = target.URL.Opaque
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := rb.discovery.Watch(ctx, service)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	r := &discoveryResolver{cancel: cancel}
+	go r.watch(ch, cc, service, rb.logger)
+
+	return r, nil
+}
+
+type discoveryResolver struct {
+	cancel context.CancelFunc
+}
+
+func (r *discoveryResolver) watch(ch <-chan []Instance, cc resolver.ClientConn,
+	service string, logger log.Logger) {
+	for insts := range ch {
+		if len(insts) == 0 {
+			logger.Warnf("discovery %s : %s", service, ErrNoInstance.Error())
+			cc.ReportError(ErrNoInstance)
+			continue
+		}
+
+		addrs := make([]resolver.Address, 0, len(insts))
+		for _, inst := range insts {
+			addr := resolver.Address{Addr: inst.Addr}
+			if len(inst.Metadata) > 0 {
+				addr.BalancerAttributes = attributes.New(metadataKey{}, instanceMetadata(inst.Metadata))
+			}
+			addrs = append(addrs, addr)
+		}
+
+		logger.Infof("discovery %s : %d instances", service, len(addrs))
+		if err := cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+			logger.Warnf("discovery %s update state : %s", service, err.Error())
+		}
+	}
+}
+
+// ResolveNow Watch 会主动推送变化.
+func (r *discoveryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *discoveryResolver) Close() {
+	r.cancel()
+}
@@ -0,0 +1,35 @@
+package discovery
+
+import (
+	"context"
+)
+
+type staticDiscovery struct {
+	insts []Instance
+}
+
+// NewStaticDiscovery 固定的地址列表, 所有服务返回相同的实例.
+func NewStaticDiscovery(addrs ...string) Discovery {
+	sd := &staticDiscovery{}
+	for _, addr := range addrs {
+		sd.insts = append(sd.insts, Instance{Addr: addr})
+	}
+
+	return sd
+}
+
+func (sd *staticDiscovery) Watch(ctx context.Context, service string) (<-chan []Instance, error) {
+	if len(sd.insts) == 0 {
+		return nil, ErrNoInstance
+	}
+
+	ch := make(chan []Instance, 1)
+	ch <- sd.insts
+
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+
+	return ch, nil
+}
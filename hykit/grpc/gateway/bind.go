@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// bind 依次绑定请求体、路径变量和查询参数, 后者覆盖前者.
+func (gw *Gateway) bind(c *gin.Context, r *rule, body []byte, msg proto.Message) error {
+	if err := gw.bindBody(r.body, body, msg); err != nil {
+		return err
+	}
+
+	for _, pv := range r.vars {
+		if err := setField(msg.ProtoReflect(), pv.field, pv.value(c.Param)); err != nil {
+			return err
+		}
+	}
+
+	// body 为 * 时所有字段来自请求体
+	if r.body == "*" {
+		return nil
+	}
+
+	for key, values := range c.Request.URL.Query() {
+		err := setField(msg.ProtoReflect(), key, values...)
+		if err != nil && err != errUnknownField {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (gw *Gateway) bindBody(field string, body []byte, msg proto.Message) error {
+	if field == "" || len(body) == 0 {
+		return nil
+	}
+
+	if field == "*" {
+		return gw.unmarshalOptions.Unmarshal(body, msg)
+	}
+
+	m := msg.ProtoReflect()
+	fd := findField(m.Descriptor(), field)
+	if fd == nil {
+		return fmt.Errorf("body %s not found", field)
+	}
+
+	if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
+		return gw.unmarshalOptions.Unmarshal(body, m.Mutable(fd).Message().Interface())
+	}
+
+	// 标量、列表和 map 包装为 {"field": body} 后解析
+	wrapped := append([]byte(`{"`+fd.JSONName()+`":`), body...)
+	wrapped = append(wrapped, '}')
+
+	return gw.unmarshalOptions.Unmarshal(wrapped, msg)
+}
+
+var errUnknownField = fmt.Errorf("unknown field")
+
+// findField 按 proto 名称或 json 名称查找字段.
+func findField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if fd := md.Fields().ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+
+	return md.Fields().ByJSONName(name)
+}
+
+// setField 按字段路径设置值, e.g. book.author.name, 重复字段追加所有值.
+func setField(m protoreflect.Message, path string, values ...string) error {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := findField(m.Descriptor(), name)
+		if fd == nil {
+			return errUnknownField
+		}
+
+		if i < len(names)-1 {
+			if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+				return fmt.Errorf("%s is not a message", path)
+			}
+			m = m.Mutable(fd).Message()
+			continue
+		}
+
+		if fd.IsMap() {
+			return fmt.Errorf("map field %s is not supported", path)
+		}
+
+		if fd.IsList() {
+			list := m.Mutable(fd).List()
+			for _, value := range values {
+				v, err := parseValue(fd, list.NewElement, value)
+				if err != nil {
+					return fmt.Errorf("%s : %s", path, err.Error())
+				}
+				list.Append(v)
+			}
+			return nil
+		}
+
+		if len(values) == 0 {
+			return nil
+		}
+
+		v, err := parseValue(fd, func() protoreflect.Value { return m.NewField(fd) }, values[len(values)-1])
+		if err != nil {
+			return fmt.Errorf("%s : %s", path, err.Error())
+		}
+		m.Set(fd, v)
+	}
+
+	return nil
+}
+
+// parseValue 字符串转换为字段的值, 消息类型(Timestamp、wrappers 等)按 json 字符串解析.
+func parseValue(fd protoreflect.FieldDescriptor, newValue func() protoreflect.Value,
+	s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(i)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(i), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		u, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(u)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		u, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(u), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			b, err = base64.URLEncoding.DecodeString(s)
+		}
+		return protoreflect.ValueOfBytes(b), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		i, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid enum %s", s)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		v := newValue()
+		err := protojson.Unmarshal([]byte(strconv.Quote(s)), v.Message().Interface())
+		return v, err
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+}
@@ -0,0 +1,293 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"code.jshyjdtech.com/godev/hykit/errcode"
+	"code.jshyjdtech.com/godev/hykit/grpc/pool"
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// MetadataHeaderPrefix handler 通过 grpc.SetHeader/SetTrailer 设置的 metadata 以此前缀写入响应头.
+const MetadataHeaderPrefix = "Grpc-Metadata-"
+
+// Gateway 把 gRPC 服务注册到 gin, HTTP/JSON 请求与 gRPC 请求经过相同的拦截器,
+// 错误通过 errcode 转换为统一的响应.
+type Gateway struct {
+	logger log.Logger
+
+	interceptor grpc.UnaryServerInterceptor
+
+	files *protoregistry.Files
+
+	marshalOptions protojson.MarshalOptions
+
+	unmarshalOptions protojson.UnmarshalOptions
+
+	// 请求体的上限, 与 gRPC 服务端的 MaxRecvMsgSize 一致
+	maxRecvMsgSize int
+
+	methodMaxRecvMsgSizes map[string]int
+}
+
+type Option func(*Gateway)
+
+type GatewayOptions struct{}
+
+func NewGateway(options ...Option) *Gateway {
+	gw := &Gateway{
+		marshalOptions:        protojson.MarshalOptions{EmitUnpopulated: true},
+		unmarshalOptions:      protojson.UnmarshalOptions{DiscardUnknown: true},
+		methodMaxRecvMsgSizes: make(map[string]int),
+	}
+
+	for _, option := range options {
+		option(gw)
+	}
+
+	if gw.logger == nil {
+		gw.logger = log.NewLogger()
+	}
+
+	if gw.files == nil {
+		gw.files = protoregistry.GlobalFiles
+	}
+
+	if gw.maxRecvMsgSize == 0 {
+		gw.maxRecvMsgSize = pool.MaxRecvMsgSize
+	}
+
+	return gw
+}
+
+func (GatewayOptions) WithLogger(logger log.Logger) Option {
+	return func(gw *Gateway) {
+		gw.logger = logger
+	}
+}
+
+// WithUnaryInterceptor 一般使用 grpc.Server.UnaryInterceptor(), 与 gRPC 请求使用相同的拦截器.
+func (GatewayOptions) WithUnaryInterceptor(interceptor grpc.UnaryServerInterceptor) Option {
+	return func(gw *Gateway) {
+		gw.interceptor = interceptor
+	}
+}
+
+// WithFiles 查找服务描述的 registry, 默认 protoregistry.GlobalFiles.
+func (GatewayOptions) WithFiles(files *protoregistry.Files) Option {
+	return func(gw *Gateway) {
+		gw.files = files
+	}
+}
+
+func (GatewayOptions) WithMarshalOptions(options protojson.MarshalOptions) Option {
+	return func(gw *Gateway) {
+		gw.marshalOptions = options
+	}
+}
+
+func (GatewayOptions) WithUnmarshalOptions(options protojson.UnmarshalOptions) Option {
+	return func(gw *Gateway) {
+		gw.unmarshalOptions = options
+	}
+}
+
+// WithMaxRecvMsgSize 请求体的上限 单位：byte, 默认与 gRPC 服务端相同的 pool.MaxRecvMsgSize.
+func (GatewayOptions) WithMaxRecvMsgSize(size int) Option {
+	return func(gw *Gateway) {
+		gw.maxRecvMsgSize = size
+	}
+}
+
+// WithMethodMaxRecvMsgSize 方法的请求体上限, e.g. "/pay.Pay/Upload".
+func (GatewayOptions) WithMethodMaxRecvMsgSize(method string, size int) Option {
+	return func(gw *Gateway) {
+		gw.methodMaxRecvMsgSizes[method] = size
+	}
+}
+
+// Register 按 google.api.http 注解注册路由, 没有注解的方法注册为 POST /package.Service/Method.
+// e.g.
+//
+//	gw := gateway.NewGateway(gatewayOpt.WithUnaryInterceptor(grpcServer.UnaryInterceptor()))
+//	err := gw.Register(en, &pb.Greeter_ServiceDesc, greeterServer)
+func (gw *Gateway) Register(router gin.IRouter, desc *grpc.ServiceDesc, srv interface{}) (err error) {
+	d, err := gw.files.FindDescriptorByName(protoreflect.FullName(desc.ServiceName))
+	if err != nil {
+		return fmt.Errorf("gateway %s : %s", desc.ServiceName, err.Error())
+	}
+
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return fmt.Errorf("gateway %s is not a service", desc.ServiceName)
+	}
+
+	// gin 路由冲突时 panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("gateway %s : %v", desc.ServiceName, r)
+		}
+	}()
+
+	for i := range desc.Methods {
+		method := &desc.Methods[i]
+		md := sd.Methods().ByName(protoreflect.Name(method.MethodName))
+		if md == nil {
+			return fmt.Errorf("gateway %s/%s not found in descriptor", desc.ServiceName, method.MethodName)
+		}
+
+		fullMethod := "/" + desc.ServiceName + "/" + method.MethodName
+		for _, r := range httpRules(md, fullMethod) {
+			if r.err != nil {
+				gw.logger.Warnf("gateway %s skip %s %s : %s", fullMethod, r.method, r.pattern, r.err.Error())
+				continue
+			}
+
+			router.Handle(r.method, r.path, gw.handle(srv, method, fullMethod, r))
+			gw.logger.Infof("gateway %s %s -> %s", r.method, r.path, fullMethod)
+		}
+	}
+
+	return nil
+}
+
+func (gw *Gateway) handle(srv interface{}, method *grpc.MethodDesc, fullMethod string, r *rule) gin.HandlerFunc {
+	maxRecvMsgSize, ok := gw.methodMaxRecvMsgSizes[fullMethod]
+	if !ok {
+		maxRecvMsgSize = gw.maxRecvMsgSize
+	}
+
+	return func(c *gin.Context) {
+		ctx := gw.incomingContext(c, fullMethod)
+		stream := grpc.ServerTransportStreamFromContext(ctx).(*transportStream)
+
+		var body []byte
+		if r.body != "" && c.Request.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxRecvMsgSize)))
+			if err != nil {
+				errcode.Fail(c, status.Error(codes.InvalidArgument, err.Error()))
+				return
+			}
+		}
+
+		dec := func(in interface{}) error {
+			msg, ok := in.(proto.Message)
+			if !ok {
+				return status.Errorf(codes.Internal, "%T is not a proto.Message", in)
+			}
+
+			if err := gw.bind(c, r, body, msg); err != nil {
+				return status.Error(codes.InvalidArgument, err.Error())
+			}
+
+			return nil
+		}
+
+		// 拦截器可能替换 ctx, 保留 handler 收到的 ctx 用于读取 tracer_id
+		handlerCtx := ctx
+		interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			inner := func(ctx context.Context, req interface{}) (interface{}, error) {
+				handlerCtx = ctx
+				return handler(ctx, req)
+			}
+
+			if gw.interceptor == nil {
+				return inner(ctx, req)
+			}
+
+			return gw.interceptor(ctx, req, info, inner)
+		}
+
+		resp, err := method.Handler(srv, ctx, dec, interceptor)
+		c.Request = c.Request.WithContext(handlerCtx)
+		stream.writeHeader(c)
+		if err != nil {
+			errcode.Fail(c, err)
+			return
+		}
+
+		data, err := gw.marshal(resp, r.responseBody)
+		if err != nil {
+			errcode.Fail(c, status.Error(codes.Internal, err.Error()))
+			return
+		}
+
+		errcode.Ok(c, data)
+	}
+}
+
+// incomingContext 请求头转换为 incoming metadata, 拦截器和 handler 可以像 gRPC 请求一样读取.
+func (gw *Gateway) incomingContext(c *gin.Context, fullMethod string) context.Context {
+	md := metadata.MD{}
+	for k, v := range c.Request.Header {
+		md.Append(strings.ToLower(k), v...)
+	}
+	if c.Request.Host != "" {
+		md.Set(":authority", c.Request.Host)
+	}
+
+	ctx := metadata.NewIncomingContext(c.Request.Context(), md)
+	ctx = grpc.NewContextWithServerTransportStream(ctx, &transportStream{method: fullMethod})
+
+	if addr, err := net.ResolveTCPAddr("tcp", c.Request.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+
+	return ctx
+}
+
+// marshal responseBody 不为空时只返回该字段.
+func (gw *Gateway) marshal(resp interface{}, responseBody string) (json.RawMessage, error) {
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto.Message", resp)
+	}
+
+	data, err := gw.marshalOptions.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if responseBody == "" {
+		return data, nil
+	}
+
+	fd := findField(msg.ProtoReflect().Descriptor(), responseBody)
+	if fd == nil {
+		return nil, fmt.Errorf("response_body %s not found", responseBody)
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	name := fd.JSONName()
+	if gw.marshalOptions.UseProtoNames {
+		name = string(fd.Name())
+	}
+
+	if field, ok := fields[name]; ok {
+		return field, nil
+	}
+
+	return json.RawMessage("null"), nil
+}
@@ -0,0 +1,264 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"code.jshyjdtech.com/godev/hykit/errcode"
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const libraryProto = `
+name: "gateway/library.proto"
+package: "gwtest"
+dependency: "google/api/annotations.proto"
+syntax: "proto3"
+message_type: {
+  name: "Filter"
+  field: {name: "hot" number: 1 type: TYPE_BOOL label: LABEL_OPTIONAL json_name: "hot"}
+}
+message_type: {
+  name: "Book"
+  field: {name: "name" number: 1 type: TYPE_STRING label: LABEL_OPTIONAL json_name: "name"}
+  field: {name: "page_count" number: 2 type: TYPE_INT64 label: LABEL_OPTIONAL json_name: "pageCount"}
+  field: {name: "tags" number: 3 type: TYPE_STRING label: LABEL_REPEATED json_name: "tags"}
+  field: {name: "filter" number: 4 type: TYPE_MESSAGE type_name: ".gwtest.Filter" label: LABEL_OPTIONAL json_name: "filter"}
+}
+message_type: {
+  name: "CreateBookRequest"
+  field: {name: "shelf" number: 1 type: TYPE_STRING label: LABEL_OPTIONAL json_name: "shelf"}
+  field: {name: "book" number: 2 type: TYPE_MESSAGE type_name: ".gwtest.Book" label: LABEL_OPTIONAL json_name: "book"}
+}
+service: {
+  name: "Library"
+  method: {
+    name: "GetBook" input_type: ".gwtest.Book" output_type: ".gwtest.Book"
+    options: {[google.api.http]: {get: "/v1/{name=shelves/*/books/*}"}}
+  }
+  method: {
+    name: "CreateBook" input_type: ".gwtest.CreateBookRequest" output_type: ".gwtest.Book"
+    options: {[google.api.http]: {
+      post: "/v1/shelves/{shelf}/books" body: "book" response_body: "name"
+      additional_bindings: {put: "/v1/shelves/{shelf}/books/{book.name}" body: "book"}
+    }}
+  }
+  method: {name: "Echo" input_type: ".gwtest.Book" output_type: ".gwtest.Book"}
+  method: {
+    name: "Fail" input_type: ".gwtest.Book" output_type: ".gwtest.Book"
+    options: {[google.api.http]: {get: "/v1/fail"}}
+  }
+}
+`
+
+var logger = log.NewLogger()
+
+func newFiles(t *testing.T) (*protoregistry.Files, protoreflect.ServiceDescriptor) {
+	fdp := &descriptorpb.FileDescriptorProto{}
+	assert.Nil(t, prototext.Unmarshal([]byte(libraryProto), fdp))
+
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	assert.Nil(t, err)
+
+	files := &protoregistry.Files{}
+	assert.Nil(t, files.RegisterFile(fd))
+
+	return files, fd.Services().ByName("Library")
+}
+
+// serviceDesc 使用 dynamicpb 实现的 Library, handler 与 protoc-gen-go-grpc 生成的代码相同.
+func serviceDesc(sd protoreflect.ServiceDescriptor) *grpc.ServiceDesc {
+	desc := &grpc.ServiceDesc{ServiceName: string(sd.FullName()), HandlerType: (*interface{})(nil)}
+
+	for i := 0; i < sd.Methods().Len(); i++ {
+		md := sd.Methods().Get(i)
+		fullMethod := "/" + string(sd.FullName()) + "/" + string(md.Name())
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: string(md.Name()),
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+				interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := dynamicpb.NewMessage(md.Input())
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(*library).call(ctx, md, req.(proto.Message))
+				}
+				if interceptor == nil {
+					return handler(ctx, in)
+				}
+
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, handler)
+			},
+		})
+	}
+
+	return desc
+}
+
+type library struct{}
+
+func (l *library) call(ctx context.Context, md protoreflect.MethodDescriptor,
+	req proto.Message) (interface{}, error) {
+	switch md.Name() {
+	case "Fail":
+		return nil, errcode.RecordNotFound
+	case "CreateBook":
+		r := req.ProtoReflect()
+		book := r.Get(md.Input().Fields().ByName("book")).Message().Interface()
+		_ = grpc.SetHeader(ctx, metadata.Pairs("x-shelf", r.Get(md.Input().Fields().ByName("shelf")).String()))
+		return book, nil
+	}
+
+	return req, nil
+}
+
+func newRouter(t *testing.T, interceptor grpc.UnaryServerInterceptor, options ...Option) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	files, sd := newFiles(t)
+
+	gatewayOpt := GatewayOptions{}
+	gw := NewGateway(append([]Option{
+		gatewayOpt.WithLogger(logger),
+		gatewayOpt.WithFiles(files),
+		gatewayOpt.WithUnaryInterceptor(interceptor)}, options...)...)
+	assert.Nil(t, gw.Register(router, serviceDesc(sd), &library{}))
+
+	return router
+}
+
+func serve(router *gin.Engine, method, target, body string) (*httptest.ResponseRecorder, errcode.Response) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resp := errcode.Response{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+	return w, resp
+}
+
+func TestGateway_Get(t *testing.T) {
+	router := newRouter(t, nil)
+
+	w, resp := serve(router, http.MethodGet,
+		"/v1/shelves/1/books/2?pageCount=10&tags=a&tags=b&filter.hot=true&unknown=1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, errcode.Success.Code, resp.Code)
+
+	data, _ := json.Marshal(resp.Data)
+	assert.JSONEq(t, `{"name":"shelves/1/books/2","pageCount":"10","tags":["a","b"],"filter":{"hot":true}}`,
+		string(data))
+
+	w, _ = serve(router, http.MethodGet, "/v1/shelves/1/books/2?pageCount=x", "")
+	assert.Equal(t, errcode.InvalidParameter.HTTPStatus, w.Code)
+}
+
+func TestGateway_Body(t *testing.T) {
+	router := newRouter(t, nil)
+
+	w, resp := serve(router, http.MethodPost, "/v1/shelves/s1/books", `{"name":"go","pageCount":"300"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "go", resp.Data)
+	assert.Equal(t, "s1", w.Header().Get(MetadataHeaderPrefix+"X-Shelf"))
+
+	// additional_bindings, 路径变量覆盖请求体
+	_, resp = serve(router, http.MethodPut, "/v1/shelves/s1/books/rust", `{"name":"go"}`)
+	data, _ := json.Marshal(resp.Data)
+	assert.JSONEq(t, `{"name":"rust","pageCount":"0","tags":[],"filter":null}`, string(data))
+}
+
+func TestGateway_Default(t *testing.T) {
+	var calls int32
+	router := newRouter(t, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		md, _ := metadata.FromIncomingContext(ctx)
+		assert.Equal(t, []string{"application/json"}, md.Get("content-type"))
+		assert.Equal(t, "/gwtest.Library/Echo", info.FullMethod)
+		return handler(ctx, req)
+	})
+
+	w, resp := serve(router, http.MethodPost, "/gwtest.Library/Echo", `{"name":"go","tags":["a"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "go", resp.Data.(map[string]interface{})["name"])
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	w, _ = serve(router, http.MethodPost, "/gwtest.Library/Echo", `{"name":`)
+	assert.Equal(t, errcode.InvalidParameter.HTTPStatus, w.Code)
+}
+
+func TestGateway_BodyTooLarge(t *testing.T) {
+	gatewayOpt := GatewayOptions{}
+	router := newRouter(t, nil, gatewayOpt.WithMaxRecvMsgSize(16),
+		gatewayOpt.WithMethodMaxRecvMsgSize("/gwtest.Library/Echo", 64))
+
+	w, _ := serve(router, http.MethodPost, "/v1/shelves/s1/books", `{"name":"go","pageCount":"300"}`)
+	assert.Equal(t, errcode.InvalidParameter.HTTPStatus, w.Code)
+
+	// 方法单独配置的上限
+	w, resp := serve(router, http.MethodPost, "/gwtest.Library/Echo", `{"name":"go","pageCount":"300"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "go", resp.Data.(map[string]interface{})["name"])
+}
+
+func TestGateway_Error(t *testing.T) {
+	router := newRouter(t, errcode.UnaryServerInterceptor())
+
+	w, resp := serve(router, http.MethodGet, "/v1/fail", "")
+	assert.Equal(t, errcode.RecordNotFound.HTTPStatus, w.Code)
+	assert.Equal(t, errcode.RecordNotFound.Code, resp.Code)
+}
+
+func TestParseTemplate(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		path    string
+		vars    []pathVar
+		err     bool
+	}{
+		{"/v1/messages/{message_id}", "/v1/messages/:p0",
+			[]pathVar{{field: "message_id", parts: []string{":p0"}}}, false},
+		{"/v1/{name=shelves/*/books/*}", "/v1/shelves/:p0/books/:p1",
+			[]pathVar{{field: "name", parts: []string{"shelves", ":p0", "books", ":p1"}}}, false},
+		{"/v1/files/{path=**}", "/v1/files/*p0",
+			[]pathVar{{field: "path", parts: []string{":p0"}}}, false},
+		{"/v1/*/items", "/v1/:p0/items", nil, false},
+		{"/v1/{name}:cancel", "", nil, true},
+		{"/v1/{name=**}/items", "", nil, true},
+		{"v1/items", "", nil, true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.pattern, func(t *testing.T) {
+			path, vars, err := parseTemplate(test.pattern)
+			if test.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.path, path)
+			assert.Equal(t, test.vars, vars)
+		})
+	}
+}
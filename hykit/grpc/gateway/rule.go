@@ -0,0 +1,212 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// rule google.api.http 转换后的 gin 路由.
+type rule struct {
+	method string
+
+	// google.api.http 中的路径模板
+	pattern string
+
+	// gin 路由
+	path string
+
+	body string
+
+	responseBody string
+
+	vars []pathVar
+
+	err error
+}
+
+// pathVar 路径模板中的变量, e.g. {name=shelves/*/books/*}.
+type pathVar struct {
+	// 字段路径, e.g. book.name
+	field string
+
+	// 变量值由字面量和 gin 参数组成, 参数以 : 开头
+	parts []string
+}
+
+func (pv pathVar) value(params func(string) string) string {
+	values := make([]string, 0, len(pv.parts))
+	for _, part := range pv.parts {
+		if strings.HasPrefix(part, ":") {
+			values = append(values, strings.TrimPrefix(params(part[1:]), "/"))
+		} else {
+			values = append(values, part)
+		}
+	}
+
+	return strings.Join(values, "/")
+}
+
+// httpRules 方法的 google.api.http 注解和 additional_bindings, 没有注解时使用 POST /package.Service/Method.
+func httpRules(md protoreflect.MethodDescriptor, fullMethod string) []*rule {
+	opts := md.Options()
+	if opts == nil || !proto.HasExtension(opts, annotations.E_Http) {
+		return []*rule{{method: http.MethodPost, pattern: fullMethod, path: fullMethod, body: "*"}}
+	}
+
+	httpRule, ok := proto.GetExtension(opts, annotations.E_Http).(*annotations.HttpRule)
+	if !ok || httpRule == nil {
+		return []*rule{{method: http.MethodPost, pattern: fullMethod, path: fullMethod, body: "*"}}
+	}
+
+	rules := []*rule{newRule(httpRule)}
+	for _, binding := range httpRule.GetAdditionalBindings() {
+		rules = append(rules, newRule(binding))
+	}
+
+	return rules
+}
+
+func newRule(httpRule *annotations.HttpRule) *rule {
+	r := &rule{body: httpRule.GetBody(), responseBody: httpRule.GetResponseBody()}
+
+	switch pattern := httpRule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		r.method, r.pattern = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		r.method, r.pattern = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		r.method, r.pattern = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		r.method, r.pattern = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		r.method, r.pattern = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		r.method, r.pattern = strings.ToUpper(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		r.err = fmt.Errorf("empty pattern")
+		return r
+	}
+
+	r.path, r.vars, r.err = parseTemplate(r.pattern)
+
+	return r
+}
+
+// parseTemplate 把路径模板转换为 gin 路由, 变量中的 * 转换为 :pN, ** 转换为 *pN,
+// 不支持 gin 无法表示的 :verb 后缀.
+func parseTemplate(pattern string) (string, []pathVar, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return "", nil, fmt.Errorf("template must start with /")
+	}
+
+	segments, err := splitTemplate(pattern[1:])
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		paths  []string
+		vars   []pathVar
+		params int
+	)
+
+	param := func() string {
+		name := "p" + strconv.Itoa(params)
+		params++
+		return name
+	}
+
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		if !strings.HasPrefix(segment, "{") {
+			if strings.Contains(segment, ":") {
+				return "", nil, fmt.Errorf("verb is not supported")
+			}
+			if segment == "*" {
+				paths = append(paths, ":"+param())
+				continue
+			}
+			if segment == "**" {
+				if !last {
+					return "", nil, fmt.Errorf("** must be the last segment")
+				}
+				paths = append(paths, "*"+param())
+				continue
+			}
+			paths = append(paths, segment)
+			continue
+		}
+
+		if !strings.HasSuffix(segment, "}") {
+			return "", nil, fmt.Errorf("verb is not supported")
+		}
+
+		field, tpl := segment[1:len(segment)-1], "*"
+		if idx := strings.Index(field, "="); idx >= 0 {
+			field, tpl = field[:idx], field[idx+1:]
+		}
+
+		pv := pathVar{field: field}
+		subs := strings.Split(tpl, "/")
+		for j, sub := range subs {
+			switch sub {
+			case "*":
+				name := param()
+				paths = append(paths, ":"+name)
+				pv.parts = append(pv.parts, ":"+name)
+			case "**":
+				if !last || j != len(subs)-1 {
+					return "", nil, fmt.Errorf("** must be the last segment")
+				}
+				name := param()
+				paths = append(paths, "*"+name)
+				pv.parts = append(pv.parts, ":"+name)
+			default:
+				paths = append(paths, sub)
+				pv.parts = append(pv.parts, sub)
+			}
+		}
+		vars = append(vars, pv)
+	}
+
+	return "/" + strings.Join(paths, "/"), vars, nil
+}
+
+// splitTemplate 按 / 分割, 变量中的 / 不分割.
+func splitTemplate(s string) ([]string, error) {
+	var (
+		segments []string
+		depth    int
+		begin    int
+	)
+
+	for i, ch := range s {
+		switch ch {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced braces")
+			}
+		case '/':
+			if depth == 0 {
+				segments = append(segments, s[begin:i])
+				begin = i + 1
+			}
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced braces")
+	}
+
+	return append(segments, s[begin:]), nil
+}
@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+)
+
+// transportStream 收集 handler 通过 grpc.SetHeader/SendHeader/SetTrailer 设置的 metadata.
+type transportStream struct {
+	method string
+
+	mu sync.Mutex
+
+	header metadata.MD
+
+	trailer metadata.MD
+}
+
+func (ts *transportStream) Method() string {
+	return ts.method
+}
+
+func (ts *transportStream) SetHeader(md metadata.MD) error {
+	ts.mu.Lock()
+	ts.header = metadata.Join(ts.header, md)
+	ts.mu.Unlock()
+	return nil
+}
+
+func (ts *transportStream) SendHeader(md metadata.MD) error {
+	return ts.SetHeader(md)
+}
+
+func (ts *transportStream) SetTrailer(md metadata.MD) error {
+	ts.mu.Lock()
+	ts.trailer = metadata.Join(ts.trailer, md)
+	ts.mu.Unlock()
+	return nil
+}
+
+// writeHeader metadata 以 Grpc-Metadata- 前缀写入响应头.
+func (ts *transportStream) writeHeader(c *gin.Context) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for _, md := range []metadata.MD{ts.header, ts.trailer} {
+		for k, values := range md {
+			if strings.HasSuffix(k, "-bin") {
+				continue
+			}
+
+			key := MetadataHeaderPrefix + textproto.CanonicalMIMEHeaderKey(k)
+			for _, v := range values {
+				c.Writer.Header().Add(key, v)
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package grpc
 
 import (
+	"io"
 	"sync"
 	"time"
 
@@ -10,6 +11,8 @@ import (
 	"github.com/grpc-ecosystem/grpc-opentracing/go/otgrpc"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"code.jshyjdtech.com/godev/hykit/grpc/balancer"
+	"code.jshyjdtech.com/godev/hykit/grpc/discovery"
 	"code.jshyjdtech.com/godev/hykit/grpc/pool"
 	"google.golang.org/grpc/connectivity"
 
@@ -33,6 +36,23 @@ type Client struct {
 	clientMetrics *ggp.ClientMetrics
 	tracer        opentracing2.Tracer
 
+	/*服务发现, 地址使用 discovery.Target(servName)*/
+	discovery discovery.Discovery
+
+	/*方法的超时、重试、对冲策略*/
+	callPolicies []CallPolicy
+
+	/*服务的连接池配置*/
+	poolConfigs []PoolConfig
+
+	/*替换或删除的连接池延迟关闭, 等待使用中的连接完成请求*/
+	poolCloseDelay time.Duration
+
+	tlsConf  TLSConfig
+	insecure bool
+	/*tls 或明文, DialContext && Pool*/
+	transportOpt grpc.DialOption
+
 	/*仅作为DialContext服务使用*/
 	connOpts []grpc.DialOption
 
@@ -82,8 +102,20 @@ func NewClient(options ...Option) *Client {
 		keepAliveClient.Timeout = time.Duration(ClientKpTimeOut) * time.Second
 		keepAliveClient.PermitWithoutStream = client.conf.GetBool("grpc_client_permit_without_stream")
 
+		// tls, 未通过 WithTLS 设置时读取 grpc_client_tls_*
+		if !client.tlsConf.enabled() {
+			client.tlsConf = tlsConfigFromConf(client.conf, "grpc_client")
+		}
+		creds, _ := transportCredentials(client.conf, client.logger, "grpc_client",
+			client.tlsConf, client.insecure, false)
+		if creds != nil {
+			client.transportOpt = grpc.WithTransportCredentials(creds)
+		} else {
+			client.transportOpt = grpc.WithInsecure()
+		}
+
 		client.connOpts = []grpc.DialOption{
-			grpc.WithInsecure(),
+			client.transportOpt,
 			grpc.WithKeepaliveParams(keepAliveClient),
 		}
 
@@ -92,8 +124,33 @@ func NewClient(options ...Option) *Client {
 			client.connOpts = append(client.connOpts, grpc.WithChainUnaryInterceptor(ClientStubs(GlobalStub)))
 		}
 
+		// 连接池配置
+		if client.poolConfigs == nil {
+			if err := client.conf.UnmarshalKey("grpc_client_pools", &client.poolConfigs); err != nil {
+				client.logger.Errorf("grpc_client_pools : %s", err.Error())
+			}
+		}
+		// 单位 ms, 默认 3000, 小于 0 时立即关闭
+		poolCloseDelay := client.conf.GetInt64("grpc_client_pool_close_delay")
+		if poolCloseDelay == 0 {
+			poolCloseDelay = 3000
+		}
+		client.poolCloseDelay = time.Duration(poolCloseDelay) * time.Millisecond
+
 		// DialOption
 		var gRpcOpts = make([]grpc.DialOption, 0)
+
+		// 调用策略, 位于最外层, 重试和对冲的每次请求都经过后面的拦截器
+		if client.callPolicies == nil {
+			if err := client.conf.UnmarshalKey("grpc_client_call_policies", &client.callPolicies); err != nil {
+				client.logger.Errorf("grpc_client_call_policies : %s", err.Error())
+			}
+		}
+		deadlineReserve := client.conf.GetInt64("grpc_client_deadline_reserve")
+		if len(client.callPolicies) > 0 || deadlineReserve > 0 {
+			policies := newCallPolicies(client.callPolicies, time.Duration(deadlineReserve)*time.Millisecond)
+			gRpcOpts = append(gRpcOpts, grpc.WithChainUnaryInterceptor(policies.interceptor()))
+		}
 		// opentracing 追踪
 		if client.conf.GetBool("grpc_client_trace") {
 			if client.tracer == nil {
@@ -101,6 +158,7 @@ func NewClient(options ...Option) *Client {
 			}
 			tracerInterceptor := otgrpc.OpenTracingClientInterceptor(client.tracer)
 			gRpcOpts = append(gRpcOpts, grpc.WithChainUnaryInterceptor(tracerInterceptor))
+			gRpcOpts = append(gRpcOpts, grpc.WithChainStreamInterceptor(otgrpc.OpenTracingStreamClientInterceptor(client.tracer)))
 		}
 
 		// prometheus统计
@@ -110,14 +168,37 @@ func NewClient(options ...Option) *Client {
 				client.clientMetrics = ggp.DefaultClientMetrics
 			}
 			gRpcOpts = append(gRpcOpts, grpc.WithChainUnaryInterceptor(client.clientMetrics.UnaryClientInterceptor()))
+			gRpcOpts = append(gRpcOpts, grpc.WithChainStreamInterceptor(client.clientMetrics.StreamClientInterceptor()))
+		}
+
+		// 并发限制, 下游变慢时直接返回 codes.ResourceExhausted
+		if lim := limiterFromConf(client.conf, client.logger, "grpc_client", "client"); lim != nil {
+			gRpcOpts = append(gRpcOpts, grpc.WithChainUnaryInterceptor(lim.UnaryClientInterceptor()))
 		}
 
 		if client.conf.GetBool("grpc_client_check_slow") {
 			gRpcOpts = append(gRpcOpts, grpc.WithChainUnaryInterceptor(client.checkClientSlow()))
+			gRpcOpts = append(gRpcOpts, grpc.WithChainStreamInterceptor(client.checkStreamClientSlow()))
 		}
 
 		if client.conf.GetBool("grpc_client_debug") {
 			gRpcOpts = append(gRpcOpts, grpc.WithChainUnaryInterceptor(client.clientDebug()))
+			gRpcOpts = append(gRpcOpts, grpc.WithChainStreamInterceptor(client.streamClientDebug()))
+		}
+
+		// 服务发现, 实例变化时连接自动更新
+		if client.discovery != nil {
+			gRpcOpts = append(gRpcOpts, grpc.WithResolvers(
+				discovery.NewResolverBuilder(client.discovery, client.logger)))
+		}
+
+		// 负载均衡: round_robin, least_request, consistent_hash
+		balancerName := client.conf.GetString("grpc_client_balancer")
+		if balancerName == "" && client.discovery != nil {
+			balancerName = balancer.RoundRobin
+		}
+		if balancerName != "" {
+			gRpcOpts = append(gRpcOpts, grpc.WithDefaultServiceConfig(balancer.ServiceConfig(balancerName)))
 		}
 
 		// 测试桩代码
@@ -160,6 +241,41 @@ func (ClientOption) WithMetrics(metrics *ggp.ClientMetrics) Option {
 	}
 }
 
+// WithTLS 优先于 grpc_client_tls_cert, grpc_client_tls_key, grpc_client_tls_ca, grpc_client_tls_server_name.
+func (ClientOption) WithTLS(tlsConf TLSConfig) Option {
+	return func(g *Client) {
+		g.tlsConf = tlsConf
+	}
+}
+
+// WithInsecure 明文传输, 仅用于开发环境, 同 grpc_client_insecure.
+func (ClientOption) WithInsecure() Option {
+	return func(g *Client) {
+		g.insecure = true
+	}
+}
+
+// WithDiscovery 使用服务发现, 通过 LoadDiscoveryPool 或 DialContext(ctx, discovery.Target(servName)) 建立连接.
+func (ClientOption) WithDiscovery(d discovery.Discovery) Option {
+	return func(g *Client) {
+		g.discovery = d
+	}
+}
+
+// WithCallPolicies 方法的调用策略, 未设置时读取 grpc_client_call_policies.
+func (ClientOption) WithCallPolicies(policies ...CallPolicy) Option {
+	return func(g *Client) {
+		g.callPolicies = policies
+	}
+}
+
+// WithPoolConfigs 服务的连接池配置, 未设置时读取 grpc_client_pools.
+func (ClientOption) WithPoolConfigs(configs ...PoolConfig) Option {
+	return func(g *Client) {
+		g.poolConfigs = configs
+	}
+}
+
 func (ClientOption) WithDialOptions(options ...grpc.DialOption) Option {
 	return func(g *Client) {
 		g.opts = options
@@ -205,6 +321,123 @@ func (gc *Client) clientDebug() func(ctx context.Context,
 	}
 }
 
+// finishClientStream 在流结束(RecvMsg 返回错误或 io.EOF)时回调 finish, 只回调一次.
+// 服务端不是流式(客户端流)时, 调用方收到唯一的响应后不会再 RecvMsg, 收到响应即结束.
+type finishClientStream struct {
+	grpc.ClientStream
+
+	serverStreams bool
+
+	once sync.Once
+
+	finish func(err error)
+
+	recv func(m interface{})
+
+	send func(m interface{})
+}
+
+func (fs *finishClientStream) SendMsg(m interface{}) error {
+	if fs.send != nil {
+		fs.send(m)
+	}
+
+	err := fs.ClientStream.SendMsg(m)
+	if err != nil {
+		fs.done(err)
+	}
+
+	return err
+}
+
+func (fs *finishClientStream) RecvMsg(m interface{}) error {
+	err := fs.ClientStream.RecvMsg(m)
+	if err != nil {
+		fs.done(err)
+		return err
+	}
+
+	if fs.recv != nil {
+		fs.recv(m)
+	}
+
+	if !fs.serverStreams {
+		fs.done(nil)
+	}
+
+	return nil
+}
+
+func (fs *finishClientStream) done(err error) {
+	fs.once.Do(func() {
+		if err == io.EOF {
+			err = nil
+		}
+		fs.finish(err)
+	})
+}
+
+func (gc *Client) checkClientStreamSlowTime(ctx context.Context, method string, beginTime time.Time) {
+	ClientSlowTime := gc.conf.GetInt64("grpc_client_slow_time")
+	if ClientSlowTime != 0 {
+		if time.Since(beginTime) > time.Duration(ClientSlowTime)*time.Millisecond {
+			gc.logger.Warnc(ctx, "slow client stream grpc_handle %s", method)
+		}
+	}
+}
+
+func (gc *Client) checkStreamClientSlow() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		beginTime := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			gc.checkClientStreamSlowTime(ctx, method, beginTime)
+			return nil, err
+		}
+
+		return &finishClientStream{
+			ClientStream:  cs,
+			serverStreams: desc.ServerStreams,
+			finish: func(err error) {
+				gc.checkClientStreamSlowTime(ctx, method, beginTime)
+			},
+		}, nil
+	}
+}
+
+func (gc *Client) streamClientDebug() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		beginTime := time.Now()
+		gc.logger.Debugc(ctx, "Grpc client stream start %s : %s", cc.Target(), method)
+
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			gc.logger.Debugc(ctx, "Grpc client stream end [%v] %s : %s, err : %v",
+				time.Since(beginTime).String(), cc.Target(), method, err)
+			return nil, err
+		}
+
+		return &finishClientStream{
+			ClientStream:  cs,
+			serverStreams: desc.ServerStreams,
+			send: func(m interface{}) {
+				gc.logger.Debugc(ctx, "Grpc client stream send %s : %s, req : %s",
+					cc.Target(), method, spew.Sdump(m))
+			},
+			recv: func(m interface{}) {
+				gc.logger.Debugc(ctx, "Grpc client stream recv %s : %s, reply : %s",
+					cc.Target(), method, spew.Sdump(m))
+			},
+			finish: func(err error) {
+				gc.logger.Debugc(ctx, "Grpc client stream end [%v] %s : %s, err : %v",
+					time.Since(beginTime).String(), cc.Target(), method, err)
+			},
+		}, nil
+	}
+}
+
 /*返回单独的连接封装*/
 type ClientConn struct {
 	conn   *grpc.ClientConn
@@ -212,7 +445,9 @@ type ClientConn struct {
 	logger log.Logger
 }
 
-func (gc *Client) DialContext(ctx context.Context, serverAddr string) (*ClientConn, error) {
+// DialContext options 追加到 Client 的 DialOption 之后, e.g. grpc.WithContextDialer.
+func (gc *Client) DialContext(ctx context.Context, serverAddr string,
+	options ...grpc.DialOption) (*ClientConn, error) {
 	var cancel context.CancelFunc
 	var err error
 	cc := &ClientConn{
@@ -228,8 +463,10 @@ func (gc *Client) DialContext(ctx context.Context, serverAddr string) (*ClientCo
 	cc.cancel = cancel
 
 	/*请求服务端地址*/
-	opts := gc.connOpts
+	opts := make([]grpc.DialOption, 0, len(gc.connOpts)+len(gc.opts)+len(options))
+	opts = append(opts, gc.connOpts...)
 	opts = append(opts, gc.opts...)
+	opts = append(opts, options...)
 	cc.conn, err = grpc.DialContext(ctx, serverAddr, opts...)
 	if err != nil {
 		gc.logger.Errorc(ctx, "DialContext 到[%s] 失败[%s]", err)
@@ -257,7 +494,9 @@ type Pool struct {
 	pool       pool.Pool
 }
 
-func (gc *Client) NewPool(ctx context.Context, servName, servAddr string) (*Pool, error) {
+// NewPool options 追加到每个连接的 DialOption 之后.
+func (gc *Client) NewPool(ctx context.Context, servName, servAddr string,
+	options ...grpc.DialOption) (*Pool, error) {
 	var err error
 	gcp := &Pool{
 		serverName: servName,
@@ -267,17 +506,18 @@ func (gc *Client) NewPool(ctx context.Context, servName, servAddr string) (*Pool
 	gc.logger.Infoc(ctx, "开始建立到[%s]地址[%s]的连接池;", servName, servAddr)
 
 	//连接池初始化参数
-	poolOpt := pool.DefaultOptions
+	poolConf := gc.poolConfig(servName)
+	poolOpt := poolConf.options()
 	poolOpt.Dial = func(address string) (*grpc.ClientConn, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), pool.DialTimeout)
 		defer cancel()
 		var gRpcOpts = []grpc.DialOption{
-			grpc.WithInsecure(),
+			gc.transportOpt,
 			//grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.Config{MaxDelay: pool.BackoffMaxDelay}}),
 			grpc.WithInitialWindowSize(pool.InitialWindowSize),
 			grpc.WithInitialConnWindowSize(pool.InitialConnWindowSize),
-			grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(pool.MaxSendMsgSize)),
-			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(pool.MaxRecvMsgSize)),
+			grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(poolConf.MaxSendMsgSize)),
+			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(poolConf.MaxRecvMsgSize)),
 			grpc.WithKeepaliveParams(keepalive.ClientParameters{
 				Time:                pool.KeepAliveTime,
 				Timeout:             pool.KeepAliveTimeout,
@@ -285,6 +525,7 @@ func (gc *Client) NewPool(ctx context.Context, servName, servAddr string) (*Pool
 			}),
 		}
 		gRpcOpts = append(gRpcOpts, gc.opts...)
+		gRpcOpts = append(gRpcOpts, options...)
 		return grpc.DialContext(ctx, address, gRpcOpts...)
 	}
 	//创建gRPC pool 连接池
@@ -403,6 +644,17 @@ func (gc *Client) LoadServerPool(ctx context.Context, servName, servAddr string)
 	}
 }
 
+/*
+	通过服务发现获取服务的连接池, 服务实例变化时由 resolver 自动更新, 不需要调用 UpdateServerPool
+*/
+func (gc *Client) LoadDiscoveryPool(ctx context.Context, servName string) (*Pool, error) {
+	if gc.discovery == nil {
+		return nil, errors.Errorf("LoadDiscoveryPool[%s]未配置服务发现", servName)
+	}
+
+	return gc.LoadServerPool(ctx, servName, discovery.Target(servName))
+}
+
 /*
 	根据服务名称：更新服务连接池；
 	服务连接池地址发生变化，则更新连接池信息，否则仍使用原连接池信息
@@ -445,6 +697,10 @@ func (gc *Client) UpdateServerPool(ctx context.Context, servName, servAddr strin
 		}
 		gc.servPoolMap.Store(servName, p)
 		gc.mu.Unlock()
+		//关闭原连接池, 否则连接和健康检查一直存在
+		if old, ok := v.(*Pool); ok {
+			gc.closePool(ctx, old)
+		}
 		gc.logger.Infoc(ctx, "UpdateServerPool:[%s]连接池更新成功；", servName)
 		return p, nil
 	}
@@ -461,6 +717,29 @@ func (gc *Client) RemoveServerPool(ctx context.Context, servName string) error {
 	if servName == "" {
 		return errors.Errorf("服务名称[%s]传入参数非法;", servName)
 	}
+	gc.mu.Lock()
+	v, ok := gc.servPoolMap.Load(servName)
 	gc.servPoolMap.Delete(servName)
+	gc.mu.Unlock()
+	if sPool, ok2 := v.(*Pool); ok && ok2 {
+		gc.closePool(ctx, sPool)
+	}
 	return nil
 }
+
+// closePool 延迟 grpc_client_pool_close_delay 关闭, 已经取出的连接可以完成请求.
+func (gc *Client) closePool(ctx context.Context, p *Pool) {
+	closeFunc := func() {
+		if err := p.Close(); err != nil {
+			gc.logger.Errorc(ctx, "关闭[%s]地址[%s]连接池失败:[%s]", p.serverName, p.serverAddr, err)
+			return
+		}
+		gc.logger.Infoc(ctx, "关闭[%s]地址[%s]连接池", p.serverName, p.serverAddr)
+	}
+
+	if gc.poolCloseDelay <= 0 {
+		closeFunc()
+		return
+	}
+	time.AfterFunc(gc.poolCloseDelay, closeFunc)
+}
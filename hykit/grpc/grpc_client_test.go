@@ -3,10 +3,10 @@ package grpc
 import (
 	"context"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
-	"code.jshyjdtech.com/godev/hykit/config"
 	"code.jshyjdtech.com/godev/hykit/log"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
@@ -36,7 +36,7 @@ const (
 )
 
 func TestNewGrpcClient(t *testing.T) {
-	memConfig := config.NewMemConfig()
+	memConfig := newMemConfig()
 	memConfig.Set("debug", true)
 	memConfig.Set("grpc_client_debug", true)
 
@@ -64,7 +64,7 @@ func TestNewGrpcClient(t *testing.T) {
 }
 
 func TestGrpcClientPool(t *testing.T) {
-	memConfig := config.NewMemConfig()
+	memConfig := newMemConfig()
 	memConfig.Set("debug", true)
 	memConfig.Set("grpc_client_debug", true)
 	memConfig.Set("grpc_client_check_slow", true)
@@ -120,7 +120,9 @@ func TestGrpcClientPool(t *testing.T) {
 }
 
 func TestSlowClient(t *testing.T) {
-	memConfig := config.NewMemConfig()
+	onceClient = sync.Once{}
+
+	memConfig := newMemConfig()
 	memConfig.Set("debug", true)
 	memConfig.Set("grpc_client_debug", true)
 	memConfig.Set("grpc_client_check_slow", true)
@@ -155,7 +157,7 @@ func TestSlowClient(t *testing.T) {
 }
 
 func TestServerPanic(t *testing.T) {
-	memConfig := config.NewMemConfig()
+	memConfig := newMemConfig()
 	memConfig.Set("debug", true)
 	memConfig.Set("grpc_client_debug", true)
 
@@ -179,7 +181,7 @@ func TestServerPanic(t *testing.T) {
 }
 
 func TestServerPanicArr(t *testing.T) {
-	memConfig := config.NewMemConfig()
+	memConfig := newMemConfig()
 	memConfig.Set("debug", true)
 	memConfig.Set("grpc_client_debug", true)
 
@@ -204,7 +206,9 @@ func TestServerPanicArr(t *testing.T) {
 }
 
 func TestSubsReply(t *testing.T) {
-	memConfig := config.NewMemConfig()
+	onceClient = sync.Once{}
+
+	memConfig := newMemConfig()
 	memConfig.Set("debug", true)
 	memConfig.Set("grpc_client_debug", true)
 
@@ -242,7 +246,12 @@ func TestSubsReply(t *testing.T) {
 }
 
 func TestGlobalSubs(t *testing.T) {
-	memConfig := config.NewMemConfig()
+	onceClient = sync.Once{}
+	defer func() {
+		GlobalStub = nil
+	}()
+
+	memConfig := newMemConfig()
 	memConfig.Set("debug", true)
 	memConfig.Set("grpc_client_debug", true)
 
@@ -0,0 +1,142 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/grpc/discovery"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	pb "google.golang.org/grpc/examples/helloworld/helloworld"
+)
+
+// addrServer 返回服务端地址, 用于判断请求被路由到哪个实例.
+type addrServer struct {
+	pb.UnimplementedGreeterServer
+
+	addr string
+}
+
+func (s *addrServer) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: s.addr}, nil
+}
+
+func startAddrServer(t *testing.T) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	s := grpc.NewServer()
+	pb.RegisterGreeterServer(s, &addrServer{addr: lis.Addr().String()})
+	go s.Serve(lis)
+
+	return lis.Addr().String(), s.Stop
+}
+
+func TestLoadDiscoveryPool(t *testing.T) {
+	onceClient = sync.Once{}
+
+	addr1, stop1 := startAddrServer(t)
+	defer stop1()
+	addr2, stop2 := startAddrServer(t)
+	defer stop2()
+
+	ctx := context.Background()
+	registry := discovery.NewMemRegistry()
+	assert.Nil(t, registry.Register(ctx, discovery.Instance{Service: "greeter", Addr: addr1}, 0))
+	assert.Nil(t, registry.Register(ctx, discovery.Instance{Service: "greeter", Addr: addr2}, 0))
+
+	clientOpt := ClientOption{}
+	client := NewClient(
+		clientOpt.WithLogger(logger),
+		clientOpt.WithConf(newMemConfig()),
+		clientOpt.WithDiscovery(registry))
+
+	p, err := client.LoadDiscoveryPool(ctx, "greeter")
+	assert.Nil(t, err)
+	defer p.Close()
+
+	conn, err := p.Get()
+	assert.Nil(t, err)
+	c := pb.NewGreeterClient(conn.Value())
+
+	hits := func() map[string]int {
+		res := make(map[string]int)
+		for i := 0; i < 20; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			r, err := c.SayHello(ctx, &pb.HelloRequest{Name: esim}, grpc.WaitForReady(true))
+			cancel()
+			if assert.Nil(t, err) {
+				res[r.Message]++
+			}
+		}
+		return res
+	}
+
+	// round_robin 分配到两个实例
+	assert.Eventually(t, func() bool {
+		return len(hits()) == 2
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// 下线的实例不再路由
+	assert.Nil(t, registry.Deregister(ctx, discovery.Instance{Service: "greeter", Addr: addr1}))
+	assert.Eventually(t, func() bool {
+		res := hits()
+		return len(res) == 1 && res[addr2] == 20
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestServerRegistry(t *testing.T) {
+	memConfig := newMemConfig()
+	memConfig.Set("appname", "greeter")
+	memConfig.Set("version", "1.0.0")
+	memConfig.Set("grpc_server_register_ttl", 1)
+
+	registry := discovery.NewMemRegistry()
+
+	serverOptions := ServerOptions{}
+	svr := NewServer("127.0.0.1:0",
+		serverOptions.WithServerLogger(logger),
+		serverOptions.WithServerConf(memConfig),
+		serverOptions.WithRegistry(registry, discovery.Instance{
+			Metadata: map[string]string{"zone": "a"},
+		}))
+	pb.RegisterGreeterServer(svr.Server, &server{})
+	svr.Start()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := registry.Watch(ctx, "greeter")
+	assert.Nil(t, err)
+
+	insts := <-ch
+	if assert.Len(t, insts, 1) {
+		assert.Equal(t, svr.Addr(), insts[0].Addr)
+		assert.Equal(t, "1.0.0", insts[0].Version)
+		assert.Equal(t, 1, insts[0].Weight)
+		assert.Equal(t, "a", insts[0].Metadata["zone"])
+	}
+
+	// 续期后超过 ttl 仍然在线
+	select {
+	case insts = <-ch:
+		t.Fatalf("instance changed %v", insts)
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	svr.GracefulShutDown()
+	assert.Len(t, <-ch, 0)
+}
+
+func TestRegistrar_NegativeTTL(t *testing.T) {
+	memConfig := newMemConfig()
+	memConfig.Set("appname", "greeter")
+	memConfig.Set("grpc_server_register_ttl", -1)
+
+	r := &registrar{registry: discovery.NewMemRegistry()}
+	assert.Panics(t, func() {
+		r.init(memConfig, logger)
+	})
+}
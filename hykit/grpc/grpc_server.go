@@ -3,8 +3,11 @@ package grpc
 import (
 	"net"
 	"runtime"
+	"sort"
+	"strings"
 	"time"
 
+	"code.jshyjdtech.com/godev/hykit/grpc/discovery"
 	"code.jshyjdtech.com/godev/hykit/grpc/pool"
 
 	"fmt"
@@ -21,6 +24,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 )
@@ -34,6 +38,11 @@ type Server struct {
 
 	unaryServerInterceptors []grpc.UnaryServerInterceptor
 
+	/*完整的 unary 拦截器链, gateway 使用*/
+	unaryInterceptor grpc.UnaryServerInterceptor
+
+	streamServerInterceptors []grpc.StreamServerInterceptor
+
 	opts []grpc.ServerOption
 
 	target string
@@ -41,12 +50,25 @@ type Server struct {
 	serviceName string
 
 	tracer opentracing2.Tracer
+
+	lis net.Listener
+
+	registrar *registrar
+
+	health *healthChecker
+
+	tlsConf TLSConfig
+
+	insecure bool
+
+	tls *tlsReloader
 }
 
 type ServerOption func(c *Server)
 
 func NewServer(target string, options ...ServerOption) *Server {
 	Server := &Server{}
+	Server.health = newHealthChecker()
 
 	Server.target = target
 
@@ -66,12 +88,27 @@ func NewServer(target string, options ...ServerOption) *Server {
 		Server.tracer = opentracing2.NoopTracer{}
 	}
 
+	Server.health.logger = Server.logger
+	healthInterval := Server.conf.GetInt64("grpc_server_health_interval")
+	if healthInterval == 0 {
+		healthInterval = 5000
+	}
+	Server.health.interval = time.Duration(healthInterval) * time.Millisecond
+
+	if Server.registrar != nil {
+		Server.registrar.init(Server.conf, Server.logger)
+		Server.serviceName = Server.registrar.inst.Service
+	}
+
 	unaryServerInterceptors := make([]grpc.UnaryServerInterceptor, 0)
+	streamServerInterceptors := make([]grpc.StreamServerInterceptor, 0)
 
 	//trace
 	if Server.conf.GetBool("grpc_server_trace") {
 		unaryServerInterceptors = append(unaryServerInterceptors, otgrpc.OpenTracingServerInterceptor(Server.tracer))
 		unaryServerInterceptors = append(unaryServerInterceptors, Server.tracerID())
+		streamServerInterceptors = append(streamServerInterceptors, otgrpc.OpenTracingStreamServerInterceptor(Server.tracer))
+		streamServerInterceptors = append(streamServerInterceptors, Server.streamTracerID())
 	}
 
 	if Server.conf.GetBool("grpc_server_metrics") {
@@ -79,28 +116,58 @@ func NewServer(target string, options ...ServerOption) *Server {
 		serverMetrics := ggp.DefaultServerMetrics
 		serverMetrics.EnableHandlingTimeHistogram(ggp.WithHistogramBuckets(prometheus.DefBuckets))
 		unaryServerInterceptors = append(unaryServerInterceptors, serverMetrics.UnaryServerInterceptor())
+		streamServerInterceptors = append(streamServerInterceptors, serverMetrics.StreamServerInterceptor())
+	}
+
+	// 并发限制, 在 metrics 之后, 拒绝的请求也能统计到
+	if lim := limiterFromConf(Server.conf, Server.logger, "grpc_server", "server"); lim != nil {
+		unaryServerInterceptors = append(unaryServerInterceptors, lim.UnaryServerInterceptor())
+		streamServerInterceptors = append(streamServerInterceptors, lim.StreamServerInterceptor())
 	}
 
 	if Server.conf.GetBool("grpc_server_check_slow") {
 		unaryServerInterceptors = append(unaryServerInterceptors, Server.checkServerSlow())
+		streamServerInterceptors = append(streamServerInterceptors, Server.checkStreamServerSlow())
 	}
 
 	if Server.conf.GetBool("grpc_server_debug") {
 		unaryServerInterceptors = append(unaryServerInterceptors, Server.serverDebug())
+		streamServerInterceptors = append(streamServerInterceptors, Server.streamServerDebug())
 	}
 
 	// handle panic
 	unaryServerInterceptors = append(unaryServerInterceptors, grpc_recovery.UnaryServerInterceptor(grpc_recovery.WithRecoveryHandlerContext(Server.handelPanic())))
+	streamServerInterceptors = append(streamServerInterceptors, grpc_recovery.StreamServerInterceptor(grpc_recovery.WithRecoveryHandlerContext(Server.handelPanic())))
 
 	if len(Server.unaryServerInterceptors) > 0 {
 		unaryServerInterceptors = append(unaryServerInterceptors, Server.unaryServerInterceptors...)
 	}
 
+	if len(Server.streamServerInterceptors) > 0 {
+		streamServerInterceptors = append(streamServerInterceptors, Server.streamServerInterceptors...)
+	}
+
 	var baseOpts = make([]grpc.ServerOption, 0)
 
+	// tls, 未通过 WithTLS 设置时读取 grpc_server_tls_*
+	if !Server.tlsConf.enabled() {
+		Server.tlsConf = tlsConfigFromConf(Server.conf, "grpc_server")
+	}
+	creds, reloader := transportCredentials(Server.conf, Server.logger, "grpc_server",
+		Server.tlsConf, Server.insecure, true)
+	if creds != nil {
+		Server.tls = reloader
+		baseOpts = append(baseOpts, grpc.Creds(creds))
+	}
+
 	if len(unaryServerInterceptors) > 0 {
-		ui := grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unaryServerInterceptors...))
-		baseOpts = append(baseOpts, ui)
+		Server.unaryInterceptor = grpc_middleware.ChainUnaryServer(unaryServerInterceptors...)
+		baseOpts = append(baseOpts, grpc.UnaryInterceptor(Server.unaryInterceptor))
+	}
+
+	if len(streamServerInterceptors) > 0 {
+		si := grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(streamServerInterceptors...))
+		baseOpts = append(baseOpts, si)
 	}
 
 	if len(Server.opts) > 0 {
@@ -125,6 +192,9 @@ func NewServer(target string, options ...ServerOption) *Server {
 
 	Server.Server = s
 
+	// grpc.health.v1
+	Server.health.register(s)
+
 	return Server
 }
 
@@ -148,6 +218,56 @@ func (ServerOptions) WithUnarySrvItcp(options ...grpc.UnaryServerInterceptor) Se
 	}
 }
 
+func (ServerOptions) WithStreamSrvItcp(options ...grpc.StreamServerInterceptor) ServerOption {
+	return func(g *Server) {
+		g.streamServerInterceptors = options
+	}
+}
+
+// WithRegistry Start 时注册实例并定时续期, GracefulShutDown 时下线,
+// inst 中未设置的 Service、Addr 使用 appname 和监听地址.
+func (ServerOptions) WithRegistry(registry discovery.Registry, inst discovery.Instance) ServerOption {
+	return func(g *Server) {
+		g.registrar = &registrar{registry: registry, inst: inst}
+	}
+}
+
+// WithPinger service 的依赖, service 为空时影响全部服务,
+// e.g. WithPinger("", redisClient), WithPinger("pay.Pay", bankClient).
+func (ServerOptions) WithPinger(service, name string, pinger Pinger) ServerOption {
+	return func(g *Server) {
+		g.health.checks = append(g.health.checks, healthCheck{service: service, name: name,
+			check: func() []error {
+				if err := pinger.Ping(); err != nil {
+					return []error{err}
+				}
+				return nil
+			}})
+	}
+}
+
+// WithMultiPinger 同 WithPinger, e.g. WithMultiPinger("", "mysql", mysqlClient).
+func (ServerOptions) WithMultiPinger(service, name string, pinger MultiPinger) ServerOption {
+	return func(g *Server) {
+		g.health.checks = append(g.health.checks, healthCheck{service: service, name: name, check: pinger.Ping})
+	}
+}
+
+// WithTLS 优先于 grpc_server_tls_cert, grpc_server_tls_key, grpc_server_tls_ca,
+// 配置 CAFile 时要求客户端证书.
+func (ServerOptions) WithTLS(tlsConf TLSConfig) ServerOption {
+	return func(g *Server) {
+		g.tlsConf = tlsConf
+	}
+}
+
+// WithInsecure 明文传输, 仅用于开发环境, 同 grpc_server_insecure.
+func (ServerOptions) WithInsecure() ServerOption {
+	return func(g *Server) {
+		g.insecure = true
+	}
+}
+
 func (ServerOptions) WithServerOption(options ...grpc.ServerOption) ServerOption {
 	return func(g *Server) {
 		g.opts = options
@@ -232,6 +352,93 @@ func (gs *Server) tracerID() grpc.UnaryServerInterceptor {
 	}
 }
 
+func (gs *Server) checkStreamServerSlow() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		beginTime := time.Now()
+		err := handler(srv, ss)
+		endTime := time.Now()
+
+		grpcServerSlowTime := gs.conf.GetInt64("grpc_server_slow_time")
+		if grpcServerSlowTime != 0 {
+			diffTime := endTime.Sub(beginTime)
+			if diffTime > time.Duration(grpcServerSlowTime)*time.Millisecond {
+				gs.logger.Warnc(ss.Context(), "Slow server stream %d %s", diffTime, info.FullMethod)
+			}
+		}
+
+		return err
+	}
+}
+
+// debugServerStream 记录流上收发的每条消息.
+type debugServerStream struct {
+	grpc.ServerStream
+
+	logger log.Logger
+
+	method string
+}
+
+func (ds *debugServerStream) RecvMsg(m interface{}) error {
+	err := ds.ServerStream.RecvMsg(m)
+	if err == nil {
+		ds.logger.Debugc(ds.Context(), "Grpc server stream recv %s, req : %s", ds.method, spew.Sdump(m))
+	}
+
+	return err
+}
+
+func (ds *debugServerStream) SendMsg(m interface{}) error {
+	ds.logger.Debugc(ds.Context(), "Grpc server stream send %s, resp : %s", ds.method, spew.Sdump(m))
+
+	return ds.ServerStream.SendMsg(m)
+}
+
+func (gs *Server) streamServerDebug() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		beginTime := time.Now()
+		gs.logger.Debugc(ss.Context(), "Grpc server stream start %s", info.FullMethod)
+
+		err := handler(srv, &debugServerStream{ServerStream: ss, logger: gs.logger, method: info.FullMethod})
+
+		endTime := time.Now()
+		gs.logger.Debugc(ss.Context(), "Grpc server stream end [%v] %s, err : %v",
+			endTime.Sub(beginTime).String(), info.FullMethod, err)
+
+		return err
+	}
+}
+
+// streamTracerID 和 tracerID 相同, 通过 WrappedServerStream 替换流的 context.
+func (gs *Server) streamTracerID() grpc.StreamServerInterceptor {
+	tracerID := tracerid.TracerID()
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if tracerid.ExtractTracerID(ss.Context()) != "" {
+			return handler(srv, ss)
+		}
+
+		wrapped := grpc_middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = context.WithValue(ss.Context(), tracerid.ActiveEsimKey, tracerID())
+
+		return handler(srv, wrapped)
+	}
+}
+
 //nolint:deadcode,unused
 func nilResp() grpc.UnaryServerInterceptor {
 	return func(
@@ -266,8 +473,19 @@ func (gs *Server) Start() {
 		gs.logger.Panicf("Failed to listen: %s", err.Error())
 	}
 
+	gs.Serve(lis)
+}
+
+// Serve 在指定的 listener 上启动服务, e.g. 测试中使用 bufconn.
+func (gs *Server) Serve(lis net.Listener) {
+	gs.lis = lis
+
 	// Register reflection service on gRPC server.
-	reflection.Register(gs.Server)
+	if !gs.conf.GetBool("grpc_server_disable_reflection") {
+		reflection.Register(gs.Server)
+	}
+
+	gs.health.start(gs.services())
 
 	gs.logger.Infof("Grpc server starting %s:%s",
 		gs.serviceName, gs.target)
@@ -276,8 +494,51 @@ func (gs *Server) Start() {
 			gs.logger.Panicf("Failed to start server: %s", err.Error())
 		}
 	}()
+
+	if gs.registrar != nil {
+		gs.registrar.start(lis.Addr())
+	}
+}
+
+// UnaryInterceptor 服务端完整的 unary 拦截器链, 用于 gateway.GatewayOptions.WithUnaryInterceptor.
+func (gs *Server) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return gs.unaryInterceptor
+}
+
+// Addr 监听的地址, Start 之后可用.
+func (gs *Server) Addr() string {
+	if gs.lis == nil {
+		return gs.target
+	}
+
+	return gs.lis.Addr().String()
+}
+
+// services 注册的业务服务, 不包含 health 和 reflection.
+func (gs *Server) services() []string {
+	services := make([]string, 0)
+	for service := range gs.Server.GetServiceInfo() {
+		if service == healthpb.Health_ServiceDesc.ServiceName ||
+			strings.HasPrefix(service, "grpc.reflection.") {
+			continue
+		}
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	return services
 }
 
 func (gs *Server) GracefulShutDown() {
+	// 健康检查先返回 NOT_SERVING
+	gs.health.shutdown()
+
+	// 先从注册中心下线, 客户端不再路由新请求后再处理完剩余请求
+	if gs.registrar != nil {
+		gs.registrar.stop()
+	}
+
 	gs.Server.GracefulStop()
+
+	gs.tls.close()
 }
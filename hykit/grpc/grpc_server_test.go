@@ -1,27 +1,70 @@
 package grpc
 
 import (
+	"io"
 	"os"
+	"sync/atomic"
 	"testing"
 
 	"code.jshyjdtech.com/godev/hykit/config"
 	"code.jshyjdtech.com/godev/hykit/opentracing"
+	tracerid "code.jshyjdtech.com/godev/hykit/pkg/tracer-id"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/examples/features/proto/echo"
 	pb "google.golang.org/grpc/examples/helloworld/helloworld"
 )
 
 // server is used to implement helloworld.GreeterServer.
-type server struct{}
+type server struct {
+	pb.UnimplementedGreeterServer
+}
 
 // SayHello implements helloworld.GreeterServer.
 func (s *server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
 	return &pb.HelloReply{Message: "Hello " + in.Name}, nil
 }
 
+var streamSrvItcpCalls int32
+
+type echoServer struct {
+	echo.UnimplementedEchoServer
+}
+
+// BidirectionalStreamingEcho 返回收到的消息和流上的 tracer_id.
+func (s *echoServer) BidirectionalStreamingEcho(stream echo.Echo_BidirectionalStreamingEchoServer) error {
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if in.Message == callPanic {
+			panic(isTest)
+		}
+
+		err = stream.Send(&echo.EchoResponse{
+			Message: in.Message + ":" + tracerid.ExtractTracerID(stream.Context())})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// newMemConfig 测试没有配置证书, 显式使用明文.
+func newMemConfig() *config.MemConfig {
+	memConfig := config.NewMemConfig()
+	memConfig.Set("grpc_server_insecure", true)
+	memConfig.Set("grpc_client_insecure", true)
+	return memConfig
+}
+
 func TestMain(m *testing.M) {
 	serverOptions := ServerOptions{}
-	memConfig := config.NewMemConfig()
+	memConfig := newMemConfig()
 	memConfig.Set("debug", true)
 	memConfig.Set("grpc_server_debug", true)
 	memConfig.Set("grpc_server_metrics", true)
@@ -48,9 +91,17 @@ func TestMain(m *testing.M) {
 
 				return resp, err
 			}),
+		),
+		serverOptions.WithStreamSrvItcp(
+			func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+				handler grpc.StreamHandler) error {
+				atomic.AddInt32(&streamSrvItcpCalls, 1)
+				return handler(srv, ss)
+			},
 		))
 
 	pb.RegisterGreeterServer(svr.Server, &server{})
+	echo.RegisterEchoServer(svr.Server, &echoServer{})
 
 	svr.Start()
 
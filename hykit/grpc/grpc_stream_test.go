@@ -0,0 +1,120 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/examples/features/proto/echo"
+)
+
+func newStreamClient(t *testing.T) (echo.EchoClient, func()) {
+	onceClient = sync.Once{}
+
+	memConfig := newMemConfig()
+	memConfig.Set("debug", true)
+	memConfig.Set("grpc_client_debug", true)
+	memConfig.Set("grpc_client_metrics", true)
+	memConfig.Set("grpc_client_check_slow", true)
+	memConfig.Set("grpc_client_slow_time", 1)
+
+	clientOpt := ClientOption{}
+	client := NewClient(
+		clientOpt.WithLogger(logger),
+		clientOpt.WithConf(memConfig))
+
+	conn, err := client.DialContext(context.Background(), tcpAddr.String())
+	assert.Nil(t, err)
+
+	return echo.NewEchoClient(conn.Conn()), conn.Close
+}
+
+func TestStreamInterceptors(t *testing.T) {
+	c, closeConn := newStreamClient(t)
+	defer closeConn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	before := atomic.LoadInt32(&streamSrvItcpCalls)
+
+	stream, err := c.BidirectionalStreamingEcho(ctx)
+	assert.Nil(t, err)
+
+	for _, msg := range []string{"a", "b"} {
+		assert.Nil(t, stream.Send(&echo.EchoRequest{Message: msg}))
+
+		resp, err := stream.Recv()
+		assert.Nil(t, err)
+
+		parts := strings.SplitN(resp.Message, ":", 2)
+		assert.Equal(t, msg, parts[0])
+		// streamTracerID 注入的 tracer_id
+		assert.NotEmpty(t, parts[1])
+	}
+
+	assert.Nil(t, stream.CloseSend())
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	assert.Equal(t, before+1, atomic.LoadInt32(&streamSrvItcpCalls))
+}
+
+func TestStreamServerPanic(t *testing.T) {
+	c, closeConn := newStreamClient(t)
+	defer closeConn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	stream, err := c.BidirectionalStreamingEcho(ctx)
+	assert.Nil(t, err)
+
+	assert.Nil(t, stream.Send(&echo.EchoRequest{Message: callPanic}))
+
+	_, err = stream.Recv()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "server panic")
+}
+
+type recvClientStream struct {
+	grpc.ClientStream
+
+	replies int
+}
+
+func (rs *recvClientStream) RecvMsg(m interface{}) error {
+	if rs.replies == 0 {
+		return io.EOF
+	}
+	rs.replies--
+	return nil
+}
+
+func TestFinishClientStream(t *testing.T) {
+	var finished int32
+	finish := func(err error) {
+		assert.Nil(t, err)
+		atomic.AddInt32(&finished, 1)
+	}
+
+	// 客户端流, 收到唯一的响应即结束
+	fs := &finishClientStream{ClientStream: &recvClientStream{replies: 1}, finish: finish}
+	assert.Nil(t, fs.RecvMsg(nil))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+
+	// 服务端流, 直到 io.EOF 才结束
+	atomic.StoreInt32(&finished, 0)
+	fs = &finishClientStream{ClientStream: &recvClientStream{replies: 2}, serverStreams: true, finish: finish}
+	assert.Nil(t, fs.RecvMsg(nil))
+	assert.Nil(t, fs.RecvMsg(nil))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&finished))
+	assert.Equal(t, io.EOF, fs.RecvMsg(nil))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+}
@@ -0,0 +1,97 @@
+package grpctest
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var update = flag.Bool("grpctest.update", false, "update golden files in testdata")
+
+// golden 请求、响应和错误, 错误为 google.rpc.Status.
+type golden struct {
+	Request json.RawMessage `json:"request"`
+
+	Response json.RawMessage `json:"response"`
+
+	Error json.RawMessage `json:"error,omitempty"`
+}
+
+// AssertGolden 把请求、响应和错误格式化后与 testdata/<name>.golden 比较,
+// go test -grpctest.update 时写入文件.
+func AssertGolden(t testing.TB, name string, req, resp proto.Message, err error) bool {
+	t.Helper()
+
+	actual, marshalErr := marshalGolden(req, resp, err)
+	if !assert.Nil(t, marshalErr) {
+		return false
+	}
+
+	file := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err = os.MkdirAll("testdata", 0755); err == nil {
+			err = os.WriteFile(file, actual, 0644)
+		}
+		return assert.Nil(t, err)
+	}
+
+	expected, err := os.ReadFile(file)
+	if err != nil {
+		return assert.Fail(t, "read golden file", "%s, run go test -grpctest.update to create it", err.Error())
+	}
+
+	return assert.Equal(t, string(expected), string(actual), "golden file %s", file)
+}
+
+func marshalGolden(req, resp proto.Message, err error) ([]byte, error) {
+	g := golden{}
+
+	var marshalErr error
+	if g.Request, marshalErr = marshalMessage(req); marshalErr != nil {
+		return nil, marshalErr
+	}
+
+	if err != nil {
+		if g.Error, marshalErr = marshalMessage(status.Convert(err).Proto()); marshalErr != nil {
+			return nil, marshalErr
+		}
+		resp = nil
+	}
+
+	if g.Response, marshalErr = marshalMessage(resp); marshalErr != nil {
+		return nil, marshalErr
+	}
+
+	b, marshalErr := json.MarshalIndent(g, "", "  ")
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+
+	return append(b, '\n'), nil
+}
+
+// marshalMessage protojson 的输出不稳定, 转换为 map 后按 key 排序输出.
+func marshalMessage(msg proto.Message) (json.RawMessage, error) {
+	if msg == nil || !msg.ProtoReflect().IsValid() {
+		return json.RawMessage("null"), nil
+	}
+
+	b, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if err = json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
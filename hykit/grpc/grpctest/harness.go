@@ -0,0 +1,210 @@
+package grpctest
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	egrpc "code.jshyjdtech.com/godev/hykit/grpc"
+	"code.jshyjdtech.com/godev/hykit/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Target bufconn 的地址, 只用于日志和 ServerName.
+const Target = "bufnet"
+
+// Harness 在 bufconn 上启动 grpc.Server, 服务端和客户端都使用完整的拦截器链, 测试不占用端口.
+// e.g.
+//
+//	harness := grpctest.NewHarness(harnessOpt.WithConf(app.Conf))
+//	harness.Start(func(s *ggrpc.Server) {
+//		pb.RegisterGreeterServer(s, &server{})
+//	})
+//	defer harness.Close()
+//
+//	conn, err := harness.Dial(ctx)
+//	reply, err := pb.NewGreeterClient(conn.Conn()).SayHello(ctx, req)
+//	grpctest.AssertGolden(t, "say_hello", req, reply, err)
+type Harness struct {
+	Server *egrpc.Server
+
+	// grpc.NewClient 是单例, 已经创建时 clientOptions 不生效, bufconn 通过 Dial 的 DialOption 连接
+	Client *egrpc.Client
+
+	conf config.Config
+
+	logger log.Logger
+
+	serverOptions []egrpc.ServerOption
+
+	clientOptions []egrpc.Option
+
+	bufSize int
+
+	lis *bufconn.Listener
+
+	mu sync.Mutex
+
+	conns []*egrpc.ClientConn
+
+	pools []*egrpc.Pool
+
+	closeOnce sync.Once
+}
+
+type Option func(*Harness)
+
+type HarnessOptions struct{}
+
+// NewHarness 没有 WithConf 时开启服务端和客户端所有的拦截器.
+func NewHarness(options ...Option) *Harness {
+	h := &Harness{}
+
+	for _, option := range options {
+		option(h)
+	}
+
+	if h.logger == nil {
+		h.logger = log.NewLogger()
+	}
+
+	if h.conf == nil {
+		h.conf = defaultConf()
+	}
+
+	if h.bufSize == 0 {
+		h.bufSize = 1 << 20
+	}
+
+	h.lis = bufconn.Listen(h.bufSize)
+
+	serverOpt := egrpc.ServerOptions{}
+	serverOptions := []egrpc.ServerOption{
+		serverOpt.WithServerConf(h.conf),
+		serverOpt.WithServerLogger(h.logger),
+		serverOpt.WithInsecure(),
+	}
+	h.Server = egrpc.NewServer(Target, append(serverOptions, h.serverOptions...)...)
+
+	clientOpt := egrpc.ClientOption{}
+	clientOptions := []egrpc.Option{
+		clientOpt.WithConf(h.conf),
+		clientOpt.WithLogger(h.logger),
+		clientOpt.WithInsecure(),
+	}
+	h.Client = egrpc.NewClient(append(clientOptions, h.clientOptions...)...)
+
+	return h
+}
+
+func defaultConf() config.Config {
+	memConfig := config.NewMemConfig()
+	memConfig.Set("debug", true)
+	memConfig.Set("grpc_server_trace", true)
+	memConfig.Set("grpc_server_metrics", true)
+	memConfig.Set("grpc_server_check_slow", true)
+	memConfig.Set("grpc_server_debug", true)
+	memConfig.Set("grpc_client_trace", true)
+	memConfig.Set("grpc_client_metrics", true)
+	memConfig.Set("grpc_client_check_slow", true)
+	memConfig.Set("grpc_client_debug", true)
+
+	return memConfig
+}
+
+func (HarnessOptions) WithConf(conf config.Config) Option {
+	return func(h *Harness) {
+		h.conf = conf
+	}
+}
+
+func (HarnessOptions) WithLogger(logger log.Logger) Option {
+	return func(h *Harness) {
+		h.logger = logger
+	}
+}
+
+// WithServerOptions 追加到默认的 conf、logger、insecure 之后.
+func (HarnessOptions) WithServerOptions(options ...egrpc.ServerOption) Option {
+	return func(h *Harness) {
+		h.serverOptions = append(h.serverOptions, options...)
+	}
+}
+
+// WithClientOptions 追加到默认的 conf、logger、insecure 之后, e.g. WithDialOptions 添加测试桩.
+func (HarnessOptions) WithClientOptions(options ...egrpc.Option) Option {
+	return func(h *Harness) {
+		h.clientOptions = append(h.clientOptions, options...)
+	}
+}
+
+// WithBufSize bufconn 的缓冲区大小, 默认 1MB.
+func (HarnessOptions) WithBufSize(size int) Option {
+	return func(h *Harness) {
+		h.bufSize = size
+	}
+}
+
+// Start 注册服务后在 bufconn 上启动.
+func (h *Harness) Start(register func(s *grpc.Server)) *Harness {
+	register(h.Server.Server)
+	h.Server.Serve(h.lis)
+
+	return h
+}
+
+// DialOption 通过 bufconn 建立连接.
+func (h *Harness) DialOption() grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return h.lis.DialContext(ctx)
+	})
+}
+
+// Dial 经过 Client 拦截器链的连接, Close 时关闭.
+func (h *Harness) Dial(ctx context.Context) (*egrpc.ClientConn, error) {
+	conn, err := h.Client.DialContext(ctx, Target, h.DialOption())
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.conns = append(h.conns, conn)
+	h.mu.Unlock()
+
+	return conn, nil
+}
+
+// Pool 连接池, 配置与 grpc_client_pools 中 servName 的配置相同, Close 时关闭.
+func (h *Harness) Pool(ctx context.Context, servName string) (*egrpc.Pool, error) {
+	p, err := h.Client.NewPool(ctx, servName, Target, h.DialOption())
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.pools = append(h.pools, p)
+	h.mu.Unlock()
+
+	return p, nil
+}
+
+// Close 关闭连接和服务.
+func (h *Harness) Close() {
+	h.closeOnce.Do(func() {
+		h.mu.Lock()
+		for _, conn := range h.conns {
+			conn.Close()
+		}
+		for _, p := range h.pools {
+			if err := p.Close(); err != nil {
+				h.logger.Errorf("close pool %s : %s", p.ServerName(), err.Error())
+			}
+		}
+		h.mu.Unlock()
+
+		h.Server.GracefulShutDown()
+		_ = h.lis.Close()
+	})
+}
@@ -0,0 +1,96 @@
+package grpctest
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"code.jshyjdtech.com/godev/hykit/errcode"
+	egrpc "code.jshyjdtech.com/godev/hykit/grpc"
+	tracerid "code.jshyjdtech.com/godev/hykit/pkg/tracer-id"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	pb "google.golang.org/grpc/examples/helloworld/helloworld"
+)
+
+type greeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (g *greeter) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+	if in.Name == "" {
+		return nil, errcode.InvalidParameter.WithMsg("name is empty")
+	}
+
+	// 服务端的 tracerID 拦截器
+	if tracerid.ExtractTracerID(ctx) == "" {
+		return nil, errcode.SystemErr
+	}
+
+	return &pb.HelloReply{Message: "Hello " + in.Name}, nil
+}
+
+func newHarness(t *testing.T, calls *int32) *Harness {
+	harnessOpt := HarnessOptions{}
+	serverOpt := egrpc.ServerOptions{}
+
+	harness := NewHarness(
+		harnessOpt.WithServerOptions(serverOpt.WithUnarySrvItcp(
+			errcode.UnaryServerInterceptor(),
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+				handler grpc.UnaryHandler) (interface{}, error) {
+				atomic.AddInt32(calls, 1)
+				return handler(ctx, req)
+			})),
+	).Start(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &greeter{})
+	})
+	t.Cleanup(harness.Close)
+
+	return harness
+}
+
+func TestHarness_Dial(t *testing.T) {
+	var calls int32
+	harness := newHarness(t, &calls)
+
+	ctx := context.Background()
+	conn, err := harness.Dial(ctx)
+	assert.Nil(t, err)
+
+	client := pb.NewGreeterClient(conn.Conn())
+
+	req := &pb.HelloRequest{Name: "esim"}
+	reply, err := client.SayHello(ctx, req)
+	AssertGolden(t, "say_hello", req, reply, err)
+
+	req = &pb.HelloRequest{}
+	reply, err = client.SayHello(ctx, req)
+	AssertGolden(t, "say_hello_invalid", req, reply, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestHarness_Pool(t *testing.T) {
+	var calls int32
+	harness := newHarness(t, &calls)
+
+	ctx := context.Background()
+	p, err := harness.Pool(ctx, "greeter")
+	assert.Nil(t, err)
+
+	conn, err := p.Get()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	reply, err := pb.NewGreeterClient(conn.Value()).SayHello(ctx, &pb.HelloRequest{Name: "pool"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello pool", reply.GetMessage())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestMarshalGolden(t *testing.T) {
+	b, err := marshalGolden(&pb.HelloRequest{Name: "esim"}, (*pb.HelloReply)(nil), nil)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"request":{"name":"esim"},"response":null}`, string(b))
+}
@@ -0,0 +1,126 @@
+package grpc
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Pinger e.g. redis.Client.
+type Pinger interface {
+	Ping() error
+}
+
+// MultiPinger e.g. mysql.Client, mongodb.Client.
+type MultiPinger interface {
+	Ping() []error
+}
+
+type healthCheck struct {
+	// 为空时影响全部服务
+	service string
+
+	name string
+
+	check func() []error
+}
+
+// healthChecker 定时检查依赖, 更新 grpc.health.v1 中每个服务的状态,
+// 服务的依赖不可用时该服务 NOT_SERVING, 任一服务不可用时整体("") NOT_SERVING.
+type healthChecker struct {
+	server *health.Server
+
+	checks []healthCheck
+
+	interval time.Duration
+
+	logger log.Logger
+
+	cancel context.CancelFunc
+
+	wg sync.WaitGroup
+}
+
+func newHealthChecker() *healthChecker {
+	return &healthChecker{server: health.NewServer()}
+}
+
+func (hc *healthChecker) register(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, hc.server)
+}
+
+func (hc *healthChecker) start(services []string) {
+	hc.update(services)
+
+	if len(hc.checks) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hc.cancel = cancel
+
+	hc.wg.Add(1)
+	go func() {
+		defer hc.wg.Done()
+
+		ticker := time.NewTicker(hc.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				hc.update(services)
+			}
+		}
+	}()
+}
+
+func (hc *healthChecker) update(services []string) {
+	failed := make(map[string]bool)
+	for _, check := range hc.checks {
+		errs := check.check()
+		if len(errs) == 0 {
+			continue
+		}
+
+		failed[check.service] = true
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		hc.logger.Warnf("Grpc health %s %s : %s", check.service, check.name, strings.Join(msgs, "; "))
+	}
+
+	overall := healthpb.HealthCheckResponse_SERVING
+	for _, service := range services {
+		status := healthpb.HealthCheckResponse_SERVING
+		if failed[""] || failed[service] {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			overall = status
+		}
+		hc.server.SetServingStatus(service, status)
+	}
+
+	if failed[""] {
+		overall = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	hc.server.SetServingStatus("", overall)
+}
+
+// shutdown 全部服务 NOT_SERVING, 之后不再更新.
+func (hc *healthChecker) shutdown() {
+	hc.server.Shutdown()
+
+	if hc.cancel != nil {
+		hc.cancel()
+		hc.wg.Wait()
+	}
+}
@@ -0,0 +1,80 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	pb "google.golang.org/grpc/examples/helloworld/helloworld"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type fakePinger struct {
+	fail int32
+}
+
+func (fp *fakePinger) Ping() error {
+	if atomic.LoadInt32(&fp.fail) == 1 {
+		return errors.New("connection refused")
+	}
+
+	return nil
+}
+
+func TestServerHealth(t *testing.T) {
+	memConfig := newMemConfig()
+	memConfig.Set("grpc_server_health_interval", 10)
+	memConfig.Set("grpc_server_disable_reflection", true)
+
+	bank := &fakePinger{}
+	serverOptions := ServerOptions{}
+	svr := NewServer("127.0.0.1:0",
+		serverOptions.WithServerLogger(logger),
+		serverOptions.WithServerConf(memConfig),
+		serverOptions.WithPinger("helloworld.Greeter", "bank", bank))
+	pb.RegisterGreeterServer(svr.Server, &server{})
+	svr.Start()
+	defer svr.GracefulShutDown()
+
+	_, ok := svr.Server.GetServiceInfo()["grpc.reflection.v1alpha.ServerReflection"]
+	assert.False(t, ok)
+
+	conn, err := grpc.Dial(svr.Addr(), grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer conn.Close()
+	c := healthpb.NewHealthClient(conn)
+
+	status := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		resp, err := c.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return healthpb.HealthCheckResponse_UNKNOWN
+		}
+		return resp.Status
+	}
+
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, status(""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, status("helloworld.Greeter"))
+
+	atomic.StoreInt32(&bank.fail, 1)
+	assert.Eventually(t, func() bool {
+		return status("helloworld.Greeter") == healthpb.HealthCheckResponse_NOT_SERVING &&
+			status("") == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 10*time.Millisecond)
+
+	atomic.StoreInt32(&bank.fail, 0)
+	assert.Eventually(t, func() bool {
+		return status("") == healthpb.HealthCheckResponse_SERVING
+	}, time.Second, 10*time.Millisecond)
+
+	// 关闭时先 NOT_SERVING
+	svr.health.shutdown()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(""))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status("helloworld.Greeter"))
+}
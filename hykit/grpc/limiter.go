@@ -0,0 +1,64 @@
+package grpc
+
+import (
+	"code.jshyjdtech.com/godev/hykit/config"
+	"code.jshyjdtech.com/godev/hykit/grpc/limiter"
+	"code.jshyjdtech.com/godev/hykit/log"
+)
+
+// MethodLimit 方法固定的最大并发, 通过 grpc_server_method_limits 或 grpc_client_method_limits 配置.
+type MethodLimit struct {
+	Method string `json:"method" yaml:"method"`
+
+	Limit int `json:"limit" yaml:"limit"`
+}
+
+// limiterFromConf 读取 <prefix>_limiter: vegas | fixed, 为空时不限制并发,
+// <prefix>_max_inflight 为 fixed 的并发或 vegas 的最大并发, 也是流式方法固定的并发.
+func limiterFromConf(conf config.Config, logger log.Logger, prefix, name string) *limiter.Interceptor {
+	kind := conf.GetString(prefix + "_limiter")
+	if kind == "" {
+		return nil
+	}
+
+	maxInflight := conf.GetInt(prefix + "_max_inflight")
+	if maxInflight == 0 {
+		maxInflight = 1000
+	}
+
+	initInflight := conf.GetInt(prefix + "_init_inflight")
+	if initInflight == 0 {
+		initInflight = 20
+	}
+
+	limiterOpt := limiter.LimiterOptions{}
+	options := []limiter.Option{
+		limiterOpt.WithName(name),
+		limiterOpt.WithLogger(logger),
+		limiterOpt.WithStreamLimit(maxInflight),
+	}
+
+	switch kind {
+	case "fixed":
+		options = append(options, limiterOpt.WithLimiter(func(string) limiter.Limiter {
+			return limiter.NewFixedLimiter(maxInflight)
+		}))
+	case "vegas":
+		options = append(options, limiterOpt.WithLimiter(func(string) limiter.Limiter {
+			return limiter.NewVegasLimiter(initInflight, maxInflight)
+		}))
+	default:
+		logger.Errorf("%s_limiter %s not supported, use vegas or fixed", prefix, kind)
+		return nil
+	}
+
+	var methodLimits []MethodLimit
+	if err := conf.UnmarshalKey(prefix+"_method_limits", &methodLimits); err != nil {
+		logger.Errorf("%s_method_limits : %s", prefix, err.Error())
+	}
+	for _, ml := range methodLimits {
+		options = append(options, limiterOpt.WithMethodLimit(ml.Method, ml.Limit))
+	}
+
+	return limiter.NewInterceptor(options...)
+}
@@ -0,0 +1,231 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Interceptor 按方法限制并发, 超过限制时直接返回 codes.ResourceExhausted, 避免 goroutine 堆积.
+type Interceptor struct {
+	name string
+
+	logger log.Logger
+
+	// 没有单独配置的方法使用的限制
+	newLimiter func(method string) Limiter
+
+	methodLimits map[string]int
+
+	// 流式方法的耗时是整个流的生命周期, 不能作为 vegas 的延迟, 使用固定的并发
+	streamLimit int
+
+	limiters sync.Map
+}
+
+type Option func(*Interceptor)
+
+type LimiterOptions struct{}
+
+// methodLimiter 带 metrics 的 Limiter.
+type methodLimiter struct {
+	Limiter
+
+	limit prometheus.Gauge
+
+	inflight prometheus.Gauge
+}
+
+// NewInterceptor 默认每个方法使用 NewVegasLimiter(20, 1000), 流式方法使用 NewFixedLimiter(1000).
+func NewInterceptor(options ...Option) *Interceptor {
+	in := &Interceptor{methodLimits: make(map[string]int)}
+
+	for _, option := range options {
+		option(in)
+	}
+
+	if in.name == "" {
+		in.name = "grpc"
+	}
+
+	if in.logger == nil {
+		in.logger = log.NewLogger()
+	}
+
+	if in.streamLimit == 0 {
+		in.streamLimit = 1000
+	}
+
+	if in.newLimiter == nil {
+		in.newLimiter = func(string) Limiter {
+			return NewVegasLimiter(20, 1000)
+		}
+	}
+
+	return in
+}
+
+// WithName metrics 的 name 标签, 区分服务端和客户端.
+func (LimiterOptions) WithName(name string) Option {
+	return func(in *Interceptor) {
+		in.name = name
+	}
+}
+
+func (LimiterOptions) WithLogger(logger log.Logger) Option {
+	return func(in *Interceptor) {
+		in.logger = logger
+	}
+}
+
+// WithLimiter 每个方法创建一个 Limiter.
+func (LimiterOptions) WithLimiter(newLimiter func(method string) Limiter) Option {
+	return func(in *Interceptor) {
+		in.newLimiter = newLimiter
+	}
+}
+
+// WithMethodLimit 方法的最大并发, 使用 NewFixedLimiter.
+func (LimiterOptions) WithMethodLimit(method string, limit int) Option {
+	return func(in *Interceptor) {
+		in.methodLimits[method] = limit
+	}
+}
+
+// WithStreamLimit 流式方法的最大并发, 使用 NewFixedLimiter.
+func (LimiterOptions) WithStreamLimit(limit int) Option {
+	return func(in *Interceptor) {
+		in.streamLimit = limit
+	}
+}
+
+func (in *Interceptor) limiter(method string, stream bool) *methodLimiter {
+	if v, ok := in.limiters.Load(method); ok {
+		return v.(*methodLimiter)
+	}
+
+	var l Limiter
+	if limit, ok := in.methodLimits[method]; ok {
+		l = NewFixedLimiter(limit)
+	} else if stream {
+		l = NewFixedLimiter(in.streamLimit)
+	} else {
+		l = in.newLimiter(method)
+	}
+
+	ml := &methodLimiter{
+		Limiter:  l,
+		limit:    limiterLimit.WithLabelValues(in.name, method),
+		inflight: limiterInflight.WithLabelValues(in.name, method),
+	}
+	v, _ := in.limiters.LoadOrStore(method, ml)
+
+	return v.(*methodLimiter)
+}
+
+// acquire 被拒绝时返回 codes.ResourceExhausted.
+func (in *Interceptor) acquire(ctx context.Context, method string, stream bool,
+	priority Priority) (func(error), error) {
+	ml := in.limiter(method, stream)
+
+	release, ok := ml.Acquire(priority)
+	ml.limit.Set(float64(ml.Limit()))
+	ml.inflight.Set(float64(ml.Inflight()))
+	if !ok {
+		limiterRejected.WithLabelValues(in.name, method, priority.String()).Inc()
+		in.logger.Warnc(ctx, "%s limit exceeded, limit %d, priority %s", method, ml.Limit(), priority)
+		return nil, status.Errorf(codes.ResourceExhausted, "%s limit exceeded", method)
+	}
+
+	return func(err error) {
+		release(dropped(err))
+		ml.limit.Set(float64(ml.Limit()))
+		ml.inflight.Set(float64(ml.Inflight()))
+	}, nil
+}
+
+// dropped 超时和过载的错误用于减小自适应的并发.
+func dropped(err error) bool {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.ResourceExhausted, codes.Unavailable:
+		return true
+	}
+
+	return false
+}
+
+func priorityFromMD(md metadata.MD) (Priority, bool) {
+	if values := md.Get(PriorityKey); len(values) > 0 {
+		return ParsePriority(values[0]), true
+	}
+
+	return PriorityNormal, false
+}
+
+func incomingPriority(ctx context.Context) Priority {
+	md, _ := metadata.FromIncomingContext(ctx)
+	p, _ := priorityFromMD(md)
+	return p
+}
+
+// outgoingPriority 优先使用 WithPriority 设置的优先级, 其次使用上游传入的优先级.
+func outgoingPriority(ctx context.Context) (context.Context, Priority) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if p, ok := priorityFromMD(md); ok {
+		return ctx, p
+	}
+
+	md, _ = metadata.FromIncomingContext(ctx)
+	if p, ok := priorityFromMD(md); ok {
+		return WithPriority(ctx, p), p
+	}
+
+	return ctx, PriorityNormal
+}
+
+func (in *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		done, err := in.acquire(ctx, info.FullMethod, false, incomingPriority(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer func() { done(err) }()
+
+		return handler(ctx, req)
+	}
+}
+
+func (in *Interceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		done, err := in.acquire(ss.Context(), info.FullMethod, true, incomingPriority(ss.Context()))
+		if err != nil {
+			return err
+		}
+		defer func() { done(err) }()
+
+		return handler(srv, ss)
+	}
+}
+
+// UnaryClientInterceptor 下游变慢时限制调用方的并发, 上游传入的优先级继续传给下游.
+func (in *Interceptor) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		ctx, priority := outgoingPriority(ctx)
+		done, err := in.acquire(ctx, method, false, priority)
+		if err != nil {
+			return err
+		}
+		defer func() { done(err) }()
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,246 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// PriorityKey 请求优先级的 metadata key.
+const PriorityKey = "x-priority"
+
+// Priority 请求优先级, 优先级越低可使用的并发越少, 过载时先被拒绝.
+type Priority int
+
+const (
+	PriorityCritical Priority = iota
+	PriorityHigh
+	PriorityNormal
+	PriorityLow
+)
+
+// shares 各优先级可使用的并发比例.
+var shares = map[Priority]float64{
+	PriorityCritical: 1,
+	PriorityHigh:     0.9,
+	PriorityNormal:   0.8,
+	PriorityLow:      0.5,
+}
+
+var priorityNames = []string{"critical", "high", "normal", "low"}
+
+func (p Priority) String() string {
+	if p >= PriorityCritical && p <= PriorityLow {
+		return priorityNames[p]
+	}
+
+	return strconv.Itoa(int(p))
+}
+
+// ParsePriority 支持 critical、high、normal、low 或数字, 无法解析时为 PriorityNormal.
+func ParsePriority(s string) Priority {
+	for i, name := range priorityNames {
+		if strings.EqualFold(name, s) {
+			return Priority(i)
+		}
+	}
+
+	if i, err := strconv.Atoi(s); err == nil && i >= int(PriorityCritical) && i <= int(PriorityLow) {
+		return Priority(i)
+	}
+
+	return PriorityNormal
+}
+
+// WithPriority 设置调用下游的优先级.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, PriorityKey, p.String())
+}
+
+// Limiter 并发限制.
+type Limiter interface {
+	// Acquire 超过优先级可用的并发时返回 false, 成功时请求结束后调用 release,
+	// dropped 表示下游过载(超时、拒绝等)
+	Acquire(priority Priority) (release func(dropped bool), ok bool)
+
+	Limit() int
+
+	Inflight() int
+}
+
+// available 优先级可使用的并发, 至少为 1.
+func available(limit int, priority Priority) int {
+	share, ok := shares[priority]
+	if !ok {
+		share = shares[PriorityNormal]
+	}
+
+	n := int(math.Ceil(float64(limit) * share))
+	if n < 1 {
+		n = 1
+	}
+
+	return n
+}
+
+type fixedLimiter struct {
+	mu sync.Mutex
+
+	limit int
+
+	inflight int
+}
+
+// NewFixedLimiter 固定的最大并发.
+func NewFixedLimiter(limit int) Limiter {
+	return &fixedLimiter{limit: limit}
+}
+
+func (l *fixedLimiter) Acquire(priority Priority) (func(bool), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight >= available(l.limit, priority) {
+		return nil, false
+	}
+	l.inflight++
+
+	return func(bool) {
+		l.mu.Lock()
+		l.inflight--
+		l.mu.Unlock()
+	}, true
+}
+
+func (l *fixedLimiter) Limit() int {
+	return l.limit
+}
+
+func (l *fixedLimiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// vegasLimiter 参考 TCP Vegas, 根据延迟估算排队的请求数调整并发:
+// queue = limit * (1 - rttNoLoad / rtt), 排队少时增加, 排队多或下游过载时减少.
+type vegasLimiter struct {
+	mu sync.Mutex
+
+	limit float64
+
+	minLimit float64
+
+	maxLimit float64
+
+	inflight int
+
+	// 没有排队时的延迟, 每 probeInterval 个样本重新探测
+	rttNoLoad time.Duration
+
+	samples int
+
+	probeInterval int
+
+	smoothing float64
+}
+
+// NewVegasLimiter 自适应并发, limit 从 initLimit 开始在 [1, maxLimit] 之间调整.
+func NewVegasLimiter(initLimit, maxLimit int) Limiter {
+	if maxLimit < 1 {
+		maxLimit = 1
+	}
+
+	if initLimit < 1 || initLimit > maxLimit {
+		initLimit = maxLimit
+	}
+
+	return &vegasLimiter{
+		limit:         float64(initLimit),
+		minLimit:      1,
+		maxLimit:      float64(maxLimit),
+		probeInterval: 1000,
+		smoothing:     1,
+	}
+}
+
+func (l *vegasLimiter) Acquire(priority Priority) (func(bool), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight >= available(int(l.limit), priority) {
+		return nil, false
+	}
+	l.inflight++
+	inflight := l.inflight
+
+	start := time.Now()
+	return func(dropped bool) {
+		l.release(time.Since(start), inflight, dropped)
+	}, true
+}
+
+func (l *vegasLimiter) release(rtt time.Duration, inflight int, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+
+	if rtt <= 0 {
+		return
+	}
+
+	l.samples++
+	if l.samples >= l.probeInterval {
+		l.samples = 0
+		l.rttNoLoad = 0
+	}
+
+	if l.rttNoLoad == 0 || rtt < l.rttNoLoad {
+		l.rttNoLoad = rtt
+		return
+	}
+
+	step := math.Max(1, math.Log10(l.limit))
+	newLimit := l.limit
+
+	switch {
+	case dropped:
+		newLimit = l.limit - step
+	case float64(inflight)*2 < l.limit:
+		// 并发没有用满时延迟不能反映下游的负载
+		return
+	default:
+		queue := l.limit * (1 - float64(l.rttNoLoad)/float64(rtt))
+		alpha, beta := 3*step, 6*step
+
+		switch {
+		case queue <= step:
+			newLimit = l.limit + beta
+		case queue < alpha:
+			newLimit = l.limit + step
+		case queue > beta:
+			newLimit = l.limit - step
+		}
+	}
+
+	newLimit = math.Max(l.minLimit, math.Min(l.maxLimit, newLimit))
+	l.limit = (1-l.smoothing)*l.limit + l.smoothing*newLimit
+}
+
+func (l *vegasLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *vegasLimiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
@@ -0,0 +1,202 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var logger = log.NewLogger()
+
+func TestParsePriority(t *testing.T) {
+	assert.Equal(t, PriorityCritical, ParsePriority("critical"))
+	assert.Equal(t, PriorityLow, ParsePriority("LOW"))
+	assert.Equal(t, PriorityHigh, ParsePriority("1"))
+	assert.Equal(t, PriorityNormal, ParsePriority("9"))
+	assert.Equal(t, PriorityNormal, ParsePriority(""))
+	assert.Equal(t, "high", PriorityHigh.String())
+}
+
+func TestFixedLimiter_Priority(t *testing.T) {
+	l := NewFixedLimiter(10)
+
+	releases := make([]func(bool), 0)
+	acquire := func(p Priority) bool {
+		release, ok := l.Acquire(p)
+		if ok {
+			releases = append(releases, release)
+		}
+		return ok
+	}
+
+	// low 只能使用 50%
+	for i := 0; i < 5; i++ {
+		assert.True(t, acquire(PriorityLow))
+	}
+	assert.False(t, acquire(PriorityLow))
+
+	// normal 80%, high 90%, critical 100%
+	for i := 0; i < 3; i++ {
+		assert.True(t, acquire(PriorityNormal))
+	}
+	assert.False(t, acquire(PriorityNormal))
+	assert.True(t, acquire(PriorityHigh))
+	assert.False(t, acquire(PriorityHigh))
+	assert.True(t, acquire(PriorityCritical))
+	assert.False(t, acquire(PriorityCritical))
+	assert.Equal(t, 10, l.Inflight())
+
+	for _, release := range releases {
+		release(false)
+	}
+	assert.Equal(t, 0, l.Inflight())
+}
+
+func TestVegasLimiter(t *testing.T) {
+	l := NewVegasLimiter(10, 50).(*vegasLimiter)
+
+	// 第一个样本作为没有排队时的延迟
+	l.inflight = 1
+	l.release(10*time.Millisecond, 10, false)
+	assert.Equal(t, 10*time.Millisecond, l.rttNoLoad)
+
+	// 延迟没有增加, 增加并发
+	for i := 0; i < 10; i++ {
+		l.inflight = 1
+		l.release(10*time.Millisecond, l.Limit(), false)
+	}
+	assert.Equal(t, 50, l.Limit())
+
+	// 延迟增加一倍, 排队严重, 减少并发
+	for i := 0; i < 5; i++ {
+		l.inflight = 1
+		l.release(20*time.Millisecond, l.Limit(), false)
+	}
+	assert.True(t, l.Limit() < 50)
+
+	// 并发没有用满时不调整
+	limit := l.Limit()
+	l.inflight = 1
+	l.release(100*time.Millisecond, 1, false)
+	assert.Equal(t, limit, l.Limit())
+
+	// 下游过载
+	l.inflight = 1
+	l.release(100*time.Millisecond, 1, true)
+	assert.True(t, l.Limit() < limit)
+
+	for i := 0; i < 100; i++ {
+		l.inflight = 1
+		l.release(100*time.Millisecond, 1, true)
+	}
+	assert.Equal(t, 1, l.Limit())
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	limiterOpt := LimiterOptions{}
+	in := NewInterceptor(
+		limiterOpt.WithName("test_server"),
+		limiterOpt.WithLogger(logger),
+		limiterOpt.WithMethodLimit("/pay.Pay/Query", 2))
+	interceptor := in.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/pay.Pay/Query"}
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		started <- struct{}{}
+		<-finish
+		return "ok", nil
+	}
+
+	// critical 可以使用全部并发
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(PriorityKey, "critical"))
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := interceptor(ctx, nil, info, handler)
+			done <- err
+		}()
+		<-started
+	}
+
+	_, err := interceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(limiterRejected.WithLabelValues("test_server", "/pay.Pay/Query", "critical")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(limiterInflight.WithLabelValues("test_server", "/pay.Pay/Query")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(limiterLimit.WithLabelValues("test_server", "/pay.Pay/Query")))
+
+	close(finish)
+	assert.Nil(t, <-done)
+	assert.Nil(t, <-done)
+	assert.Equal(t, float64(0), testutil.ToFloat64(limiterInflight.WithLabelValues("test_server", "/pay.Pay/Query")))
+
+	// 其他方法使用自适应的限制
+	resp, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/pay.Pay/Pay"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "ok", nil
+		})
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", resp)
+	assert.IsType(t, &vegasLimiter{}, in.limiter("/pay.Pay/Pay", false).Limiter)
+}
+
+func TestUnaryClientInterceptor_Priority(t *testing.T) {
+	in := NewInterceptor(LimiterOptions{}.WithLimiter(func(string) Limiter {
+		return NewFixedLimiter(1)
+	}))
+	interceptor := in.UnaryClientInterceptor()
+
+	var outgoing []string
+	invoker := func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		outgoing = md.Get(PriorityKey)
+		return nil
+	}
+
+	// 上游的优先级传给下游
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(PriorityKey, "high"))
+	assert.Nil(t, interceptor(ctx, "/pay.Pay/Query", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"high"}, outgoing)
+
+	assert.Nil(t, interceptor(WithPriority(ctx, PriorityLow), "/pay.Pay/Query", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"low"}, outgoing)
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+}
+
+func (testServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	limiterOpt := LimiterOptions{}
+	in := NewInterceptor(
+		limiterOpt.WithName("test_stream"),
+		limiterOpt.WithLogger(logger),
+		limiterOpt.WithStreamLimit(1))
+	interceptor := in.StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/pay.Pay/Watch", IsServerStream: true}
+
+	// 流的生命周期不作为 vegas 的延迟, 使用固定的并发
+	err := interceptor(nil, testServerStream{}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		return interceptor(srv, ss, info, func(interface{}, grpc.ServerStream) error {
+			return nil
+		})
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.IsType(t, &fixedLimiter{}, in.limiter("/pay.Pay/Watch", true).Limiter)
+	assert.Equal(t, 0, in.limiter("/pay.Pay/Watch", true).Inflight())
+}
@@ -0,0 +1,35 @@
+package limiter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var limiterLimit = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "grpc_limiter_limit",
+		Help: "Current concurrency limit",
+	},
+	[]string{"name", "method"},
+)
+
+var limiterInflight = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "grpc_limiter_inflight",
+		Help: "Number of inflight requests",
+	},
+	[]string{"name", "method"},
+)
+
+var limiterRejected = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "grpc_limiter_rejected_total",
+		Help: "Number of requests rejected by limiter",
+	},
+	[]string{"name", "method", "priority"},
+)
+
+func init() {
+	prometheus.MustRegister(limiterLimit)
+	prometheus.MustRegister(limiterInflight)
+	prometheus.MustRegister(limiterRejected)
+}
@@ -0,0 +1,37 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLimiterFromConf(t *testing.T) {
+	memConfig := newMemConfig()
+	assert.Nil(t, limiterFromConf(memConfig, logger, "grpc_server", "server"))
+
+	memConfig.Set("grpc_server_limiter", "unknown")
+	assert.Nil(t, limiterFromConf(memConfig, logger, "grpc_server", "server"))
+
+	memConfig.Set("grpc_server_limiter", "fixed")
+	memConfig.Set("grpc_server_max_inflight", 1)
+	lim := limiterFromConf(memConfig, logger, "grpc_server", "test_conf")
+	assert.NotNil(t, lim)
+
+	interceptor := lim.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}
+
+	_, err := interceptor(context.Background(), nil, info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			// 并发已满
+			_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			return nil, err
+		})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
@@ -0,0 +1,28 @@
+package grpc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// grpc_client_retries_total, 重试的次数, code 为触发重试的错误码.
+var clientRetries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "grpc_client_retries_total",
+		Help: "Number of retried grpc client calls",
+	},
+	[]string{"method", "code"},
+)
+
+// grpc_client_hedges_total, 对冲请求额外发出的次数.
+var clientHedges = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "grpc_client_hedges_total",
+		Help: "Number of hedged grpc client calls",
+	},
+	[]string{"method"},
+)
+
+func init() {
+	prometheus.MustRegister(clientRetries)
+	prometheus.MustRegister(clientHedges)
+}
@@ -0,0 +1,116 @@
+package pool
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var poolRefs = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "grpc_pool_refs",
+		Help: "Number of logic connections in use",
+	},
+	[]string{"pool"},
+)
+
+var poolActive = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "grpc_pool_active",
+		Help: "Number of physical connections in the pool",
+	},
+	[]string{"pool"},
+)
+
+// grpc_pool_idle, physical connections without logic connections in use.
+var poolIdle = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "grpc_pool_idle",
+		Help: "Number of idle physical connections in the pool",
+	},
+	[]string{"pool"},
+)
+
+var poolOnceConns = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "grpc_pool_once_conns_total",
+		Help: "Number of one-time connections created when the pool is at MaxActive",
+	},
+	[]string{"pool"},
+)
+
+var poolEvicted = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "grpc_pool_evicted_total",
+		Help: "Number of connections evicted by health check",
+	},
+	[]string{"pool", "state"},
+)
+
+var (
+	metricsMu sync.Mutex
+
+	// pools with the same name share the series, e.g. the old and new pool of UpdateServerPool,
+	// the series are deleted when the last one is closed.
+	metricsRefs = make(map[string]int)
+)
+
+func init() {
+	prometheus.MustRegister(poolRefs)
+	prometheus.MustRegister(poolActive)
+	prometheus.MustRegister(poolIdle)
+	prometheus.MustRegister(poolOnceConns)
+	prometheus.MustRegister(poolEvicted)
+}
+
+// updateMetrics updates the gauges after ref or current changed.
+func (p *pool) updateMetrics() {
+	if atomic.LoadInt32(&p.closed) == 1 || p.refsGauge == nil {
+		return
+	}
+
+	ref := atomic.LoadInt32(&p.ref)
+	current := atomic.LoadInt32(&p.current)
+
+	streams := int32(p.opt.MaxConcurrentStreams)
+	idle := current - (ref+streams-1)/streams
+	if idle < 0 {
+		idle = 0
+	}
+
+	p.refsGauge.Set(float64(ref))
+	p.activeGauge.Set(float64(current))
+	p.idleGauge.Set(float64(idle))
+}
+
+func (p *pool) initMetrics() {
+	metricsMu.Lock()
+	metricsRefs[p.name]++
+	metricsMu.Unlock()
+
+	p.refsGauge = poolRefs.WithLabelValues(p.name)
+	p.activeGauge = poolActive.WithLabelValues(p.name)
+	p.idleGauge = poolIdle.WithLabelValues(p.name)
+	p.updateMetrics()
+}
+
+func (p *pool) deleteMetrics() {
+	// closed before initMetrics, e.g. dial failed in New
+	if p.refsGauge == nil {
+		return
+	}
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	metricsRefs[p.name]--
+	if metricsRefs[p.name] > 0 {
+		return
+	}
+	delete(metricsRefs, p.name)
+
+	poolRefs.DeleteLabelValues(p.name)
+	poolActive.DeleteLabelValues(p.name)
+	poolIdle.DeleteLabelValues(p.name)
+}
@@ -48,11 +48,14 @@ const (
 
 	// MaxSendMsgSize set max gRPC request message size sent to server.
 	// If any request message size is larger than current value, an error will be reported from gRPC.
-	MaxSendMsgSize = 4 << 30
+	MaxSendMsgSize = 16 << 20
 
 	// MaxRecvMsgSize set max gRPC receive message size received from server.
 	// If any message size is larger than current value, an error will be reported from gRPC.
-	MaxRecvMsgSize = 4 << 30
+	MaxRecvMsgSize = 16 << 20
+
+	// HealthCheckInterval is the default interval of checking the connectivity state of connections.
+	HealthCheckInterval = 5 * time.Second
 )
 
 // Options are params for creating grpc connect pool.
@@ -74,6 +77,14 @@ type Options struct {
 	// the connection to return, If Reuse is false and the pool is at the MaxActive limit,
 	// create a one-time connection to return.
 	Reuse bool
+
+	// Name is the label of pool metrics, the address is used when empty.
+	Name string
+
+	// HealthCheckInterval is the interval of checking the connectivity state of connections,
+	// connections in TRANSIENT_FAILURE or SHUTDOWN are closed and redialed.
+	// When zero, health check is disabled.
+	HealthCheckInterval time.Duration
 }
 
 // DefaultOptions sets a list of recommended options for good performance.
@@ -84,6 +95,7 @@ var DefaultOptions = Options{
 	MaxActive:            64,
 	MaxConcurrentStreams: 64,
 	Reuse:                true,
+	HealthCheckInterval:  HealthCheckInterval,
 }
 
 // Dial return a grpc connection with defined configurations.
@@ -7,6 +7,11 @@ import (
 	"math"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 // ErrClosed is the error resulting if the pool is closed via pool.Close().
@@ -49,6 +54,20 @@ type pool struct {
 	// the server address is to create connection.
 	address string
 
+	// the label of metrics.
+	name string
+
+	refsGauge   prometheus.Gauge
+	activeGauge prometheus.Gauge
+	idleGauge   prometheus.Gauge
+
+	// stop the health check.
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// atomic, 1 after Close, Close() of connections in use only returns.
+	closed int32
+
 	// control the atomic var current's concurrent read write.
 	sync.RWMutex
 }
@@ -75,6 +94,11 @@ func New(address string, option Options) (Pool, error) {
 		opt:     option,
 		conns:   make([]*conn, option.MaxActive),
 		address: address,
+		name:    option.Name,
+		done:    make(chan struct{}),
+	}
+	if p.name == "" {
+		p.name = address
 	}
 
 	for i := 0; i < p.opt.MaxIdle; i++ {
@@ -85,6 +109,10 @@ func New(address string, option Options) (Pool, error) {
 		}
 		p.conns[i] = p.wrapConn(c, false)
 	}
+	p.initMetrics()
+	if p.opt.HealthCheckInterval > 0 {
+		go p.healthCheck()
+	}
 	log.Printf("new pool success: %v\n", p.Status())
 
 	return p, nil
@@ -95,10 +123,14 @@ func (p *pool) incrRef() int32 {
 	if newRef == math.MaxInt32 {
 		panic(fmt.Sprintf("overflow ref: %d", newRef))
 	}
+	p.updateMetrics()
 	return newRef
 }
 
 func (p *pool) decrRef() {
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return
+	}
 	newRef := atomic.AddInt32(&p.ref, -1)
 	if newRef < 0 {
 		panic(fmt.Sprintf("negative ref: %d", newRef))
@@ -113,6 +145,7 @@ func (p *pool) decrRef() {
 		}
 		p.Unlock()
 	}
+	p.updateMetrics()
 }
 
 func (p *pool) reset(index int) {
@@ -141,18 +174,17 @@ func (p *pool) Get() (Conn, error) {
 		return nil, ErrClosed
 	}
 	if nextRef <= current*int32(p.opt.MaxConcurrentStreams) {
-		next := atomic.AddUint32(&p.index, 1) % uint32(current)
-		return p.conns[next], nil
+		return p.pick(current), nil
 	}
 
 	// the number connection of pool is reach to max active
 	if current == int32(p.opt.MaxActive) {
 		// the second if reuse is true, select from pool's connections
 		if p.opt.Reuse {
-			next := atomic.AddUint32(&p.index, 1) % uint32(current)
-			return p.conns[next], nil
+			return p.pick(current), nil
 		}
 		// the third create one-time connection
+		poolOnceConns.WithLabelValues(p.name).Inc()
 		c, err := p.opt.Dial(p.address)
 		return p.wrapConn(c, true), err
 	}
@@ -181,23 +213,115 @@ func (p *pool) Get() (Conn, error) {
 		log.Printf("grow pool: %d ---> %d, increment: %d, maxActive: %d\n",
 			p.current, current, increment, p.opt.MaxActive)
 		atomic.StoreInt32(&p.current, current)
+		p.updateMetrics()
 		if err != nil {
 			p.Unlock()
 			return nil, err
 		}
 	}
 	p.Unlock()
-	next := atomic.AddUint32(&p.index, 1) % uint32(current)
-	return p.conns[next], nil
+	return p.pick(current), nil
+}
+
+// pick selects a connection in rotation, connections in TRANSIENT_FAILURE or SHUTDOWN
+// are skipped unless all of them are unhealthy.
+func (p *pool) pick(current int32) *conn {
+	p.RLock()
+	defer p.RUnlock()
+
+	next := atomic.AddUint32(&p.index, 1)
+	for i := uint32(0); i < uint32(current); i++ {
+		c := p.conns[(next+i)%uint32(current)]
+		if c != nil && c.cc != nil && !unhealthy(c.cc.GetState()) {
+			return c
+		}
+	}
+	return p.conns[next%uint32(current)]
+}
+
+func unhealthy(state connectivity.State) bool {
+	return state == connectivity.TransientFailure || state == connectivity.Shutdown
+}
+
+// healthCheck evicts and redials unhealthy connections every HealthCheckInterval.
+func (p *pool) healthCheck() {
+	ticker := time.NewTicker(p.opt.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.evict()
+		}
+	}
+}
+
+func (p *pool) evict() {
+	current := int(atomic.LoadInt32(&p.current))
+	for i := 0; i < current; i++ {
+		p.RLock()
+		c := p.conns[i]
+		var old *grpc.ClientConn
+		if c != nil {
+			old = c.cc
+		}
+		p.RUnlock()
+		if old == nil {
+			continue
+		}
+
+		state := old.GetState()
+		if !unhealthy(state) {
+			continue
+		}
+
+		newCC, err := p.opt.Dial(p.address)
+		if err != nil {
+			log.Printf("redial %s failed: %s\n", p.address, err)
+			continue
+		}
+
+		p.Lock()
+		// the pool is shrunk or closed while dialing
+		if i >= int(atomic.LoadInt32(&p.current)) || p.conns[i] != c {
+			p.Unlock()
+			newCC.Close()
+			continue
+		}
+		// the evicted wrapper keeps the pool, Close() of its holders still decreases the ref
+		p.conns[i] = p.wrapConn(newCC, false)
+		p.Unlock()
+
+		old.Close()
+		poolEvicted.WithLabelValues(p.name, state.String()).Inc()
+		log.Printf("evict conn %d of pool %s in state %s\n", i, p.name, state)
+	}
 }
 
 // Close see Pool interface.
+// The connections in use are closed too, their Close() is still safe to call.
 func (p *pool) Close() error {
-	atomic.StoreUint32(&p.index, 0)
-	atomic.StoreInt32(&p.current, 0)
-	atomic.StoreInt32(&p.ref, 0)
-	p.deleteFrom(0)
-	log.Printf("close pool success: %v\n", p.Status())
+	p.closeOnce.Do(func() {
+		atomic.StoreInt32(&p.closed, 1)
+		close(p.done)
+
+		atomic.StoreUint32(&p.index, 0)
+		atomic.StoreInt32(&p.current, 0)
+		atomic.StoreInt32(&p.ref, 0)
+		p.Lock()
+		for i, c := range p.conns {
+			// keep the wrapper's pool, holders may call Close() on it later
+			if c != nil && c.cc != nil {
+				c.cc.Close()
+			}
+			p.conns[i] = nil
+		}
+		p.Unlock()
+		p.deleteMetrics()
+		log.Printf("close pool success: %v\n", p.Status())
+	})
 	return nil
 }
 
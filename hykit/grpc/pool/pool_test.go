@@ -3,13 +3,17 @@ package pool
 import (
 	"context"
 	"flag"
+	"net"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"code.jshyjdtech.com/godev/hykit/grpc/pool/example/pb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 var endpoint = flag.String("endpoint", "127.0.0.1:50000", "grpc server endpoint")
@@ -79,6 +83,24 @@ func TestClose(t *testing.T) {
 	require.EqualValues(t, true, nativePool.conns[opt.MaxIdle-1] == nil)
 }
 
+func TestCloseInUse(t *testing.T) {
+	p, nativePool, _, err := newPool(nil)
+	require.NoError(t, err)
+
+	conn, err := p.Get()
+	require.NoError(t, err)
+	require.NoError(t, p.Close())
+	require.NoError(t, p.Close())
+
+	// the holder returns the connection after the pool is closed
+	require.NoError(t, conn.Close())
+	require.EqualValues(t, 0, nativePool.ref)
+	require.EqualValues(t, connectivity.Shutdown, conn.Value().GetState())
+
+	_, err = p.Get()
+	require.Equal(t, ErrClosed, err)
+}
+
 func TestReset(t *testing.T) {
 	p, nativePool, opt, err := newPool(nil)
 	require.NoError(t, err)
@@ -188,6 +210,130 @@ func TestBasicGet3(t *testing.T) {
 	require.EqualValues(t, true, nativeConn.once)
 }
 
+func TestHealthCheck(t *testing.T) {
+	opt := DefaultOptions
+	opt.Dial = DialTest
+	opt.MaxIdle = 2
+	opt.Name = "test_health_check"
+	opt.HealthCheckInterval = 20 * time.Millisecond
+
+	// nothing is listening on the endpoint, connections turn into TRANSIENT_FAILURE
+	p, nativePool, _, err := newPool(&opt)
+	require.NoError(t, err)
+	defer p.Close()
+
+	conn, err := p.Get()
+	require.NoError(t, err)
+	old := conn.Value()
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(poolEvicted.WithLabelValues(opt.Name,
+			connectivity.TransientFailure.String())) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	nativePool.RLock()
+	require.EqualValues(t, true, nativePool.conns[0].cc != old && nativePool.conns[1].cc != old)
+	nativePool.RUnlock()
+	require.EqualValues(t, connectivity.Shutdown, old.GetState())
+
+	// the evicted connection is still given back to the pool
+	require.NoError(t, conn.Close())
+	require.EqualValues(t, 0, atomic.LoadInt32(&nativePool.ref))
+}
+
+func TestPickHealthy(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	var dials int32
+	opt := DefaultOptions
+	opt.MaxIdle = 2
+	opt.HealthCheckInterval = 0
+	opt.Dial = func(address string) (*grpc.ClientConn, error) {
+		// the first connection is unreachable
+		if atomic.AddInt32(&dials, 1) == 1 {
+			return DialTest(*endpoint)
+		}
+		return DialTest(lis.Addr().String())
+	}
+
+	p, nativePool, _, err := newPool(&opt)
+	require.NoError(t, err)
+	defer p.Close()
+
+	require.Eventually(t, func() bool {
+		return nativePool.conns[0].cc.GetState() == connectivity.TransientFailure
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		conn, err := p.Get()
+		require.NoError(t, err)
+		require.EqualValues(t, true, conn == nativePool.conns[1])
+		conn.Close()
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	opt := DefaultOptions
+	opt.Dial = DialTest
+	opt.MaxIdle = 2
+	opt.MaxActive = 2
+	opt.MaxConcurrentStreams = 1
+	opt.Reuse = false
+	opt.Name = "test_metrics"
+
+	p, _, _, err := newPool(&opt)
+	require.NoError(t, err)
+
+	conns := make([]Conn, 0, 3)
+	for i := 0; i < 3; i++ {
+		conn, err := p.Get()
+		require.NoError(t, err)
+		conns = append(conns, conn)
+	}
+
+	require.EqualValues(t, 3, testutil.ToFloat64(poolRefs.WithLabelValues(opt.Name)))
+	require.EqualValues(t, 2, testutil.ToFloat64(poolActive.WithLabelValues(opt.Name)))
+	require.EqualValues(t, 0, testutil.ToFloat64(poolIdle.WithLabelValues(opt.Name)))
+	require.EqualValues(t, 1, testutil.ToFloat64(poolOnceConns.WithLabelValues(opt.Name)))
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	require.EqualValues(t, 0, testutil.ToFloat64(poolRefs.WithLabelValues(opt.Name)))
+	require.EqualValues(t, 2, testutil.ToFloat64(poolIdle.WithLabelValues(opt.Name)))
+
+	p.Close()
+}
+
+func TestMetricsSameName(t *testing.T) {
+	opt := DefaultOptions
+	opt.Dial = DialTest
+	opt.MaxIdle = 2
+	opt.Name = "test_metrics_same_name"
+
+	p1, _, _, err := newPool(&opt)
+	require.NoError(t, err)
+
+	opt.MaxIdle = 3
+	p2, _, _, err := newPool(&opt)
+	require.NoError(t, err)
+
+	// closing the old pool keeps the series of the new one
+	require.NoError(t, p1.Close())
+	conn, err := p2.Get()
+	require.NoError(t, err)
+	require.EqualValues(t, 3, testutil.ToFloat64(poolActive.WithLabelValues(opt.Name)))
+	require.EqualValues(t, 1, testutil.ToFloat64(poolRefs.WithLabelValues(opt.Name)))
+	conn.Close()
+
+	require.NoError(t, p2.Close())
+	require.False(t, poolActive.DeleteLabelValues(opt.Name))
+}
+
 func TestConcurrentGet(t *testing.T) {
 	opt := DefaultOptions
 	opt.Dial = DialTest
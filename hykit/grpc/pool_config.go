@@ -0,0 +1,117 @@
+package grpc
+
+import (
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/grpc/pool"
+)
+
+// PoolConfig 连接池配置, 通过 grpc_client_pools 或 WithPoolConfigs 设置,
+// name 为空时作为默认配置, 服务的配置中未设置的字段使用默认配置.
+// e.g.
+//
+//	grpc_client_pools:
+//	- {name: '', maxidle: 8, maxactive: 64, maxconcurrentstreams: 64}
+//	- {name: 'pay', maxidle: 2, maxactive: 16, maxrecvmsgsize: 33554432, healthinterval: 1000}
+type PoolConfig struct {
+	// 服务名, 与 LoadServerPool 的 servName 相同
+	Name string `json:"name" yaml:"name"`
+
+	MaxIdle int `json:"max_idle" yaml:"maxidle"`
+
+	MaxActive int `json:"max_active" yaml:"maxactive"`
+
+	// 每个连接的并发流数量, 超过后扩容
+	MaxConcurrentStreams int `json:"max_concurrent_streams" yaml:"maxconcurrentstreams"`
+
+	// 达到 MaxActive 时复用连接, false 时创建一次性连接, 默认 true
+	Reuse *bool `json:"reuse" yaml:"reuse"`
+
+	// 检查连接状态的间隔, TRANSIENT_FAILURE 的连接关闭后重新建立, 单位 ms, 默认 5000, 小于 0 时不检查
+	HealthInterval int64 `json:"health_interval" yaml:"healthinterval"`
+
+	// 单位 byte, 默认 16MB, 需要更大的消息时按服务调大, e.g. maxrecvmsgsize: 67108864
+	MaxSendMsgSize int `json:"max_send_msg_size" yaml:"maxsendmsgsize"`
+
+	MaxRecvMsgSize int `json:"max_recv_msg_size" yaml:"maxrecvmsgsize"`
+}
+
+// merge 未设置的字段使用 def.
+func (pc PoolConfig) merge(def PoolConfig) PoolConfig {
+	if pc.MaxIdle == 0 {
+		pc.MaxIdle = def.MaxIdle
+	}
+
+	if pc.MaxActive == 0 {
+		pc.MaxActive = def.MaxActive
+	}
+
+	if pc.MaxConcurrentStreams == 0 {
+		pc.MaxConcurrentStreams = def.MaxConcurrentStreams
+	}
+
+	if pc.Reuse == nil {
+		pc.Reuse = def.Reuse
+	}
+
+	if pc.HealthInterval == 0 {
+		pc.HealthInterval = def.HealthInterval
+	}
+
+	if pc.MaxSendMsgSize == 0 {
+		pc.MaxSendMsgSize = def.MaxSendMsgSize
+	}
+
+	if pc.MaxRecvMsgSize == 0 {
+		pc.MaxRecvMsgSize = def.MaxRecvMsgSize
+	}
+
+	return pc
+}
+
+var defaultPoolConfig = func() PoolConfig {
+	reuse := pool.DefaultOptions.Reuse
+	return PoolConfig{
+		MaxIdle:              pool.DefaultOptions.MaxIdle,
+		MaxActive:            pool.DefaultOptions.MaxActive,
+		MaxConcurrentStreams: pool.DefaultOptions.MaxConcurrentStreams,
+		Reuse:                &reuse,
+		HealthInterval:       int64(pool.DefaultOptions.HealthCheckInterval / time.Millisecond),
+		MaxSendMsgSize:       pool.MaxSendMsgSize,
+		MaxRecvMsgSize:       pool.MaxRecvMsgSize,
+	}
+}()
+
+// poolConfig 服务的连接池配置.
+func (gc *Client) poolConfig(servName string) PoolConfig {
+	var def, serv PoolConfig
+	for _, pc := range gc.poolConfigs {
+		switch pc.Name {
+		case "":
+			def = pc
+		case servName:
+			serv = pc
+		}
+	}
+
+	serv = serv.merge(def.merge(defaultPoolConfig))
+	serv.Name = servName
+
+	return serv
+}
+
+func (pc PoolConfig) options() pool.Options {
+	opt := pool.DefaultOptions
+	opt.Name = pc.Name
+	opt.MaxIdle = pc.MaxIdle
+	opt.MaxActive = pc.MaxActive
+	opt.MaxConcurrentStreams = pc.MaxConcurrentStreams
+	opt.Reuse = *pc.Reuse
+
+	opt.HealthCheckInterval = 0
+	if pc.HealthInterval > 0 {
+		opt.HealthCheckInterval = time.Duration(pc.HealthInterval) * time.Millisecond
+	}
+
+	return opt
+}
@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/grpc/pool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolConfig(t *testing.T) {
+	reuse := false
+	client := &Client{poolConfigs: []PoolConfig{
+		{Name: "", MaxIdle: 4, MaxRecvMsgSize: 8 << 20},
+		{Name: "pay", MaxActive: 16, Reuse: &reuse, HealthInterval: -1, MaxSendMsgSize: 1 << 20},
+	}}
+
+	pc := client.poolConfig("pay")
+	assert.Equal(t, "pay", pc.Name)
+	assert.Equal(t, 4, pc.MaxIdle)
+	assert.Equal(t, 16, pc.MaxActive)
+	assert.Equal(t, pool.DefaultOptions.MaxConcurrentStreams, pc.MaxConcurrentStreams)
+	assert.Equal(t, 1<<20, pc.MaxSendMsgSize)
+	assert.Equal(t, 8<<20, pc.MaxRecvMsgSize)
+
+	opt := pc.options()
+	assert.False(t, opt.Reuse)
+	assert.Equal(t, time.Duration(0), opt.HealthCheckInterval)
+
+	opt = client.poolConfig("order").options()
+	assert.Equal(t, "order", opt.Name)
+	assert.Equal(t, pool.DefaultOptions.MaxActive, opt.MaxActive)
+	assert.True(t, opt.Reuse)
+
+	// 未配置时消息大小默认 16MB, 按服务调大
+	pc = (&Client{}).poolConfig("report")
+	assert.Equal(t, 16<<20, pc.MaxSendMsgSize)
+	assert.Equal(t, 16<<20, pc.MaxRecvMsgSize)
+	assert.Equal(t, pool.HealthCheckInterval, opt.HealthCheckInterval)
+}
+
+func TestNewPool_Config(t *testing.T) {
+	onceClient = sync.Once{}
+
+	clientOpt := ClientOption{}
+	client := NewClient(
+		clientOpt.WithLogger(logger),
+		clientOpt.WithConf(newMemConfig()),
+		clientOpt.WithPoolConfigs(PoolConfig{Name: "greeter", MaxIdle: 2, MaxActive: 4}))
+
+	p, err := client.NewPool(context.Background(), "greeter", tcpAddr.String())
+	assert.Nil(t, err)
+	defer p.Close()
+
+	assert.Contains(t, p.Status(), "current:2")
+}
+
+func TestUpdateServerPool_CloseOld(t *testing.T) {
+	onceClient = sync.Once{}
+
+	memConfig := newMemConfig()
+	memConfig.Set("grpc_client_pool_close_delay", -1)
+	clientOpt := ClientOption{}
+	client := NewClient(clientOpt.WithLogger(logger), clientOpt.WithConf(memConfig))
+
+	ctx := context.Background()
+	old, err := client.LoadServerPool(ctx, "greeter", tcpAddr.String())
+	assert.Nil(t, err)
+	conn, err := old.Get()
+	assert.Nil(t, err)
+
+	p, err := client.UpdateServerPool(ctx, "greeter", "127.0.0.1:1")
+	assert.Nil(t, err)
+	assert.NotEqual(t, old, p)
+
+	// 原连接池关闭, 使用中的连接归还时不会 panic
+	_, err = old.Get()
+	assert.Equal(t, pool.ErrClosed, err)
+	assert.Nil(t, conn.Close())
+
+	assert.Nil(t, client.RemoveServerPool(ctx, "greeter"))
+	_, err = p.Get()
+	assert.Equal(t, pool.ErrClosed, err)
+}
@@ -0,0 +1,144 @@
+package grpc
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"code.jshyjdtech.com/godev/hykit/grpc/discovery"
+	"code.jshyjdtech.com/godev/hykit/log"
+	"golang.org/x/net/context"
+)
+
+// registrar 注册实例并按 ttl/3 续期.
+type registrar struct {
+	registry discovery.Registry
+
+	inst discovery.Instance
+
+	logger log.Logger
+
+	ttl time.Duration
+
+	// 下线后等待客户端更新实例的时间
+	deregisterDelay time.Duration
+
+	cancel context.CancelFunc
+
+	wg sync.WaitGroup
+}
+
+func (r *registrar) init(conf config.Config, logger log.Logger) {
+	r.logger = logger
+
+	if r.inst.Service == "" {
+		r.inst.Service = conf.GetString("appname")
+	}
+
+	if r.inst.Addr == "" {
+		r.inst.Addr = conf.GetString("grpc_server_advertise_addr")
+	}
+
+	if r.inst.Version == "" {
+		r.inst.Version = conf.GetString("version")
+	}
+
+	if r.inst.Weight == 0 {
+		r.inst.Weight = conf.GetInt("grpc_server_weight")
+	}
+	if r.inst.Weight == 0 {
+		r.inst.Weight = 1
+	}
+
+	registerTTL := conf.GetInt64("grpc_server_register_ttl")
+	if registerTTL < 0 {
+		// 续期间隔为 ttl/3, 不能小于 0
+		logger.Panicf("grpc_server_register_ttl must be positive, got %d", registerTTL)
+	}
+	if registerTTL == 0 {
+		registerTTL = 10
+	}
+	r.ttl = time.Duration(registerTTL) * time.Second
+
+	r.deregisterDelay = time.Duration(conf.GetInt64("grpc_server_deregister_delay")) * time.Millisecond
+}
+
+func (r *registrar) start(lisAddr net.Addr) {
+	if r.inst.Addr == "" {
+		r.inst.Addr = advertiseAddr(lisAddr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.register(ctx)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.register(ctx)
+			}
+		}
+	}()
+}
+
+// register 失败时等待下次续期重试.
+func (r *registrar) register(ctx context.Context) {
+	err := r.registry.Register(ctx, r.inst, r.ttl)
+	if err != nil {
+		r.logger.Errorc(ctx, "Grpc server register %s %s : %s", r.inst.Service, r.inst.Addr, err.Error())
+	}
+}
+
+func (r *registrar) stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := r.registry.Deregister(ctx, r.inst); err != nil {
+		r.logger.Errorc(ctx, "Grpc server deregister %s %s : %s", r.inst.Service, r.inst.Addr, err.Error())
+	} else {
+		r.logger.Infof("Grpc server deregister %s %s", r.inst.Service, r.inst.Addr)
+	}
+
+	if r.deregisterDelay > 0 {
+		time.Sleep(r.deregisterDelay)
+	}
+}
+
+// advertiseAddr 监听 0.0.0.0 时使用本机第一个非回环的 IPv4 地址.
+func advertiseAddr(lisAddr net.Addr) string {
+	tcpAddr, ok := lisAddr.(*net.TCPAddr)
+	if !ok || !tcpAddr.IP.IsUnspecified() {
+		return lisAddr.String()
+	}
+
+	ip := "127.0.0.1"
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+				ip = ipNet.IP.String()
+				break
+			}
+		}
+	}
+
+	return net.JoinHostPort(ip, strconv.Itoa(tcpAddr.Port))
+}
@@ -0,0 +1,303 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSConfig 证书文件变化时自动重新加载, 不需要重启.
+type TLSConfig struct {
+	CertFile string
+
+	KeyFile string
+
+	// 服务端: 校验客户端证书的 CA, 配置后要求客户端提供证书(mTLS);
+	// 客户端: 校验服务端证书的 CA, 为空时使用系统 CA.
+	CAFile string
+
+	// 客户端校验服务端证书使用的名称, 为空时使用连接的地址
+	ServerName string
+}
+
+func (tc TLSConfig) enabled() bool {
+	return tc.CertFile != "" || tc.CAFile != ""
+}
+
+// tlsConfigFromConf e.g. grpc_server_tls_cert, grpc_client_tls_server_name.
+func tlsConfigFromConf(conf config.Config, prefix string) TLSConfig {
+	return TLSConfig{
+		CertFile:   conf.GetString(prefix + "_tls_cert"),
+		KeyFile:    conf.GetString(prefix + "_tls_key"),
+		CAFile:     conf.GetString(prefix + "_tls_ca"),
+		ServerName: conf.GetString(prefix + "_tls_server_name"),
+	}
+}
+
+// transportCredentials 没有配置证书时, 只有显式配置 insecure 或 runmode 为 dev 才使用明文.
+func transportCredentials(conf config.Config, logger log.Logger, prefix string,
+	tc TLSConfig, insecure, isServer bool) (credentials.TransportCredentials, *tlsReloader) {
+	if tc.enabled() {
+		if isServer && (tc.CertFile == "" || tc.KeyFile == "") {
+			logger.Panicf("%s tls requires cert and key", prefix)
+		}
+
+		reloader := newTLSReloader(tc, logger)
+		if err := reloader.reload(); err != nil {
+			logger.Panicf("load %s tls certificates : %s", prefix, err.Error())
+		}
+		reloader.watch()
+
+		if isServer {
+			return credentials.NewTLS(reloader.serverConfig()), reloader
+		}
+
+		return &authorityCreds{TransportCredentials: credentials.NewTLS(reloader.clientConfig()),
+			tr: reloader}, reloader
+	}
+
+	if !insecure && !conf.GetBool(prefix+"_insecure") && conf.GetString("runmode") != "dev" {
+		logger.Panicf("%s without tls, set %s_insecure or WithInsecure() explicitly to use plaintext",
+			prefix, prefix)
+	}
+
+	return nil, nil
+}
+
+// authorityCreds 使用拨号的地址校验服务端证书名称,
+// 连接 IP 时 tls.ConnectionState.ServerName 为空, 不能用于校验.
+type authorityCreds struct {
+	credentials.TransportCredentials
+
+	tr *tlsReloader
+
+	serverNameOverride string
+}
+
+func (ac *authorityCreds) ClientHandshake(ctx context.Context, authority string,
+	rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conf := ac.tr.clientConfig()
+	if conf.VerifyConnection == nil {
+		return ac.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	}
+
+	serverName := ac.tr.conf.ServerName
+	if ac.serverNameOverride != "" {
+		serverName = ac.serverNameOverride
+	}
+	if serverName == "" {
+		serverName = authority
+		if host, _, err := net.SplitHostPort(authority); err == nil {
+			serverName = host
+		}
+	}
+
+	conf.ServerName = serverName
+	conf.VerifyConnection = func(cs tls.ConnectionState) error {
+		return ac.tr.verifyConnection(serverName, cs)
+	}
+
+	return credentials.NewTLS(conf).ClientHandshake(ctx, authority, rawConn)
+}
+
+func (ac *authorityCreds) Clone() credentials.TransportCredentials {
+	return &authorityCreds{
+		TransportCredentials: ac.TransportCredentials.Clone(),
+		tr:                   ac.tr,
+		serverNameOverride:   ac.serverNameOverride,
+	}
+}
+
+//nolint:staticcheck
+func (ac *authorityCreds) OverrideServerName(serverNameOverride string) error {
+	ac.serverNameOverride = serverNameOverride
+	return ac.TransportCredentials.OverrideServerName(serverNameOverride)
+}
+
+type tlsReloader struct {
+	conf TLSConfig
+
+	logger log.Logger
+
+	cert atomic.Value
+
+	roots atomic.Value
+
+	watcher *fsnotify.Watcher
+}
+
+func newTLSReloader(conf TLSConfig, logger log.Logger) *tlsReloader {
+	return &tlsReloader{conf: conf, logger: logger}
+}
+
+func (tr *tlsReloader) reload() error {
+	if tr.conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tr.conf.CertFile, tr.conf.KeyFile)
+		if err != nil {
+			return err
+		}
+		tr.cert.Store(&cert)
+	}
+
+	if tr.conf.CAFile != "" {
+		content, err := ioutil.ReadFile(tr.conf.CAFile)
+		if err != nil {
+			return err
+		}
+
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(content) {
+			return fmt.Errorf("no certificate found in %s", tr.conf.CAFile)
+		}
+		tr.roots.Store(roots)
+	}
+
+	return nil
+}
+
+// watch 监听文件所在目录, 兼容先写临时文件再 rename 和 k8s secret 的 ..data 切换.
+func (tr *tlsReloader) watch() {
+	files := make(map[string]struct{})
+	for _, file := range []string{tr.conf.CertFile, tr.conf.KeyFile, tr.conf.CAFile} {
+		if file == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+		files[file] = struct{}{}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		tr.logger.Errorf("grpc tls watcher : %s", err.Error())
+		return
+	}
+	tr.watcher = watcher
+
+	dirs := make(map[string]struct{})
+	for file := range files {
+		dirs[filepath.Dir(file)] = struct{}{}
+	}
+
+	for dir := range dirs {
+		if err = watcher.Add(dir); err != nil {
+			tr.logger.Errorf("grpc tls watch %s : %s", dir, err.Error())
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				_, isCertFile := files[filepath.Clean(event.Name)]
+				if !isCertFile && filepath.Base(event.Name) != "..data" {
+					continue
+				}
+
+				// 证书和私钥先后写入时可能加载失败, 保留旧的证书
+				if err := tr.reload(); err != nil {
+					tr.logger.Errorf("reload grpc tls certificates : %s", err.Error())
+					continue
+				}
+				tr.logger.Infof("reload grpc tls certificates by %s", event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				tr.logger.Errorf("grpc tls watcher : %s", err.Error())
+			}
+		}
+	}()
+}
+
+func (tr *tlsReloader) close() {
+	if tr != nil && tr.watcher != nil {
+		_ = tr.watcher.Close()
+	}
+}
+
+func (tr *tlsReloader) serverConfig() *tls.Config {
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	// 每次握手使用当前的证书和 CA
+	conf.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*tr.cert.Load().(*tls.Certificate)},
+			NextProtos:   []string{"h2"},
+		}
+
+		if tr.conf.CAFile != "" {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			cfg.ClientCAs = tr.roots.Load().(*x509.CertPool)
+		}
+
+		return cfg, nil
+	}
+
+	return conf
+}
+
+func (tr *tlsReloader) clientConfig() *tls.Config {
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: tr.conf.ServerName,
+	}
+
+	if tr.conf.CertFile != "" {
+		conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return tr.cert.Load().(*tls.Certificate), nil
+		}
+	}
+
+	if tr.conf.CAFile != "" {
+		// CA 需要热加载, 跳过默认校验, 在 VerifyConnection 中使用当前的 CA 校验
+		conf.InsecureSkipVerify = true
+		conf.VerifyConnection = func(cs tls.ConnectionState) error {
+			return tr.verifyConnection(tr.conf.ServerName, cs)
+		}
+	}
+
+	return conf
+}
+
+// verifyConnection serverName 为空时拒绝, 否则 x509 会跳过名称校验.
+func (tr *tlsReloader) verifyConnection(serverName string, cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+
+	if serverName == "" {
+		return errors.New("no server name to verify the server certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         tr.roots.Load().(*x509.CertPool),
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
@@ -0,0 +1,286 @@
+package grpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	pb "google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/peer"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert sans 默认 127.0.0.1 和 pay.internal.
+func newTestCert(t *testing.T, cn string, parent *testCert, sans ...string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	if len(sans) == 0 {
+		sans = []string{"127.0.0.1", "pay.internal"}
+	}
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			tpl.IPAddresses = append(tpl.IPAddresses, ip)
+		} else {
+			tpl.DNSNames = append(tpl.DNSNames, san)
+		}
+	}
+
+	signer, signerKey := tpl, key
+	if parent == nil {
+		tpl.IsCA = true
+		tpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (tc *testCert) write(t *testing.T, certFile, keyFile string) {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.cert.Raw})
+	assert.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+
+	if keyFile != "" {
+		keyDer, err := x509.MarshalECPrivateKey(tc.key)
+		assert.Nil(t, err)
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+		assert.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+	}
+}
+
+// cnServer 返回客户端证书的 CN.
+type cnServer struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (s *cnServer) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+	p, _ := peer.FromContext(ctx)
+	tlsInfo := p.AuthInfo.(credentials.TLSInfo)
+	return &pb.HelloReply{Message: tlsInfo.State.PeerCertificates[0].Subject.CommonName}, nil
+}
+
+func TestServerAndClient_MTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.write(t, caFile, "")
+	serverCert, serverKey := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	newTestCert(t, "server", ca).write(t, serverCert, serverKey)
+	clientCert, clientKey := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	newTestCert(t, "client-1", ca).write(t, clientCert, clientKey)
+
+	serverOptions := ServerOptions{}
+	svr := NewServer("127.0.0.1:0",
+		serverOptions.WithServerLogger(logger),
+		serverOptions.WithServerConf(newMemConfig()),
+		serverOptions.WithTLS(TLSConfig{CertFile: serverCert, KeyFile: serverKey, CAFile: caFile}))
+	pb.RegisterGreeterServer(svr.Server, &cnServer{})
+	svr.Start()
+	defer svr.GracefulShutDown()
+
+	onceClient = sync.Once{}
+	memConfig := newMemConfig()
+	memConfig.Set("grpc_client_tls_cert", clientCert)
+	memConfig.Set("grpc_client_tls_key", clientKey)
+	memConfig.Set("grpc_client_tls_ca", caFile)
+	memConfig.Set("grpc_client_tls_server_name", "pay.internal")
+	clientOpt := ClientOption{}
+	client := NewClient(clientOpt.WithLogger(logger), clientOpt.WithConf(memConfig))
+
+	sayHello := func() (string, error) {
+		conn, err := client.DialContext(context.Background(), svr.Addr())
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		r, err := pb.NewGreeterClient(conn.Conn()).SayHello(ctx, &pb.HelloRequest{Name: esim})
+		if err != nil {
+			return "", err
+		}
+		return r.Message, nil
+	}
+
+	cn, err := sayHello()
+	assert.Nil(t, err)
+	assert.Equal(t, "client-1", cn)
+
+	// 证书文件更新后新连接使用新证书
+	newTestCert(t, "client-2", ca).write(t, clientCert, clientKey)
+	assert.Eventually(t, func() bool {
+		cn, err := sayHello()
+		return err == nil && cn == "client-2"
+	}, 3*time.Second, 50*time.Millisecond)
+
+	call := func(opt grpc.DialOption) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn, err := grpc.DialContext(ctx, svr.Addr(), opt)
+		assert.Nil(t, err)
+		defer conn.Close()
+
+		_, err = pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: esim})
+		return err
+	}
+
+	// 没有客户端证书
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	assert.Error(t, call(grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots}))))
+
+	// 明文
+	assert.Error(t, call(grpc.WithInsecure()))
+}
+
+func TestClient_UnknownCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	serverCert, serverKey := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	newTestCert(t, "server", ca).write(t, serverCert, serverKey)
+
+	serverOptions := ServerOptions{}
+	svr := NewServer("127.0.0.1:0",
+		serverOptions.WithServerLogger(logger),
+		serverOptions.WithServerConf(newMemConfig()),
+		serverOptions.WithTLS(TLSConfig{CertFile: serverCert, KeyFile: serverKey}))
+	pb.RegisterGreeterServer(svr.Server, &server{})
+	svr.Start()
+	defer svr.GracefulShutDown()
+
+	otherCAFile := filepath.Join(dir, "other-ca.pem")
+	newTestCert(t, "other-ca", nil).write(t, otherCAFile, "")
+
+	onceClient = sync.Once{}
+	clientOpt := ClientOption{}
+	client := NewClient(clientOpt.WithLogger(logger),
+		clientOpt.WithConf(newMemConfig()),
+		clientOpt.WithTLS(TLSConfig{CAFile: otherCAFile}))
+
+	conn, err := client.DialContext(context.Background(), svr.Addr())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = pb.NewGreeterClient(conn.Conn()).SayHello(ctx, &pb.HelloRequest{Name: esim})
+	assert.Error(t, err)
+}
+
+func TestClient_ServerNameMismatch(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.write(t, caFile, "")
+
+	// 同一个 CA 签发, 但不是给 127.0.0.1 的证书
+	serverCert, serverKey := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	newTestCert(t, "server", ca, "10.0.0.1", "pay.internal").write(t, serverCert, serverKey)
+
+	serverOptions := ServerOptions{}
+	svr := NewServer("127.0.0.1:0",
+		serverOptions.WithServerLogger(logger),
+		serverOptions.WithServerConf(newMemConfig()),
+		serverOptions.WithTLS(TLSConfig{CertFile: serverCert, KeyFile: serverKey}))
+	pb.RegisterGreeterServer(svr.Server, &server{})
+	svr.Start()
+	defer svr.GracefulShutDown()
+
+	sayHello := func(tc TLSConfig) error {
+		onceClient = sync.Once{}
+		clientOpt := ClientOption{}
+		client := NewClient(clientOpt.WithLogger(logger),
+			clientOpt.WithConf(newMemConfig()),
+			clientOpt.WithTLS(tc))
+
+		conn, err := client.DialContext(context.Background(), svr.Addr())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = pb.NewGreeterClient(conn.Conn()).SayHello(ctx, &pb.HelloRequest{Name: esim})
+		return err
+	}
+
+	err := sayHello(TLSConfig{CAFile: caFile})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "127.0.0.1")
+
+	assert.Nil(t, sayHello(TLSConfig{CAFile: caFile, ServerName: "pay.internal"}))
+}
+
+func TestTLSReloader_NoServerName(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.write(t, caFile, "")
+
+	tr := newTLSReloader(TLSConfig{CAFile: caFile}, logger)
+	assert.Nil(t, tr.reload())
+
+	// 连接 IP 时 ConnectionState.ServerName 为空, 不能跳过名称校验
+	cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{newTestCert(t, "server", ca).cert}}
+	assert.Error(t, tr.verifyConnection("", cs))
+	assert.Nil(t, tr.verifyConnection("127.0.0.1", cs))
+	assert.Error(t, tr.verifyConnection("10.0.0.1", cs))
+}
+
+func TestTransportCredentials_Plaintext(t *testing.T) {
+	assert.Panics(t, func() {
+		transportCredentials(config.NewMemConfig(), logger, "grpc_client", TLSConfig{}, false, false)
+	})
+
+	devConfig := config.NewMemConfig()
+	devConfig.Set("runmode", "dev")
+	creds, _ := transportCredentials(devConfig, logger, "grpc_client", TLSConfig{}, false, false)
+	assert.Nil(t, creds)
+
+	creds, _ = transportCredentials(newMemConfig(), logger, "grpc_client", TLSConfig{}, false, false)
+	assert.Nil(t, creds)
+
+	creds, _ = transportCredentials(config.NewMemConfig(), logger, "grpc_server", TLSConfig{}, true, true)
+	assert.Nil(t, creds)
+}
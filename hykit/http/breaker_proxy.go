@@ -0,0 +1,260 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	stateClosed = iota
+	stateOpen
+	stateHalfOpen
+)
+
+var stateNames = map[int]string{
+	stateClosed:   "closed",
+	stateOpen:     "open",
+	stateHalfOpen: "half_open",
+}
+
+// circuitBreaker 连续失败 failures 次后熔断 openTime,
+// 之后进入半开状态放行 probes 个探测请求, 探测成功恢复, 失败重新熔断.
+type circuitBreaker struct {
+	mu sync.Mutex
+
+	host string
+
+	state int
+
+	failures int
+
+	openedAt time.Time
+
+	probing int
+
+	maxFailures int
+
+	openTime time.Duration
+
+	maxProbes int
+
+	logger log.Logger
+}
+
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case stateOpen:
+		if time.Since(cb.openedAt) < cb.openTime {
+			return false
+		}
+		cb.transition(stateHalfOpen)
+		fallthrough
+	case stateHalfOpen:
+		if cb.probing >= cb.maxProbes {
+			return false
+		}
+		cb.probing++
+	}
+
+	return true
+}
+
+func (cb *circuitBreaker) done(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == stateHalfOpen {
+		if cb.probing > 0 {
+			cb.probing--
+		}
+		if success {
+			cb.transition(stateClosed)
+		} else {
+			cb.transition(stateOpen)
+		}
+		return
+	}
+
+	if success {
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.state == stateClosed && cb.failures >= cb.maxFailures {
+		cb.transition(stateOpen)
+	}
+}
+
+// release 请求被调用方取消, 不计入成功或失败.
+func (cb *circuitBreaker) release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == stateHalfOpen && cb.probing > 0 {
+		cb.probing--
+	}
+}
+
+// transition 调用方持有锁.
+func (cb *circuitBreaker) transition(to int) {
+	from := cb.state
+	cb.state = to
+	cb.failures = 0
+
+	if to == stateOpen {
+		cb.openedAt = time.Now()
+	}
+
+	if to != stateHalfOpen {
+		cb.probing = 0
+	}
+
+	httpBreakerState.With(prometheus.Labels{"host": cb.host}).Set(float64(to))
+	httpBreakerTransitions.With(prometheus.Labels{"host": cb.host,
+		"from": stateNames[from], "to": stateNames[to]}).Inc()
+	cb.logger.Warnf("http circuit breaker [%s] %s -> %s", cb.host, stateNames[from], stateNames[to])
+}
+
+// BreakerProxy 按 host 熔断, 请求错误和 5xx 计为失败.
+type BreakerProxy struct {
+	nextTransport http.RoundTripper
+
+	logger log.Logger
+
+	conf config.Config
+
+	name string
+
+	mu sync.RWMutex
+
+	breakers map[string]*circuitBreaker
+
+	maxFailures int
+
+	openTime time.Duration
+
+	maxProbes int
+}
+
+type BreakerProxyOption func(c *BreakerProxy)
+
+type BreakerProxyOptions struct{}
+
+func NewBreakerProxy(options ...BreakerProxyOption) *BreakerProxy {
+	bp := &BreakerProxy{
+		breakers: make(map[string]*circuitBreaker),
+	}
+
+	for _, option := range options {
+		option(bp)
+	}
+
+	if bp.conf == nil {
+		bp.conf = config.NewNullConfig()
+	}
+
+	if bp.logger == nil {
+		bp.logger = log.NewLogger()
+	}
+
+	bp.maxFailures = bp.conf.GetInt("http_client_breaker_failures")
+	if bp.maxFailures == 0 {
+		bp.maxFailures = 5
+	}
+
+	bp.openTime = time.Duration(bp.conf.GetInt64("http_client_breaker_open_time")) * time.Millisecond
+	if bp.openTime == 0 {
+		bp.openTime = 10 * time.Second
+	}
+
+	bp.maxProbes = bp.conf.GetInt("http_client_breaker_probes")
+	if bp.maxProbes == 0 {
+		bp.maxProbes = 1
+	}
+
+	bp.name = "breaker_proxy"
+
+	return bp
+}
+
+func (BreakerProxyOptions) WithConf(conf config.Config) BreakerProxyOption {
+	return func(bp *BreakerProxy) {
+		bp.conf = conf
+	}
+}
+
+func (BreakerProxyOptions) WithLogger(logger log.Logger) BreakerProxyOption {
+	return func(bp *BreakerProxy) {
+		bp.logger = logger
+	}
+}
+
+func (bp *BreakerProxy) NextProxy(tripper interface{}) {
+	bp.nextTransport = tripper.(http.RoundTripper)
+}
+
+func (bp *BreakerProxy) ProxyName() string {
+	return bp.name
+}
+
+func (bp *BreakerProxy) getBreaker(host string) *circuitBreaker {
+	bp.mu.RLock()
+	cb, ok := bp.breakers[host]
+	bp.mu.RUnlock()
+	if ok {
+		return cb
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if cb, ok = bp.breakers[host]; !ok {
+		cb = &circuitBreaker{
+			host:        host,
+			maxFailures: bp.maxFailures,
+			openTime:    bp.openTime,
+			maxProbes:   bp.maxProbes,
+			logger:      bp.logger,
+		}
+		bp.breakers[host] = cb
+		httpBreakerState.With(prometheus.Labels{"host": host}).Set(stateClosed)
+	}
+
+	return cb
+}
+
+// RoundTrip implements the RoundTripper interface.
+func (bp *BreakerProxy) RoundTrip(req *http.Request) (*http.Response, error) {
+	if bp.nextTransport == nil {
+		bp.nextTransport = http.DefaultTransport
+	}
+
+	cb := bp.getBreaker(req.URL.Host)
+	if !cb.allow() {
+		return nil, fmt.Errorf("%s %w", req.URL.Host, ErrCircuitOpen)
+	}
+
+	resp, err := bp.nextTransport.RoundTrip(req)
+	if err != nil && errors.Is(err, context.Canceled) {
+		cb.release()
+		return resp, err
+	}
+
+	cb.done(err == nil && resp.StatusCode < http.StatusInternalServerError)
+
+	return resp, err
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerProxy_OpenAndHalfOpen(t *testing.T) {
+	var fail int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("pong"))
+	}))
+	defer server.Close()
+
+	memConfig := config.NewMemConfig()
+	memConfig.Set("http_client_breaker_failures", 2)
+	memConfig.Set("http_client_breaker_open_time", 50)
+
+	breaker := NewBreakerProxy(BreakerProxyOptions{}.WithConf(memConfig),
+		BreakerProxyOptions{}.WithLogger(logger))
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithProxy(func() interface{} { return breaker }),
+	)
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Client.R().Get(server.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode())
+	}
+
+	_, err := client.Client.R().Get(server.URL)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	// 半开探测失败重新熔断
+	time.Sleep(60 * time.Millisecond)
+	resp, err := client.Client.R().Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode())
+
+	_, err = client.Client.R().Get(server.URL)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	// 半开探测成功恢复
+	atomic.StoreInt32(&fail, 0)
+	time.Sleep(60 * time.Millisecond)
+	resp, err = client.Client.R().Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", resp.String())
+
+	resp, err = client.Client.R().Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", resp.String())
+}
+
+func TestCircuitBreaker_HalfOpenProbes(t *testing.T) {
+	cb := &circuitBreaker{host: "test", maxFailures: 1, openTime: time.Millisecond,
+		maxProbes: 1, logger: logger}
+
+	assert.True(t, cb.allow())
+	cb.done(false)
+	assert.False(t, cb.allow())
+
+	time.Sleep(2 * time.Millisecond)
+	assert.True(t, cb.allow())
+	assert.False(t, cb.allow())
+
+	cb.release()
+	assert.True(t, cb.allow())
+	cb.done(true)
+	assert.True(t, cb.allow())
+	assert.True(t, cb.allow())
+}
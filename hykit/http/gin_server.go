@@ -0,0 +1,256 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"code.jshyjdtech.com/godev/hykit/log"
+	middleware "code.jshyjdtech.com/godev/hykit/middle-ware"
+	"github.com/gin-gonic/gin"
+	"github.com/opentracing/opentracing-go"
+)
+
+// Pinger e.g. redis.Client.
+type Pinger interface {
+	Ping() error
+}
+
+// MultiPinger e.g. mysql.Client, mongodb.Client.
+type MultiPinger interface {
+	Ping() []error
+}
+
+type readyCheck struct {
+	name string
+
+	check func() []error
+}
+
+// GinServer 实现 transports.Transports, 包含默认的中间件, /healthz 和 /readyz.
+// /healthz 进程存活即返回 200, /readyz 依赖全部可用返回 200, 关闭过程中返回 503.
+type GinServer struct {
+	en *gin.Engine
+
+	addr string
+
+	logger log.Logger
+
+	conf config.Config
+
+	tracer opentracing.Tracer
+
+	server *http.Server
+
+	routers []func(en *gin.Engine)
+
+	checks []readyCheck
+
+	// 关闭时先让 /readyz 返回 503, 等待 shutdownDelay 让负载均衡摘除实例
+	shutdownDelay time.Duration
+
+	// 等待处理中的请求完成的最长时间
+	drainTimeout time.Duration
+
+	shuttingDown int32
+}
+
+type GinServerOption func(gs *GinServer)
+
+type GinServerOptions struct{}
+
+func NewGinServer(options ...GinServerOption) *GinServer {
+	gs := &GinServer{}
+
+	for _, option := range options {
+		option(gs)
+	}
+
+	if gs.conf == nil {
+		gs.conf = config.NewNullConfig()
+	}
+
+	if gs.logger == nil {
+		gs.logger = log.NewLogger()
+	}
+
+	if gs.addr == "" {
+		gs.addr = gs.conf.GetString("httpport")
+	}
+	if !strings.Contains(gs.addr, ":") {
+		gs.addr = ":" + gs.addr
+	}
+
+	gs.shutdownDelay = time.Duration(gs.conf.GetInt64("http_shutdown_delay")) * time.Millisecond
+
+	gs.drainTimeout = time.Duration(gs.conf.GetInt64("http_drain_timeout")) * time.Millisecond
+	if gs.drainTimeout == 0 {
+		gs.drainTimeout = 3 * time.Second
+	}
+
+	if gs.conf.GetBool("debug") {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	en := gin.New()
+
+	en.Use(middleware.GinTracerID())
+
+	en.Use(gin.LoggerWithFormatter(middleware.GinLogFormatter))
+
+	en.Use(middleware.GinRecovery(gs.logger))
+
+	if gs.tracer != nil && (gs.conf.GetBool("http_tracer") || gs.conf.GetBool("http_trace")) {
+		en.Use(middleware.GinTracer(gs.tracer))
+	}
+
+	if gs.conf.GetBool("http_metrics") {
+		en.Use(middleware.GinMonitor())
+	}
+
+	en.GET("/healthz", gs.healthz)
+	en.GET("/readyz", gs.readyz)
+
+	gs.en = en
+
+	return gs
+}
+
+func (GinServerOptions) WithConf(conf config.Config) GinServerOption {
+	return func(gs *GinServer) {
+		gs.conf = conf
+	}
+}
+
+func (GinServerOptions) WithLogger(logger log.Logger) GinServerOption {
+	return func(gs *GinServer) {
+		gs.logger = logger
+	}
+}
+
+func (GinServerOptions) WithTracer(tracer opentracing.Tracer) GinServerOption {
+	return func(gs *GinServer) {
+		gs.tracer = tracer
+	}
+}
+
+// WithAddr 监听地址, 默认取 httpport.
+func (GinServerOptions) WithAddr(addr string) GinServerOption {
+	return func(gs *GinServer) {
+		gs.addr = addr
+	}
+}
+
+// WithRouter 注册路由, 在 Start 时调用.
+func (GinServerOptions) WithRouter(routers ...func(en *gin.Engine)) GinServerOption {
+	return func(gs *GinServer) {
+		gs.routers = append(gs.routers, routers...)
+	}
+}
+
+// WithPinger /readyz 检查的依赖, e.g. WithPinger("redis", redisClient).
+func (GinServerOptions) WithPinger(name string, pinger Pinger) GinServerOption {
+	return func(gs *GinServer) {
+		gs.checks = append(gs.checks, readyCheck{name: name, check: func() []error {
+			if err := pinger.Ping(); err != nil {
+				return []error{err}
+			}
+			return nil
+		}})
+	}
+}
+
+// WithMultiPinger /readyz 检查的依赖, e.g. WithMultiPinger("mysql", mysqlClient).
+func (GinServerOptions) WithMultiPinger(name string, pinger MultiPinger) GinServerOption {
+	return func(gs *GinServer) {
+		gs.checks = append(gs.checks, readyCheck{name: name, check: pinger.Ping})
+	}
+}
+
+// Engine 用于注册路由和中间件.
+func (gs *GinServer) Engine() *gin.Engine {
+	return gs.en
+}
+
+func (gs *GinServer) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (gs *GinServer) readyz(c *gin.Context) {
+	if atomic.LoadInt32(&gs.shuttingDown) == 1 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+		return
+	}
+
+	status := http.StatusOK
+	checks := make(gin.H, len(gs.checks))
+	for _, rc := range gs.checks {
+		errs := rc.check()
+		if len(errs) == 0 {
+			checks[rc.name] = "ok"
+			continue
+		}
+
+		status = http.StatusServiceUnavailable
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		checks[rc.name] = strings.Join(msgs, "; ")
+		gs.logger.Warnc(c.Request.Context(), "readyz %s : %s", rc.name, checks[rc.name])
+	}
+
+	if status == http.StatusOK {
+		c.JSON(status, gin.H{"status": "ok", "checks": checks})
+	} else {
+		c.JSON(status, gin.H{"status": "unavailable", "checks": checks})
+	}
+}
+
+func (gs *GinServer) Start() {
+	for _, router := range gs.routers {
+		router(gs.en)
+	}
+
+	ln, err := net.Listen("tcp", gs.addr)
+	if err != nil {
+		gs.logger.Fatalf("start http server err %s", err.Error())
+	}
+	gs.addr = ln.Addr().String()
+
+	gs.server = &http.Server{Addr: gs.addr, Handler: gs.en}
+	gs.logger.Infof("gin start to listen %s", gs.addr)
+	go func() {
+		if err := gs.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			gs.logger.Fatalf("start http server err %s", err.Error())
+		}
+	}()
+}
+
+// Addr 实际监听的地址, 端口为 0 时在 Start 之后可用.
+func (gs *GinServer) Addr() string {
+	return gs.addr
+}
+
+func (gs *GinServer) GracefulShutDown() {
+	atomic.StoreInt32(&gs.shuttingDown, 1)
+	if gs.server == nil {
+		return
+	}
+
+	if gs.shutdownDelay > 0 {
+		time.Sleep(gs.shutdownDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gs.drainTimeout)
+	defer cancel()
+	if err := gs.server.Shutdown(ctx); err != nil {
+		gs.logger.Errorf("stop http server error %s", err.Error())
+	}
+}
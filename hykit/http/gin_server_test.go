@@ -0,0 +1,102 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePinger struct {
+	err error
+}
+
+func (fp fakePinger) Ping() error {
+	return fp.err
+}
+
+type fakeMultiPinger struct {
+	errs []error
+}
+
+func (fmp fakeMultiPinger) Ping() []error {
+	return fmp.errs
+}
+
+func TestGinServer_HealthAndReady(t *testing.T) {
+	memConfig := config.NewMemConfig()
+	memConfig.Set("http_shutdown_delay", 200)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	serverOptions := GinServerOptions{}
+	server := NewGinServer(
+		serverOptions.WithConf(memConfig),
+		serverOptions.WithLogger(logger),
+		serverOptions.WithAddr("127.0.0.1:0"),
+		serverOptions.WithPinger("redis", fakePinger{}),
+		serverOptions.WithMultiPinger("mysql", fakeMultiPinger{errs: []error{errors.New("connection refused")}}),
+		serverOptions.WithRouter(func(en *gin.Engine) {
+			en.GET("/slow", func(c *gin.Context) {
+				close(started)
+				<-release
+				c.String(http.StatusOK, "done")
+			})
+		}),
+	)
+	server.Start()
+
+	client := NewClient(ClientOptions{}.WithLogger(logger))
+	baseURL := "http://" + server.Addr()
+
+	resp, err := client.Client.R().Get(baseURL + "/healthz")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	resp, err = client.Client.R().Get(baseURL + "/readyz")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Contains(t, resp.String(), "connection refused")
+
+	// 关闭过程中 /readyz 返回 503, 处理中的请求正常完成
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp, err := client.Client.R().Get(baseURL + "/slow")
+		assert.Nil(t, err)
+		assert.Equal(t, "done", resp.String())
+	}()
+	<-started
+
+	shutdown := make(chan struct{})
+	go func() {
+		server.GracefulShutDown()
+		close(shutdown)
+	}()
+
+	assert.Eventually(t, func() bool {
+		resp, err := client.Client.R().Get(baseURL + "/readyz")
+		return err == nil && resp.StatusCode() == http.StatusServiceUnavailable &&
+			strings.Contains(resp.String(), "shutting down")
+	}, time.Second, 10*time.Millisecond)
+
+	close(release)
+	wg.Wait()
+
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Fatal("graceful shutdown did not finish")
+	}
+
+	_, err = client.Client.R().Get(baseURL + "/healthz")
+	assert.NotNil(t, err)
+}
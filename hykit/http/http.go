@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"code.jshyjdtech.com/godev/hykit/log"
+	"code.jshyjdtech.com/godev/hykit/proxy"
 	"github.com/go-resty/resty/v2"
 )
 
@@ -15,6 +16,10 @@ type Client struct {
 
 	transports http.Transport
 
+	proxys []func() interface{}
+
+	tls *tlsManager
+
 	Client *resty.Client // go-resty用法灵活，大写公开，不必局限于该文件下的SendPOST、SendGET等方法；
 }
 
@@ -33,10 +38,27 @@ func NewClient(opts ...Options) *Client {
 		c.logger = log.NewLogger()
 	}
 
-	c.Client.SetTransport(&c.transports)
+	if c.tls != nil {
+		c.tls.init(c.logger, &c.transports)
+	}
+
+	if len(c.proxys) > 0 {
+		firstProxy := proxy.NewProxyFactory().GetFirstInstance("http", &c.transports, c.proxys...)
+		c.Client.SetTransport(firstProxy.(http.RoundTripper))
+	} else {
+		c.Client.SetTransport(&c.transports)
+	}
+
 	return c
 }
 
+// Close 停止证书文件监听
+func (c *Client) Close() {
+	if c.tls != nil {
+		c.tls.close()
+	}
+}
+
 // WithInsecureSkip with TLS/SSL
 func (ClientOptions) WithInsecureSkip() Options {
 	return func(hc *Client) {
@@ -80,3 +102,11 @@ func (ClientOptions) WithLogger(logger log.Logger) Options {
 		hc.logger = logger
 	}
 }
+
+// WithProxy RoundTripper 代理链, 按顺序调用, 最后调用配置好的 http.Transport
+// e.g. WithProxy(func() interface{} {return NewMonitorProxy(...)})
+func (ClientOptions) WithProxy(proxys ...func() interface{}) Options {
+	return func(hc *Client) {
+		hc.proxys = append(hc.proxys, proxys...)
+	}
+}
@@ -2,10 +2,16 @@ package http
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"code.jshyjdtech.com/godev/hykit/config"
 	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,3 +49,39 @@ func TestMulLevelRoundTrip(t *testing.T) {
 	fmt.Println(resp.StatusCode())
 
 }
+
+func TestClient_WithProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	}))
+	defer server.Close()
+
+	spy := newSpyProxy(logger, "spy_proxy")
+	slow := newSlowProxy(logger, "slow_proxy")
+
+	memConfig := config.NewMemConfig()
+	memConfig.Set("http_client_metrics", true)
+	monitor := NewMonitorProxy(MonitorProxyOptions{}.WithConf(memConfig),
+		MonitorProxyOptions{}.WithLogger(logger))
+
+	clientOptions := ClientOptions{}
+	httpClient := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithProxy(
+			func() interface{} { return monitor },
+			func() interface{} { return spy },
+			func() interface{} { return slow },
+		),
+	)
+
+	resp, err := httpClient.Client.R().Get(server.URL + "/ping")
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", resp.String())
+	assert.True(t, spy.RoundTripWasCalled)
+	assert.True(t, resp.Time() >= 10*time.Millisecond)
+
+	lab := prometheus.Labels{"url": server.URL + "/ping", "method": http.MethodGet}
+	metric := &io_prometheus_client.Metric{}
+	assert.Nil(t, httpTotal.With(lab).Write(metric))
+	assert.Equal(t, float64(1), metric.Counter.GetValue())
+}
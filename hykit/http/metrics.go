@@ -21,7 +21,35 @@ var httpDuration = prometheus.NewHistogramVec(
 	[]string{"url", "method"},
 )
 
+var httpRetryTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "http_client_retry_total",
+		Help: "Number of http client retries",
+	},
+	[]string{"host", "reason"},
+)
+
+// 0 closed, 1 open, 2 half_open.
+var httpBreakerState = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "http_client_breaker_state",
+		Help: "http client circuit breaker state",
+	},
+	[]string{"host"},
+)
+
+var httpBreakerTransitions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "http_client_breaker_transitions_total",
+		Help: "Number of http client circuit breaker state changes",
+	},
+	[]string{"host", "from", "to"},
+)
+
 func init() {
 	prometheus.MustRegister(httpTotal)
 	prometheus.MustRegister(httpDuration)
+	prometheus.MustRegister(httpRetryTotal)
+	prometheus.MustRegister(httpBreakerState)
+	prometheus.MustRegister(httpBreakerTransitions)
 }
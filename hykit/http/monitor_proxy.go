@@ -102,7 +102,8 @@ func (mp *MonitorProxy) RoundTrip(req *http.Request) (*http.Response, error) {
 	var resp *http.Response
 	var err error
 
-	if mp.conf.GetBool("http_client_trace") {
+	// 兼容 http_client_tracer
+	if mp.conf.GetBool("http_client_trace") || mp.conf.GetBool("http_client_tracer") {
 		tracerReq, ht := nethttp.TraceRequest(mp.tracer, req)
 
 		transport := nethttp.Transport{}
@@ -150,8 +151,8 @@ func (mp *MonitorProxy) slowHTTPRequest(beginTime, endTime time.Time,
 
 	if httpClientSlowTime != 0 {
 		if endTime.Sub(beginTime) > time.Duration(httpClientSlowTime)*time.Millisecond {
-			mp.logger.Warnf("slow http request [%s] ：%s", endTime.Sub(beginTime).String(),
-				res.RequestURI)
+			mp.logger.Warnc(res.Context(), "slow http request [%s] ：%s", endTime.Sub(beginTime).String(),
+				res.URL.String())
 		}
 	}
 }
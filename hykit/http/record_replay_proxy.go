@@ -0,0 +1,360 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"code.jshyjdtech.com/godev/hykit/log"
+)
+
+const (
+	// ModeRecord 调用真实服务并把请求响应写入文件
+	ModeRecord = "record"
+
+	// ModeReplay 从文件中匹配请求返回录制的响应
+	ModeReplay = "replay"
+
+	maskedValue = "******"
+)
+
+var ErrNoRecordedResponse = errors.New("no recorded response")
+
+type recordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+type recordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+type interaction struct {
+	Request recordedRequest `json:"request"`
+
+	Response recordedResponse `json:"response"`
+
+	// 回放时已使用
+	replayed bool
+}
+
+// RecordReplayProxy 录制模式保存真实的请求响应(敏感请求头脱敏)到 golden 文件,
+// 回放模式按 method、url 和规范化后的 body 匹配录制的响应, 匹配不到返回 ErrNoRecordedResponse.
+type RecordReplayProxy struct {
+	nextTransport http.RoundTripper
+
+	logger log.Logger
+
+	conf config.Config
+
+	name string
+
+	mode string
+
+	file string
+
+	maskHeaders map[string]struct{}
+
+	mu sync.Mutex
+
+	interactions []*interaction
+}
+
+type RecordReplayProxyOption func(c *RecordReplayProxy)
+
+type RecordReplayProxyOptions struct{}
+
+func NewRecordReplayProxy(options ...RecordReplayProxyOption) *RecordReplayProxy {
+	rrp := &RecordReplayProxy{
+		maskHeaders: make(map[string]struct{}),
+	}
+
+	for _, h := range []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"} {
+		rrp.maskHeaders[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+
+	for _, option := range options {
+		option(rrp)
+	}
+
+	if rrp.conf == nil {
+		rrp.conf = config.NewNullConfig()
+	}
+
+	if rrp.logger == nil {
+		rrp.logger = log.NewLogger()
+	}
+
+	if rrp.mode == "" {
+		rrp.mode = rrp.conf.GetString("http_client_record_mode")
+	}
+	if rrp.mode == "" {
+		rrp.mode = ModeReplay
+	}
+
+	if rrp.file == "" {
+		rrp.logger.Panicf("record replay file is empty")
+	}
+
+	if rrp.mode == ModeReplay {
+		if err := rrp.load(); err != nil {
+			rrp.logger.Panicf("load %s : %s", rrp.file, err.Error())
+		}
+	}
+
+	rrp.name = "record_replay_proxy"
+
+	return rrp
+}
+
+func (RecordReplayProxyOptions) WithConf(conf config.Config) RecordReplayProxyOption {
+	return func(rrp *RecordReplayProxy) {
+		rrp.conf = conf
+	}
+}
+
+func (RecordReplayProxyOptions) WithLogger(logger log.Logger) RecordReplayProxyOption {
+	return func(rrp *RecordReplayProxy) {
+		rrp.logger = logger
+	}
+}
+
+// WithMode record | replay, 默认取 http_client_record_mode, 都没有时为 replay.
+func (RecordReplayProxyOptions) WithMode(mode string) RecordReplayProxyOption {
+	return func(rrp *RecordReplayProxy) {
+		rrp.mode = mode
+	}
+}
+
+// WithFile golden 文件路径, e.g. testdata/union_pay.json.
+func (RecordReplayProxyOptions) WithFile(file string) RecordReplayProxyOption {
+	return func(rrp *RecordReplayProxy) {
+		rrp.file = file
+	}
+}
+
+// WithMaskHeaders 录制时需要脱敏的请求头和响应头,
+// 默认 Authorization, Cookie, Set-Cookie, X-Api-Key.
+func (RecordReplayProxyOptions) WithMaskHeaders(headers ...string) RecordReplayProxyOption {
+	return func(rrp *RecordReplayProxy) {
+		for _, h := range headers {
+			rrp.maskHeaders[http.CanonicalHeaderKey(h)] = struct{}{}
+		}
+	}
+}
+
+func (rrp *RecordReplayProxy) NextProxy(tripper interface{}) {
+	rrp.nextTransport = tripper.(http.RoundTripper)
+}
+
+func (rrp *RecordReplayProxy) ProxyName() string {
+	return rrp.name
+}
+
+// RoundTrip implements the RoundTripper interface.
+func (rrp *RecordReplayProxy) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rrp.mode == ModeRecord {
+		return rrp.record(req, body)
+	}
+
+	return rrp.replay(req, body)
+}
+
+func (rrp *RecordReplayProxy) record(req *http.Request, body []byte) (*http.Response, error) {
+	if rrp.nextTransport == nil {
+		rrp.nextTransport = http.DefaultTransport
+	}
+
+	resp, err := rrp.nextTransport.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	rrp.mu.Lock()
+	defer rrp.mu.Unlock()
+
+	rrp.interactions = append(rrp.interactions, &interaction{
+		Request: recordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: rrp.mask(req.Header),
+			Body:   string(body),
+		},
+		Response: recordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     rrp.mask(resp.Header),
+			Body:       string(respBody),
+		},
+	})
+
+	if err = rrp.save(); err != nil {
+		rrp.logger.Errorc(req.Context(), "save %s : %s", rrp.file, err.Error())
+	}
+
+	return resp, nil
+}
+
+// replay 相同的请求按录制顺序返回, 都用过后重复返回最后一个.
+func (rrp *RecordReplayProxy) replay(req *http.Request, body []byte) (*http.Response, error) {
+	rrp.mu.Lock()
+	defer rrp.mu.Unlock()
+
+	bodyKey := normalizeBody(req.Header.Get("Content-Type"), body)
+
+	var matched *interaction
+	for _, it := range rrp.interactions {
+		if it.Request.Method != req.Method || it.Request.URL != req.URL.String() ||
+			normalizeBody(it.Request.Header.Get("Content-Type"), []byte(it.Request.Body)) != bodyKey {
+			continue
+		}
+
+		matched = it
+		if !it.replayed {
+			break
+		}
+	}
+
+	if matched == nil {
+		rrp.logger.Errorc(req.Context(), "%s %s %s : %s", ErrNoRecordedResponse.Error(),
+			req.Method, req.URL.String(), string(body))
+		return nil, fmt.Errorf("%w : %s %s", ErrNoRecordedResponse, req.Method, req.URL.String())
+	}
+	matched.replayed = true
+
+	header := matched.Response.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", matched.Response.StatusCode, http.StatusText(matched.Response.StatusCode)),
+		StatusCode:    matched.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(matched.Response.Body)),
+		ContentLength: int64(len(matched.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (rrp *RecordReplayProxy) mask(header http.Header) http.Header {
+	masked := header.Clone()
+	for k := range masked {
+		if _, ok := rrp.maskHeaders[http.CanonicalHeaderKey(k)]; ok {
+			masked[k] = []string{maskedValue}
+		}
+	}
+
+	return masked
+}
+
+func (rrp *RecordReplayProxy) load() error {
+	content, err := ioutil.ReadFile(rrp.file)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, &rrp.interactions)
+}
+
+func (rrp *RecordReplayProxy) save() error {
+	content, err := json.MarshalIndent(rrp.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(rrp.file), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(rrp.file, content, 0644)
+}
+
+// readBody 读取请求体, 不修改调用方的请求: 优先通过 GetBody 读取副本,
+// 否则在 Clone 的请求上放回读取的请求体.
+func readBody(req *http.Request) (*http.Request, []byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil, nil
+	}
+
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rc.Close()
+
+		body, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return req, body, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cloned := req.Clone(req.Context())
+	cloned.Body = ioutil.NopCloser(bytes.NewReader(body))
+	cloned.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return cloned, body, nil
+}
+
+// normalizeBody json 按 key 排序, 表单按字段排序, 其他去掉首尾空白.
+func normalizeBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	if strings.Contains(contentType, "json") {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			normalized, _ := json.Marshal(v)
+			return string(normalized)
+		}
+	}
+
+	if strings.Contains(contentType, "x-www-form-urlencoded") {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return values.Encode()
+		}
+	}
+
+	return strings.TrimSpace(string(body))
+}
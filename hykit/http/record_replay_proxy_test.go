@@ -0,0 +1,126 @@
+package http
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplayProxy_RecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("echo:" + string(body)))
+	}))
+
+	file := filepath.Join(t.TempDir(), "golden", "echo.json")
+
+	recorder := NewRecordReplayProxy(
+		RecordReplayProxyOptions{}.WithMode(ModeRecord),
+		RecordReplayProxyOptions{}.WithFile(file),
+		RecordReplayProxyOptions{}.WithLogger(logger),
+	)
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithProxy(func() interface{} { return recorder }),
+	)
+
+	resp, err := client.Client.R().
+		SetHeader("Authorization", "Bearer token").
+		SetHeader("Content-Type", "application/json").
+		SetBody(`{"b":2,"a":1}`).
+		Post(server.URL + "/echo")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode())
+	assert.Equal(t, `echo:{"b":2,"a":1}`, resp.String())
+	server.Close()
+
+	content, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(string(content), "Bearer token"))
+	assert.False(t, strings.Contains(string(content), "session=secret"))
+
+	replayer := NewRecordReplayProxy(
+		RecordReplayProxyOptions{}.WithFile(file),
+		RecordReplayProxyOptions{}.WithLogger(logger),
+	)
+
+	client = NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithProxy(func() interface{} { return replayer }),
+	)
+
+	// json 字段顺序不同也能匹配
+	resp, err = client.Client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(`{"a":1, "b":2}`).
+		Post(server.URL + "/echo")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode())
+	assert.Equal(t, `echo:{"b":2,"a":1}`, resp.String())
+
+	_, err = client.Client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(`{"a":2}`).
+		Post(server.URL + "/echo")
+	assert.True(t, errors.Is(err, ErrNoRecordedResponse))
+}
+
+type bodyRecorder struct {
+	body string
+}
+
+func (br *bodyRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _ := ioutil.ReadAll(req.Body)
+	br.body = string(body)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestReadBody_NotModifyRequest(t *testing.T) {
+	next := &bodyRecorder{}
+	recorder := NewRecordReplayProxy(
+		RecordReplayProxyOptions{}.WithMode(ModeRecord),
+		RecordReplayProxyOptions{}.WithFile(filepath.Join(t.TempDir(), "body.json")),
+		RecordReplayProxyOptions{}.WithLogger(logger),
+	)
+	recorder.NextProxy(next)
+
+	// 有 GetBody 时从副本读取, 不读调用方的 Body
+	req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1/echo", strings.NewReader("a=1"))
+	assert.Nil(t, err)
+	body := req.Body
+	_, err = recorder.RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "a=1", next.body)
+	assert.Equal(t, body, req.Body)
+
+	// 没有 GetBody 时在 Clone 的请求上放回请求体
+	req, err = http.NewRequest(http.MethodPost, "http://127.0.0.1/echo",
+		ioutil.NopCloser(strings.NewReader("b=2")))
+	assert.Nil(t, err)
+	assert.Nil(t, req.GetBody)
+	body = req.Body
+	_, err = recorder.RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "b=2", next.body)
+	assert.Equal(t, body, req.Body)
+	assert.Nil(t, req.GetBody)
+}
+
+func TestNormalizeBody(t *testing.T) {
+	assert.Equal(t, `{"a":1,"b":[1,2]}`,
+		normalizeBody("application/json; charset=utf-8", []byte(`{"b":[1,2], "a":1}`)))
+	assert.Equal(t, "a=1&b=2",
+		normalizeBody("application/x-www-form-urlencoded", []byte("b=2&a=1")))
+	assert.Equal(t, "plain", normalizeBody("text/plain", []byte(" plain\n")))
+	assert.Equal(t, "", normalizeBody("application/json", nil))
+}
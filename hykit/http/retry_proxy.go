@@ -0,0 +1,290 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cast"
+)
+
+// IdempotencyKeyHeader 带该请求头的非幂等请求(POST/PATCH)也会重试, 每次重试都原样转发给上游去重.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryProxy 幂等请求失败时按指数退避重试, 重试等待不会超过 ctx 的 deadline.
+// 每次请求的超时由剩余时间平分给剩余的请求次数, 单次慢请求不会用完全部预算.
+type RetryProxy struct {
+	nextTransport http.RoundTripper
+
+	logger log.Logger
+
+	conf config.Config
+
+	name string
+
+	maxRetries int
+
+	backoff time.Duration
+
+	maxBackoff time.Duration
+
+	// 单次请求的超时上限, 0 时只按剩余时间平分
+	attemptTimeout time.Duration
+
+	retryStatus map[int]struct{}
+}
+
+type RetryProxyOption func(c *RetryProxy)
+
+type RetryProxyOptions struct{}
+
+func NewRetryProxy(options ...RetryProxyOption) *RetryProxy {
+	rp := &RetryProxy{}
+
+	for _, option := range options {
+		option(rp)
+	}
+
+	if rp.conf == nil {
+		rp.conf = config.NewNullConfig()
+	}
+
+	if rp.logger == nil {
+		rp.logger = log.NewLogger()
+	}
+
+	// 未配置时默认重试 2 次, 配置为 0 时不重试
+	rp.maxRetries = 2
+	if rp.conf.Get("http_client_retry_max") != nil {
+		rp.maxRetries = rp.conf.GetInt("http_client_retry_max")
+	}
+	if rp.maxRetries < 0 {
+		rp.maxRetries = 0
+	}
+
+	rp.backoff = time.Duration(rp.conf.GetInt64("http_client_retry_backoff")) * time.Millisecond
+	if rp.backoff == 0 {
+		rp.backoff = 100 * time.Millisecond
+	}
+
+	rp.maxBackoff = time.Duration(rp.conf.GetInt64("http_client_retry_max_backoff")) * time.Millisecond
+	if rp.maxBackoff == 0 {
+		rp.maxBackoff = 2 * time.Second
+	}
+
+	rp.attemptTimeout = time.Duration(rp.conf.GetInt64("http_client_retry_attempt_timeout")) * time.Millisecond
+
+	rp.retryStatus = make(map[int]struct{})
+	retryStatus := rp.conf.GetStringSlice("http_client_retry_status")
+	if len(retryStatus) == 0 {
+		retryStatus = []string{"502", "503", "504"}
+	}
+	for _, status := range retryStatus {
+		rp.retryStatus[cast.ToInt(status)] = struct{}{}
+	}
+
+	rp.name = "retry_proxy"
+
+	return rp
+}
+
+func (RetryProxyOptions) WithConf(conf config.Config) RetryProxyOption {
+	return func(rp *RetryProxy) {
+		rp.conf = conf
+	}
+}
+
+func (RetryProxyOptions) WithLogger(logger log.Logger) RetryProxyOption {
+	return func(rp *RetryProxy) {
+		rp.logger = logger
+	}
+}
+
+func (rp *RetryProxy) NextProxy(tripper interface{}) {
+	rp.nextTransport = tripper.(http.RoundTripper)
+}
+
+func (rp *RetryProxy) ProxyName() string {
+	return rp.name
+}
+
+// RoundTrip implements the RoundTripper interface.
+func (rp *RetryProxy) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rp.nextTransport == nil {
+		rp.nextTransport = http.DefaultTransport
+	}
+
+	retryable := rp.retryable(req)
+
+	if !retryable {
+		return rp.nextTransport.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := rp.attemptContext(ctx, attempt)
+
+		attemptReq := req.WithContext(attemptCtx)
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			attemptReq = req.Clone(attemptCtx)
+			attemptReq.Body = body
+		}
+
+		resp, err := rp.nextTransport.RoundTrip(attemptReq)
+
+		reason := rp.retryReason(ctx, attemptCtx, resp, err)
+		if reason == "" || attempt >= rp.maxRetries {
+			return withCancel(resp, cancel), err
+		}
+
+		wait := rp.backoffDuration(attempt + 1)
+		if !rp.withinBudget(ctx, wait) {
+			rp.logger.Warnc(ctx, "http retry %s %s : deadline budget exhausted after %d attempts",
+				req.Method, req.URL.String(), attempt+1)
+			return withCancel(resp, cancel), err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		cancel()
+
+		httpRetryTotal.With(prometheus.Labels{"host": req.URL.Host, "reason": reason}).Inc()
+		rp.logger.Warnc(ctx, "http retry %s %s [%d] after %s : %s",
+			req.Method, req.URL.String(), attempt+1, wait.String(), reason)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attemptContext 剩余时间平分给剩余的请求次数, 配置了 http_client_retry_attempt_timeout 时取较小值.
+func (rp *RetryProxy) attemptContext(ctx context.Context,
+	attempt int) (context.Context, context.CancelFunc) {
+	timeout := rp.attemptTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		share := time.Until(deadline) / time.Duration(rp.maxRetries-attempt+1)
+		if timeout == 0 || share < timeout {
+			timeout = share
+		}
+	}
+
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// cancelBody 读完响应体之后再取消单次请求的 ctx.
+type cancelBody struct {
+	io.ReadCloser
+
+	cancel context.CancelFunc
+}
+
+func (cb *cancelBody) Close() error {
+	err := cb.ReadCloser.Close()
+	cb.cancel()
+	return err
+}
+
+func withCancel(resp *http.Response, cancel context.CancelFunc) *http.Response {
+	if resp == nil || resp.Body == nil {
+		cancel()
+		return resp
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp
+}
+
+// retryable 幂等方法, 或者带 Idempotency-Key 的请求, 请求体必须可以重放.
+func (rp *RetryProxy) retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+func (rp *RetryProxy) retryReason(ctx, attemptCtx context.Context,
+	resp *http.Response, err error) string {
+	if err != nil {
+		// 调用方取消或超时不再重试
+		if ctx.Err() != nil {
+			return ""
+		}
+
+		// 单次请求超时, 剩余时间留给下一次
+		if attemptCtx.Err() != nil {
+			return "timeout"
+		}
+
+		if errors.Is(err, context.Canceled) ||
+			errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrCircuitOpen) {
+			return ""
+		}
+		return "error"
+	}
+
+	if _, ok := rp.retryStatus[resp.StatusCode]; ok {
+		return cast.ToString(resp.StatusCode)
+	}
+
+	return ""
+}
+
+// backoffDuration 第 attempt 次重试前的等待时间, 在 [d/2, d] 内随机抖动.
+func (rp *RetryProxy) backoffDuration(attempt int) time.Duration {
+	d := rp.backoff
+	for i := 1; i < attempt && d < rp.maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > rp.maxBackoff {
+		d = rp.maxBackoff
+	}
+
+	half := int64(d / 2)
+	if half == 0 {
+		return d
+	}
+
+	//nolint:gosec
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// withinBudget 等待之后至少还要留出与等待时间相同的时间发起请求.
+func (rp *RetryProxy) withinBudget(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return true
+	}
+
+	return time.Until(deadline) > 2*wait
+}
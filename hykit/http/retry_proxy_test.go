@@ -0,0 +1,169 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFlakyServer(failures int32) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("pong"))
+	}))
+
+	return server, &calls
+}
+
+func newRetryClient() *Client {
+	memConfig := config.NewMemConfig()
+	memConfig.Set("http_client_retry_max", 2)
+	memConfig.Set("http_client_retry_backoff", 10)
+
+	clientOptions := ClientOptions{}
+	return NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithProxy(func() interface{} {
+			return NewRetryProxy(RetryProxyOptions{}.WithConf(memConfig),
+				RetryProxyOptions{}.WithLogger(logger))
+		}),
+	)
+}
+
+func TestRetryProxy_Idempotent(t *testing.T) {
+	server, calls := newFlakyServer(2)
+	defer server.Close()
+
+	resp, err := newRetryClient().Client.R().Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", resp.String())
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestRetryProxy_Disabled(t *testing.T) {
+	server, calls := newFlakyServer(1)
+	defer server.Close()
+
+	memConfig := config.NewMemConfig()
+	memConfig.Set("http_client_retry_max", 0)
+	assert.Equal(t, 0, NewRetryProxy(RetryProxyOptions{}.WithConf(memConfig)).maxRetries)
+	assert.Equal(t, 2, NewRetryProxy().maxRetries)
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithProxy(func() interface{} {
+			return NewRetryProxy(RetryProxyOptions{}.WithConf(memConfig),
+				RetryProxyOptions{}.WithLogger(logger))
+		}),
+	)
+
+	resp, err := client.Client.R().Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestRetryProxy_Post(t *testing.T) {
+	server, calls := newFlakyServer(1)
+	defer server.Close()
+
+	client := newRetryClient()
+
+	resp, err := client.Client.R().SetBody("a=1").Post(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	resp, err = client.Client.R().SetHeader(IdempotencyKeyHeader, "order-1").
+		SetBody("a=1").Post(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", resp.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestRetryProxy_DeadlineBudget(t *testing.T) {
+	server, calls := newFlakyServer(5)
+	defer server.Close()
+
+	memConfig := config.NewMemConfig()
+	memConfig.Set("http_client_retry_max", 5)
+	memConfig.Set("http_client_retry_backoff", 200)
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithProxy(func() interface{} {
+			return NewRetryProxy(RetryProxyOptions{}.WithConf(memConfig),
+				RetryProxyOptions{}.WithLogger(logger))
+		}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	resp, err := client.Client.R().SetContext(ctx).Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestRetryProxy_AttemptTimeout(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次请求比整个预算还慢
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte("pong"))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := newRetryClient().Client.R().SetContext(ctx).Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", resp.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	// 3 次请求平分 1s, 第一次在 1/3 左右超时
+	assert.True(t, time.Since(start) < 800*time.Millisecond)
+}
+
+func TestRetryProxy_ForwardIdempotencyKey(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+		if len(keys) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("pong"))
+	}))
+	defer server.Close()
+
+	client := newRetryClient()
+
+	resp, err := client.Client.R().SetHeader(IdempotencyKeyHeader, "order-1").
+		SetBody("a=1").Post(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	// 每次重试都带相同的 key, 上游据此去重
+	assert.Equal(t, []string{"order-1", "order-1", "order-1"}, keys)
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"code.jshyjdtech.com/godev/hykit/pkg/security"
+)
+
+// SignProxy 按字段名排序拼接请求参数后签名, 签名放到 signField 字段, 设置了 signHeader 时放到请求头.
+// 有请求体时签名 json 或表单字段, 否则签名 query 参数.
+type SignProxy struct {
+	nextTransport http.RoundTripper
+
+	logger log.Logger
+
+	name string
+
+	signer security.Signer
+
+	signField string
+
+	signHeader string
+}
+
+type SignProxyOption func(c *SignProxy)
+
+type SignProxyOptions struct{}
+
+func NewSignProxy(options ...SignProxyOption) *SignProxy {
+	sp := &SignProxy{}
+
+	for _, option := range options {
+		option(sp)
+	}
+
+	if sp.logger == nil {
+		sp.logger = log.NewLogger()
+	}
+
+	if sp.signer == nil {
+		sp.logger.Panicf("sign proxy signer is nil")
+	}
+
+	if sp.signField == "" {
+		sp.signField = "signature"
+	}
+
+	sp.name = "sign_proxy"
+
+	return sp
+}
+
+func (SignProxyOptions) WithLogger(logger log.Logger) SignProxyOption {
+	return func(sp *SignProxy) {
+		sp.logger = logger
+	}
+}
+
+// WithSigner e.g. security.NewRSASigner(cert, security.SHA256WithRSA) 或者 *security.ECDSACert.
+func (SignProxyOptions) WithSigner(signer security.Signer) SignProxyOption {
+	return func(sp *SignProxy) {
+		sp.signer = signer
+	}
+}
+
+// WithSignField 签名字段, 默认 signature.
+func (SignProxyOptions) WithSignField(signField string) SignProxyOption {
+	return func(sp *SignProxy) {
+		sp.signField = signField
+	}
+}
+
+// WithSignHeader 签名放到请求头, 不修改请求体.
+func (SignProxyOptions) WithSignHeader(signHeader string) SignProxyOption {
+	return func(sp *SignProxy) {
+		sp.signHeader = signHeader
+	}
+}
+
+func (sp *SignProxy) NextProxy(tripper interface{}) {
+	sp.nextTransport = tripper.(http.RoundTripper)
+}
+
+func (sp *SignProxy) ProxyName() string {
+	return sp.name
+}
+
+// RoundTrip implements the RoundTripper interface.
+func (sp *SignProxy) RoundTrip(req *http.Request) (*http.Response, error) {
+	if sp.nextTransport == nil {
+		sp.nextTransport = http.DefaultTransport
+	}
+
+	req, body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := req.Header.Get("Content-Type")
+
+	var fields map[string]string
+	if len(body) > 0 {
+		fields, err = security.SignFields(contentType, body)
+	} else {
+		fields, err = security.SignFields("", []byte(req.URL.RawQuery))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := security.SignBase64(sp.signer, security.SignBuffer(fields, sp.signField))
+	if err != nil {
+		sp.logger.Errorc(req.Context(), "sign %s : %s", req.URL.String(), err.Error())
+		return nil, err
+	}
+
+	// 不修改调用方的请求
+	req = req.Clone(req.Context())
+	if sp.signHeader != "" {
+		req.Header.Set(sp.signHeader, signature)
+		if len(body) > 0 {
+			setBody(req, body)
+		}
+		return sp.nextTransport.RoundTrip(req)
+	}
+
+	if len(body) == 0 {
+		query := req.URL.Query()
+		query.Set(sp.signField, signature)
+		req.URL.RawQuery = query.Encode()
+		return sp.nextTransport.RoundTrip(req)
+	}
+
+	if strings.Contains(contentType, "json") {
+		body, err = setJSONField(body, sp.signField, signature)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		values, _ := url.ParseQuery(string(body))
+		values.Set(sp.signField, signature)
+		body = []byte(values.Encode())
+	}
+	setBody(req, body)
+
+	return sp.nextTransport.RoundTrip(req)
+}
+
+func setJSONField(body []byte, field, value string) ([]byte, error) {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	raw[field] = encoded
+
+	return json.Marshal(raw)
+}
+
+func setBody(req *http.Request, body []byte) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	middleware "code.jshyjdtech.com/godev/hykit/middle-ware"
+	"code.jshyjdtech.com/godev/hykit/pkg/security"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type hmacSigner struct {
+	key []byte
+}
+
+func (hs hmacSigner) Sign(signBlock []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, hs.key)
+	mac.Write(signBlock)
+	return mac.Sum(nil), nil
+}
+
+func (hs hmacSigner) Verify(signBlock, signature []byte) error {
+	expected, _ := hs.Sign(signBlock)
+	if !hmac.Equal(expected, signature) {
+		return security.ErrInvalidSignature
+	}
+	return nil
+}
+
+func newSignServer(signer security.Signer, options ...middleware.VerifySignOption) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	en := gin.New()
+	options = append(options, middleware.WithVerifySignLogger(logger))
+	en.Use(middleware.GinVerifySign(signer, options...))
+	en.Any("/pay", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	return httptest.NewServer(en)
+}
+
+func TestSignProxy_Verify(t *testing.T) {
+	signer := hmacSigner{key: []byte("secret")}
+	server := newSignServer(signer)
+	defer server.Close()
+
+	signProxy := NewSignProxy(SignProxyOptions{}.WithSigner(signer),
+		SignProxyOptions{}.WithLogger(logger))
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithProxy(func() interface{} { return signProxy }),
+	)
+
+	resp, err := client.Client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(`{"order_no":"20221019","amount":100,"extra":{"b":1}}`).
+		Post(server.URL + "/pay")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	resp, err = client.Client.R().
+		SetFormData(map[string]string{"order_no": "20221019", "amount": "100"}).
+		Post(server.URL + "/pay")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	resp, err = client.Client.R().
+		SetQueryParam("order_no", "20221019").
+		Get(server.URL + "/pay")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	// 签名密钥不一致
+	badClient := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithProxy(func() interface{} {
+			return NewSignProxy(SignProxyOptions{}.WithSigner(hmacSigner{key: []byte("other")}),
+				SignProxyOptions{}.WithLogger(logger))
+		}),
+	)
+	resp, err = badClient.Client.R().
+		SetFormData(map[string]string{"order_no": "20221019"}).
+		Post(server.URL + "/pay")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+}
+
+func TestSignProxy_Header(t *testing.T) {
+	signer := hmacSigner{key: []byte("secret")}
+	server := newSignServer(signer, middleware.WithVerifySignHeader("X-Signature"))
+	defer server.Close()
+
+	signProxy := NewSignProxy(SignProxyOptions{}.WithSigner(signer),
+		SignProxyOptions{}.WithSignHeader("X-Signature"),
+		SignProxyOptions{}.WithLogger(logger))
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithProxy(func() interface{} { return signProxy }),
+	)
+
+	resp, err := client.Client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(`{"order_no":"20221019"}`).
+		Post(server.URL + "/pay")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	resp, err = NewClient(clientOptions.WithLogger(logger)).Client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(`{"order_no":"20221019"}`).
+		Post(server.URL + "/pay")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+}
@@ -0,0 +1,520 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"code.jshyjdtech.com/godev/hykit/pkg/security"
+	"github.com/fsnotify/fsnotify"
+	"github.com/tjfoc/gmsm/gmtls"
+	g509 "github.com/tjfoc/gmsm/x509"
+)
+
+var ErrCertPinMismatch = errors.New("server certificate fingerprint mismatch")
+
+// tlsManager 管理客户端证书、CA 和证书指纹, 文件变化时重新加载, 不需要重建 Client.
+// 国密证书通过 gmtls 建立连接.
+type tlsManager struct {
+	logger log.Logger
+
+	// 证书、私钥、CA 文件, 用于监听变化
+	files map[string]struct{}
+
+	loadCert func() (*tls.Certificate, error)
+
+	loadGMCert func() (*gmtls.Certificate, error)
+
+	caFiles []string
+
+	pins map[string]struct{}
+
+	// 校验服务端证书使用的名称, 为空时使用请求的 host
+	serverName string
+
+	insecure bool
+
+	conf *tls.Config
+
+	cert atomic.Value
+
+	gmCert atomic.Value
+
+	roots atomic.Value
+
+	gmRoots atomic.Value
+
+	watcher *fsnotify.Watcher
+}
+
+func newTLSManager() *tlsManager {
+	return &tlsManager{
+		files: make(map[string]struct{}),
+		pins:  make(map[string]struct{}),
+	}
+}
+
+func (tm *tlsManager) addFiles(files ...string) {
+	for _, file := range files {
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+		tm.files[file] = struct{}{}
+	}
+}
+
+// init 首次加载失败直接 panic, 之后加载失败保留旧的证书.
+func (tm *tlsManager) init(logger log.Logger, transport *http.Transport) {
+	tm.logger = logger
+
+	if err := tm.reload(); err != nil {
+		tm.logger.Panicf("load tls certificates : %s", err.Error())
+	}
+
+	if transport.TLSClientConfig != nil {
+		tm.insecure = transport.TLSClientConfig.InsecureSkipVerify
+	}
+
+	if tm.loadGMCert != nil {
+		transport.DialTLSContext = tm.dialGMTLS
+	} else {
+		// 经过 http 代理的连接不走 DialTLSContext, 仍使用 TLSClientConfig
+		tm.conf = tm.tlsConfig(transport.TLSClientConfig)
+		transport.TLSClientConfig = tm.conf
+		if tm.conf.VerifyConnection != nil {
+			transport.DialTLSContext = tm.dialTLS
+		}
+	}
+
+	tm.watch()
+}
+
+func (tm *tlsManager) reload() error {
+	if tm.loadCert != nil {
+		cert, err := tm.loadCert()
+		if err != nil {
+			return err
+		}
+		tm.cert.Store(cert)
+	}
+
+	if tm.loadGMCert != nil {
+		cert, err := tm.loadGMCert()
+		if err != nil {
+			return err
+		}
+		tm.gmCert.Store(cert)
+	}
+
+	if len(tm.caFiles) == 0 {
+		return nil
+	}
+
+	roots := x509.NewCertPool()
+	gmRoots := g509.NewCertPool()
+	for _, caFile := range tm.caFiles {
+		content, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+
+		if tm.loadGMCert != nil {
+			if !gmRoots.AppendCertsFromPEM(content) {
+				return fmt.Errorf("no certificate found in %s", caFile)
+			}
+		} else if !roots.AppendCertsFromPEM(content) {
+			return fmt.Errorf("no certificate found in %s", caFile)
+		}
+	}
+	tm.roots.Store(roots)
+	tm.gmRoots.Store(gmRoots)
+
+	return nil
+}
+
+// watch 监听文件所在目录, 兼容先写临时文件再 rename 和 k8s secret 的 ..data 切换.
+func (tm *tlsManager) watch() {
+	if len(tm.files) == 0 {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		tm.logger.Errorf("tls watcher : %s", err.Error())
+		return
+	}
+	tm.watcher = watcher
+
+	dirs := make(map[string]struct{})
+	for file := range tm.files {
+		dirs[filepath.Dir(file)] = struct{}{}
+	}
+
+	for dir := range dirs {
+		if err = watcher.Add(dir); err != nil {
+			tm.logger.Errorf("tls watch %s : %s", dir, err.Error())
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				_, isCertFile := tm.files[filepath.Clean(event.Name)]
+				if !isCertFile && filepath.Base(event.Name) != "..data" {
+					continue
+				}
+
+				if err := tm.reload(); err != nil {
+					tm.logger.Errorf("reload tls certificates : %s", err.Error())
+					continue
+				}
+				tm.logger.Infof("reload tls certificates by %s", event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				tm.logger.Errorf("tls watcher : %s", err.Error())
+			}
+		}
+	}()
+}
+
+func (tm *tlsManager) close() {
+	if tm.watcher != nil {
+		_ = tm.watcher.Close()
+	}
+}
+
+func (tm *tlsManager) tlsConfig(base *tls.Config) *tls.Config {
+	var conf *tls.Config
+	if base != nil {
+		conf = base.Clone()
+	} else {
+		conf = &tls.Config{}
+	}
+
+	if tm.loadCert != nil {
+		conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return tm.cert.Load().(*tls.Certificate), nil
+		}
+	}
+
+	if len(tm.caFiles) > 0 {
+		// CA 需要热加载, 跳过默认校验, 在 VerifyConnection 中使用当前的 CA 校验
+		conf.InsecureSkipVerify = true
+	}
+
+	if tm.serverName != "" {
+		conf.ServerName = tm.serverName
+	}
+
+	if len(tm.caFiles) > 0 || len(tm.pins) > 0 {
+		conf.VerifyConnection = func(cs tls.ConnectionState) error {
+			// 连接 IP 时不发送 SNI, cs.ServerName 为空
+			return tm.verifyConnection(cs.ServerName, cs)
+		}
+	}
+
+	return conf
+}
+
+// dialTLS 使用配置的 ServerName 或请求的 host 校验证书, IP 地址与证书中的 IP SAN 比较.
+func (tm *tlsManager) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	rawConn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	serverName := tm.serverName
+	if serverName == "" {
+		serverName, _, err = net.SplitHostPort(addr)
+		if err != nil {
+			serverName = addr
+		}
+	}
+
+	conf := tm.conf.Clone()
+	conf.ServerName = serverName
+	conf.VerifyConnection = func(cs tls.ConnectionState) error {
+		return tm.verifyConnection(serverName, cs)
+	}
+
+	conn := tls.Client(rawConn, conf)
+	if err = conn.HandshakeContext(ctx); err != nil {
+		_ = rawConn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (tm *tlsManager) verifyConnection(serverName string, cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+
+	if len(tm.caFiles) > 0 && !tm.insecure {
+		if serverName == "" {
+			return errors.New("no server name to verify the certificate")
+		}
+
+		opts := x509.VerifyOptions{
+			DNSName:       serverName,
+			Roots:         tm.roots.Load().(*x509.CertPool),
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+			return err
+		}
+	}
+
+	rawCerts := make([][]byte, 0, len(cs.PeerCertificates))
+	for _, cert := range cs.PeerCertificates {
+		rawCerts = append(rawCerts, cert.Raw)
+	}
+
+	return tm.verifyPins(rawCerts)
+}
+
+// verifyPins 证书链中任意一张证书的 sha256 指纹匹配即可.
+func (tm *tlsManager) verifyPins(rawCerts [][]byte) error {
+	if len(tm.pins) == 0 {
+		return nil
+	}
+
+	for _, raw := range rawCerts {
+		if _, ok := tm.pins[certFingerprint(raw)]; ok {
+			return nil
+		}
+	}
+
+	return ErrCertPinMismatch
+}
+
+func (tm *tlsManager) gmConfig(serverName string) *gmtls.Config {
+	conf := &gmtls.Config{
+		GMSupport:          gmtls.NewGMSupport(),
+		ServerName:         serverName,
+		InsecureSkipVerify: tm.insecure || len(tm.caFiles) > 0,
+		GetClientCertificate: func(*gmtls.CertificateRequestInfo) (*gmtls.Certificate, error) {
+			return tm.gmCert.Load().(*gmtls.Certificate), nil
+		},
+	}
+
+	conf.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*g509.Certificate) error {
+		if len(tm.caFiles) > 0 && !tm.insecure {
+			if err := tm.verifyGMChain(serverName, rawCerts); err != nil {
+				return err
+			}
+		}
+
+		return tm.verifyPins(rawCerts)
+	}
+
+	return conf
+}
+
+func (tm *tlsManager) verifyGMChain(serverName string, rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no server certificate")
+	}
+
+	certs := make([]*g509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := g509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	opts := g509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         tm.gmRoots.Load().(*g509.CertPool),
+		Intermediates: g509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+func (tm *tlsManager) dialGMTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	rawConn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	host := tm.serverName
+	if host == "" {
+		host, _, err = net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = rawConn.SetDeadline(deadline)
+	}
+
+	conn := gmtls.Client(rawConn, tm.gmConfig(host))
+	if err = conn.Handshake(); err != nil {
+		_ = rawConn.Close()
+		return nil, err
+	}
+	_ = rawConn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// certFingerprint 证书 DER 编码的 sha256, 小写十六进制.
+func certFingerprint(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func loadPFXCert(pfxFile, password string) (*tls.Certificate, error) {
+	content, err := ioutil.ReadFile(pfxFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := security.LoadCertPrivatePFX(content, password)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := cert.GetPrivateRSAKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{cert.Certificate().Raw},
+		PrivateKey:  key.PrivateKey,
+		Leaf:        cert.Certificate(),
+	}, nil
+}
+
+func loadSM2PFXCert(pfxFile, password string) (*gmtls.Certificate, error) {
+	content, err := ioutil.ReadFile(pfxFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := security.LoadECDSACertPrivatePFX(content, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gmtls.Certificate{
+		Certificate: [][]byte{cert.RawCertificate()},
+		PrivateKey:  cert.PrivateKey(),
+	}, nil
+}
+
+func (hc *Client) getTLSManager() *tlsManager {
+	if hc.tls == nil {
+		hc.tls = newTLSManager()
+	}
+
+	return hc.tls
+}
+
+// WithClientCertPEM 双向认证客户端证书, PEM 格式.
+func (ClientOptions) WithClientCertPEM(certFile, keyFile string) Options {
+	return func(hc *Client) {
+		tm := hc.getTLSManager()
+		tm.addFiles(certFile, keyFile)
+		tm.loadCert = func() (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			return &cert, err
+		}
+	}
+}
+
+// WithClientCertPFX 双向认证客户端证书, PFX 格式, 仅支持 RSA 私钥.
+func (ClientOptions) WithClientCertPFX(pfxFile, password string) Options {
+	return func(hc *Client) {
+		tm := hc.getTLSManager()
+		tm.addFiles(pfxFile)
+		tm.loadCert = func() (*tls.Certificate, error) {
+			return loadPFXCert(pfxFile, password)
+		}
+	}
+}
+
+// WithSM2ClientCertPEM 国密双向认证客户端证书, 使用 GMSSL 协议建立连接.
+func (ClientOptions) WithSM2ClientCertPEM(certFile, keyFile string) Options {
+	return func(hc *Client) {
+		tm := hc.getTLSManager()
+		tm.addFiles(certFile, keyFile)
+		tm.loadGMCert = func() (*gmtls.Certificate, error) {
+			cert, err := gmtls.LoadX509KeyPair(certFile, keyFile)
+			return &cert, err
+		}
+	}
+}
+
+// WithSM2ClientCertPFX 国密双向认证客户端证书, PFX 格式.
+func (ClientOptions) WithSM2ClientCertPFX(pfxFile, password string) Options {
+	return func(hc *Client) {
+		tm := hc.getTLSManager()
+		tm.addFiles(pfxFile)
+		tm.loadGMCert = func() (*gmtls.Certificate, error) {
+			return loadSM2PFXCert(pfxFile, password)
+		}
+	}
+}
+
+// WithRootCAs 校验服务端证书的 CA, 替代系统 CA.
+func (ClientOptions) WithRootCAs(caFiles ...string) Options {
+	return func(hc *Client) {
+		tm := hc.getTLSManager()
+		tm.addFiles(caFiles...)
+		tm.caFiles = append(tm.caFiles, caFiles...)
+	}
+}
+
+// WithTLSServerName 校验服务端证书使用的名称, 默认使用请求的 host.
+func (ClientOptions) WithTLSServerName(serverName string) Options {
+	return func(hc *Client) {
+		hc.getTLSManager().serverName = serverName
+	}
+}
+
+// WithPinnedCerts 服务端证书链 sha256 指纹, 十六进制, 可以带冒号.
+// e.g. WithPinnedCerts("AB:CD:...")
+func (ClientOptions) WithPinnedCerts(fingerprints ...string) Options {
+	return func(hc *Client) {
+		tm := hc.getTLSManager()
+		for _, fp := range fingerprints {
+			tm.pins[strings.ToLower(strings.ReplaceAll(fp, ":", ""))] = struct{}{}
+		}
+	}
+}
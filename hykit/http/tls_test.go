@@ -0,0 +1,257 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert sans 默认 127.0.0.1.
+func newTestCert(t *testing.T, cn string, parent *testCert, sans ...string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	if len(sans) == 0 {
+		sans = []string{"127.0.0.1"}
+	}
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			tpl.IPAddresses = append(tpl.IPAddresses, ip)
+		} else {
+			tpl.DNSNames = append(tpl.DNSNames, san)
+		}
+	}
+
+	signer, signerKey := tpl, key
+	if parent == nil {
+		tpl.IsCA = true
+		tpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (tc *testCert) write(t *testing.T, certFile, keyFile string) {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.cert.Raw})
+	assert.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+
+	if keyFile != "" {
+		keyDer, err := x509.MarshalECPrivateKey(tc.key)
+		assert.Nil(t, err)
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+		assert.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+	}
+}
+
+func (tc *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{tc.cert.Raw}, PrivateKey: tc.key, Leaf: tc.cert}
+}
+
+func newMTLSServer(ca, server *testCert) *httptest.Server {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate()},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	ts.StartTLS()
+
+	return ts
+}
+
+func TestClient_MTLSAndReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	server := newMTLSServer(ca, newTestCert(t, "server", ca))
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	ca.write(t, caFile, "")
+	newTestCert(t, "client-1", ca).write(t, certFile, keyFile)
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithDisableKeepAlive(true),
+		clientOptions.WithClientCertPEM(certFile, keyFile),
+		clientOptions.WithRootCAs(caFile),
+	)
+	defer client.Close()
+
+	resp, err := client.Client.R().Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "client-1", resp.String())
+
+	// 先写临时文件再 rename, 证书和私钥一起替换
+	next := newTestCert(t, "client-2", ca)
+	next.write(t, certFile+".tmp", keyFile+".tmp")
+	assert.Nil(t, os.Rename(keyFile+".tmp", keyFile))
+	assert.Nil(t, os.Rename(certFile+".tmp", certFile))
+
+	assert.Eventually(t, func() bool {
+		resp, err = client.Client.R().Get(server.URL)
+		return err == nil && resp.String() == "client-2"
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestClient_UnknownCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	server := newMTLSServer(ca, newTestCert(t, "server", ca))
+	defer server.Close()
+
+	otherCAFile := filepath.Join(dir, "other_ca.pem")
+	newTestCert(t, "other", nil).write(t, otherCAFile, "")
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	newTestCert(t, "client", ca).write(t, certFile, keyFile)
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithClientCertPEM(certFile, keyFile),
+		clientOptions.WithRootCAs(otherCAFile),
+	)
+	defer client.Close()
+
+	_, err := client.Client.R().Get(server.URL)
+	assert.NotNil(t, err)
+}
+
+func TestClient_ServerNameMismatch(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	// 同一个 CA 签发, 但不是给 127.0.0.1 的证书
+	server := newMTLSServer(ca, newTestCert(t, "server", ca, "10.0.0.1", "pay.internal"))
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	ca.write(t, caFile, "")
+	newTestCert(t, "client", ca).write(t, certFile, keyFile)
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithClientCertPEM(certFile, keyFile),
+		clientOptions.WithRootCAs(caFile),
+	)
+	defer client.Close()
+
+	_, err := client.Client.R().Get(server.URL)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "10.0.0.1")
+
+	nameClient := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithClientCertPEM(certFile, keyFile),
+		clientOptions.WithRootCAs(caFile),
+		clientOptions.WithTLSServerName("pay.internal"),
+	)
+	defer nameClient.Close()
+
+	resp, err := nameClient.Client.R().Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "client", resp.String())
+}
+
+func TestTLSManager_NoServerName(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.write(t, caFile, "")
+
+	tm := newTLSManager()
+	tm.caFiles = []string{caFile}
+	assert.Nil(t, tm.reload())
+
+	// 经过 http 代理连接 IP 时拿不到 host, 不能跳过证书名称校验
+	cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{newTestCert(t, "server", ca).cert}}
+	assert.NotNil(t, tm.verifyConnection("", cs))
+	assert.Nil(t, tm.verifyConnection("127.0.0.1", cs))
+	assert.NotNil(t, tm.verifyConnection("10.0.0.1", cs))
+}
+
+func TestClient_PinnedCerts(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	serverCert := newTestCert(t, "server", ca)
+	server := newMTLSServer(ca, serverCert)
+	defer server.Close()
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	newTestCert(t, "client", ca).write(t, certFile, keyFile)
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithInsecureSkip(),
+		clientOptions.WithClientCertPEM(certFile, keyFile),
+		clientOptions.WithPinnedCerts(certFingerprint(serverCert.cert.Raw)),
+	)
+	defer client.Close()
+
+	resp, err := client.Client.R().Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "client", resp.String())
+
+	client = NewClient(
+		clientOptions.WithLogger(logger),
+		clientOptions.WithInsecureSkip(),
+		clientOptions.WithClientCertPEM(certFile, keyFile),
+		clientOptions.WithPinnedCerts("AB:CD"),
+	)
+	defer client.Close()
+
+	_, err = client.Client.R().Get(server.URL)
+	assert.True(t, errors.Is(err, ErrCertPinMismatch))
+}
@@ -0,0 +1,132 @@
+package idempotent
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	"code.jshyjdtech.com/godev/hykit/errcode"
+	middleware "code.jshyjdtech.com/godev/hykit/middle-ware"
+	"github.com/gin-gonic/gin"
+)
+
+// ReplayedHeader 返回缓存的响应时添加的响应头.
+const ReplayedHeader = "Idempotent-Replayed"
+
+type recordWriter struct {
+	gin.ResponseWriter
+
+	body bytes.Buffer
+}
+
+func (w *recordWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Gin 幂等中间件, 响应状态码 >= 500 或 handler panic 时删除幂等键, 允许重试.
+// e.g.
+//
+//	en.POST("/notify/UnionJSCallback",
+//		idempotent.Gin(idempotent.NewRedisStore(redisClient), idempotent.WithFields("orderId", "txnType")),
+//		ctl.Call.UnionJSCallback)
+func Gin(store Store, options ...Option) gin.HandlerFunc {
+	idem := newIdempotent(store, options...)
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		key := c.GetHeader(idem.header)
+		if key == "" && len(idem.fields) > 0 && c.Request.Body != nil {
+			body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, idem.maxBodyBytes))
+			if err != nil {
+				idem.logger.Warnc(ctx, "idempotent read body %s : %s", c.Request.URL.Path, err.Error())
+				errcode.Fail(c, middleware.BodyReadError(err))
+				return
+			}
+			c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+			key = idem.fieldsKey(c.ContentType(), body)
+		}
+
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = c.Request.URL.Path
+		}
+		storeKey := idem.storeKey(c.Request.Method+endpoint, key)
+
+		record, err := idem.store.Acquire(ctx, storeKey, idem.lockTTL)
+		if err != nil {
+			// 存储不可用时不影响业务
+			idem.logger.Errorc(ctx, "idempotent acquire %s : %s", storeKey, err.Error())
+			c.Next()
+			return
+		}
+
+		if record != nil {
+			if record.State != StateCompleted {
+				idem.logger.Warnc(ctx, "idempotent %s : %s", storeKey, ErrInProgress.Error())
+				errcode.Fail(c, errcode.RecordDuplicate.WithDetail("%s", ErrInProgress.Error()))
+				return
+			}
+
+			idem.logger.Infoc(ctx, "idempotent %s replay", storeKey)
+			for k, v := range record.Header {
+				c.Header(k, v)
+			}
+			c.Header(ReplayedHeader, "true")
+			c.Data(record.Status, record.Header["Content-Type"], record.Body)
+			c.Abort()
+			return
+		}
+
+		w := &recordWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		idem.next(c, storeKey)
+
+		status := w.Status()
+		if status >= http.StatusInternalServerError {
+			idem.release(ctx, storeKey)
+			return
+		}
+
+		record = &Record{
+			State:  StateCompleted,
+			Status: status,
+			Header: map[string]string{"Content-Type": w.Header().Get("Content-Type")},
+			Body:   w.body.Bytes(),
+		}
+		if err = idem.store.Complete(ctx, storeKey, record, idem.ttl); err != nil {
+			idem.logger.Errorc(ctx, "idempotent complete %s : %s", storeKey, err.Error())
+		}
+	}
+}
+
+// next handler panic 时删除幂等键后继续 panic, 交给 recovery 中间件处理.
+func (idem *Idempotent) next(c *gin.Context, storeKey string) {
+	defer func() {
+		if r := recover(); r != nil {
+			idem.release(c.Request.Context(), storeKey)
+			panic(r)
+		}
+	}()
+
+	c.Next()
+}
+
+func (idem *Idempotent) release(ctx context.Context, storeKey string) {
+	if err := idem.store.Release(ctx, storeKey); err != nil {
+		idem.logger.Errorc(ctx, "idempotent release %s : %s", storeKey, err.Error())
+	}
+}
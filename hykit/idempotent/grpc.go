@@ -0,0 +1,134 @@
+package idempotent
+
+import (
+	"context"
+	"strings"
+
+	"code.jshyjdtech.com/godev/hykit/errcode"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// UnaryServerInterceptor gRPC 幂等拦截器, 幂等键从 metadata 或 WithFields 指定的请求字段(json 名称)读取.
+// handler 返回错误时删除幂等键, 允许重试, 并发的重复请求返回 errcode.RecordDuplicate(codes.AlreadyExists).
+func UnaryServerInterceptor(store Store, options ...Option) grpc.UnaryServerInterceptor {
+	idem := newIdempotent(store, options...)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		key := idem.metadataKey(ctx)
+		if key == "" {
+			key = idem.messageKey(req)
+		}
+
+		if key == "" {
+			return handler(ctx, req)
+		}
+
+		storeKey := idem.storeKey(info.FullMethod, key)
+
+		record, err := idem.store.Acquire(ctx, storeKey, idem.lockTTL)
+		if err != nil {
+			idem.logger.Errorc(ctx, "idempotent acquire %s : %s", storeKey, err.Error())
+			return handler(ctx, req)
+		}
+
+		if record != nil {
+			if record.State != StateCompleted {
+				idem.logger.Warnc(ctx, "idempotent %s : %s", storeKey, ErrInProgress.Error())
+				return nil, errcode.RecordDuplicate.WithDetail("%s", ErrInProgress.Error())
+			}
+
+			idem.logger.Infoc(ctx, "idempotent %s replay", storeKey)
+			resp, err := unmarshalResp(record.Body)
+			if err == nil {
+				_ = grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(ReplayedHeader), "true"))
+				return resp, nil
+			}
+
+			// 缓存的响应无法还原时重新处理
+			idem.logger.Errorc(ctx, "idempotent %s unmarshal : %s", storeKey, err.Error())
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			if releaseErr := idem.store.Release(ctx, storeKey); releaseErr != nil {
+				idem.logger.Errorc(ctx, "idempotent release %s : %s", storeKey, releaseErr.Error())
+			}
+			return resp, err
+		}
+
+		body, marshalErr := marshalResp(resp)
+		if marshalErr != nil {
+			idem.logger.Errorc(ctx, "idempotent %s marshal : %s", storeKey, marshalErr.Error())
+			if releaseErr := idem.store.Release(ctx, storeKey); releaseErr != nil {
+				idem.logger.Errorc(ctx, "idempotent release %s : %s", storeKey, releaseErr.Error())
+			}
+			return resp, nil
+		}
+
+		record = &Record{State: StateCompleted, Body: body}
+		if completeErr := idem.store.Complete(ctx, storeKey, record, idem.ttl); completeErr != nil {
+			idem.logger.Errorc(ctx, "idempotent complete %s : %s", storeKey, completeErr.Error())
+		}
+
+		return resp, nil
+	}
+}
+
+func (idem *Idempotent) metadataKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(idem.header)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func (idem *Idempotent) messageKey(req interface{}) string {
+	msg, ok := req.(proto.Message)
+	if !ok || len(idem.fields) == 0 {
+		return ""
+	}
+
+	body, err := protojson.Marshal(msg)
+	if err != nil {
+		return ""
+	}
+
+	return idem.fieldsKey("application/json", body)
+}
+
+// marshalResp 使用 Any 保存响应的类型, 拦截器中不知道具体的响应类型.
+func marshalResp(resp interface{}) ([]byte, error) {
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "%T is not a proto.Message", resp)
+	}
+
+	anyResp, err := anypb.New(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(anyResp)
+}
+
+func unmarshalResp(body []byte) (proto.Message, error) {
+	anyResp := &anypb.Any{}
+	if err := proto.Unmarshal(body, anyResp); err != nil {
+		return nil, err
+	}
+
+	return anyResp.UnmarshalNew()
+}
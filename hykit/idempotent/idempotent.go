@@ -0,0 +1,147 @@
+package idempotent
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"code.jshyjdtech.com/godev/hykit/pkg/security"
+)
+
+// ErrInProgress 相同幂等键的请求正在处理.
+var ErrInProgress = errors.New("request with the same idempotency key is in progress")
+
+// Idempotent 按幂等键缓存响应, 重复的请求直接返回缓存的响应,
+// 并发的重复请求返回 errcode.RecordDuplicate(409 或 codes.AlreadyExists).
+type Idempotent struct {
+	store Store
+
+	logger log.Logger
+
+	header string
+
+	fields []string
+
+	prefix string
+
+	// 完成后缓存响应的时间
+	ttl time.Duration
+
+	// 处理中状态的过期时间, 防止进程退出后幂等键一直处于处理中
+	lockTTL time.Duration
+
+	// 从报文字段取幂等键时最多读取的字节数
+	maxBodyBytes int64
+}
+
+type Option func(*Idempotent)
+
+func newIdempotent(store Store, options ...Option) *Idempotent {
+	idem := &Idempotent{store: store}
+
+	for _, option := range options {
+		option(idem)
+	}
+
+	if idem.logger == nil {
+		idem.logger = log.NewLogger()
+	}
+
+	if idem.header == "" {
+		idem.header = "Idempotency-Key"
+	}
+
+	if idem.prefix == "" {
+		idem.prefix = "idempotent:"
+	}
+
+	if idem.ttl == 0 {
+		idem.ttl = 24 * time.Hour
+	}
+
+	if idem.lockTTL == 0 {
+		idem.lockTTL = 30 * time.Second
+	}
+
+	if idem.maxBodyBytes <= 0 {
+		idem.maxBodyBytes = 1 << 20
+	}
+
+	return idem
+}
+
+func WithLogger(logger log.Logger) Option {
+	return func(idem *Idempotent) {
+		idem.logger = logger
+	}
+}
+
+// WithHeader 读取幂等键的请求头或 metadata, 默认 Idempotency-Key.
+func WithHeader(header string) Option {
+	return func(idem *Idempotent) {
+		idem.header = header
+	}
+}
+
+// WithFields 请求头中没有幂等键时, 使用报文字段组合, e.g. WithFields("orderId", "txnType").
+func WithFields(fields ...string) Option {
+	return func(idem *Idempotent) {
+		idem.fields = fields
+	}
+}
+
+// WithPrefix redis key 前缀, 默认 idempotent: .
+func WithPrefix(prefix string) Option {
+	return func(idem *Idempotent) {
+		idem.prefix = prefix
+	}
+}
+
+// WithTTL 缓存响应的时间, 默认 24 小时.
+func WithTTL(ttl time.Duration) Option {
+	return func(idem *Idempotent) {
+		idem.ttl = ttl
+	}
+}
+
+// WithLockTTL 处理中状态的过期时间, 默认 30 秒, 应大于接口的处理时间.
+func WithLockTTL(lockTTL time.Duration) Option {
+	return func(idem *Idempotent) {
+		idem.lockTTL = lockTTL
+	}
+}
+
+// WithMaxBodyBytes 从报文字段取幂等键时最多读取的字节数, 默认 1MB, 超过返回 413.
+func WithMaxBodyBytes(maxBodyBytes int64) Option {
+	return func(idem *Idempotent) {
+		idem.maxBodyBytes = maxBodyBytes
+	}
+}
+
+// fieldsKey 报文字段组合的幂等键, 任一字段为空时返回空.
+func (idem *Idempotent) fieldsKey(contentType string, body []byte) string {
+	if len(idem.fields) == 0 || len(body) == 0 {
+		return ""
+	}
+
+	fields, err := security.SignFields(contentType, body)
+	if err != nil {
+		return ""
+	}
+
+	values := make([]string, 0, len(idem.fields))
+	for _, field := range idem.fields {
+		if fields[field] == "" {
+			return ""
+		}
+		values = append(values, fields[field])
+	}
+
+	return strings.Join(values, ":")
+}
+
+// storeKey 加上前缀和接口, 不同接口的幂等键互不影响.
+func (idem *Idempotent) storeKey(endpoint, key string) string {
+	return idem.prefix + endpoint + ":" + key
+}
@@ -0,0 +1,378 @@
+package idempotent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/errcode"
+	"code.jshyjdtech.com/godev/hykit/log"
+	"code.jshyjdtech.com/godev/hykit/redis"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var logger = log.NewLogger()
+
+func newRouter(store Store, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/notify/callback",
+		Gin(store, WithLogger(logger), WithFields("orderId", "txnType")), handler)
+
+	return router
+}
+
+func postForm(router *gin.Engine, form url.Values, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/notify/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestGin_Replay(t *testing.T) {
+	var calls int32
+	router := newRouter(NewMemStore(), func(c *gin.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		c.String(http.StatusOK, "SUCCESS %d %s", n, c.PostForm("orderId"))
+	})
+
+	form := url.Values{"orderId": {"202210190001"}, "txnType": {"01"}}
+
+	w := postForm(router, form, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "SUCCESS 1 202210190001", w.Body.String())
+
+	w = postForm(router, form, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "SUCCESS 1 202210190001", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get(ReplayedHeader))
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+
+	// 不同的交易类型
+	form.Set("txnType", "04")
+	w = postForm(router, form, nil)
+	assert.Equal(t, "SUCCESS 2 202210190001", w.Body.String())
+
+	// 没有幂等键时不处理
+	w = postForm(router, url.Values{"txnType": {"01"}}, nil)
+	assert.Equal(t, "SUCCESS 3 ", w.Body.String())
+	w = postForm(router, url.Values{"txnType": {"01"}}, nil)
+	assert.Equal(t, "SUCCESS 4 ", w.Body.String())
+
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestGin_Header(t *testing.T) {
+	var calls int32
+	router := newRouter(NewMemStore(), func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.JSON(http.StatusCreated, gin.H{"id": 1})
+	})
+
+	header := map[string]string{"Idempotency-Key": "abc"}
+	w := postForm(router, url.Values{}, header)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = postForm(router, url.Values{}, header)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"id":1}`, w.Body.String())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGin_Conflict(t *testing.T) {
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	router := newRouter(NewMemStore(), func(c *gin.Context) {
+		close(started)
+		<-finish
+		c.String(http.StatusOK, "SUCCESS")
+	})
+
+	form := url.Values{"orderId": {"1"}, "txnType": {"01"}}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- postForm(router, form, nil)
+	}()
+
+	<-started
+	w := postForm(router, form, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"RECORDDUPLICATE"`)
+
+	close(finish)
+	assert.Equal(t, http.StatusOK, (<-done).Code)
+}
+
+func TestGin_ReleaseOnServerError(t *testing.T) {
+	var calls int32
+	router := newRouter(NewMemStore(), func(c *gin.Context) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			c.String(http.StatusBadGateway, "")
+			return
+		}
+		c.String(http.StatusOK, "SUCCESS")
+	})
+
+	form := url.Values{"orderId": {"1"}, "txnType": {"01"}}
+
+	assert.Equal(t, http.StatusBadGateway, postForm(router, form, nil).Code)
+	assert.Equal(t, http.StatusOK, postForm(router, form, nil).Code)
+	assert.Equal(t, http.StatusOK, postForm(router, form, nil).Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestGin_ReleaseOnPanic(t *testing.T) {
+	var calls int32
+	router := newRouter(NewMemStore(), func(c *gin.Context) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("db down")
+		}
+		c.String(http.StatusOK, "SUCCESS")
+	})
+
+	form := url.Values{"orderId": {"1"}, "txnType": {"01"}}
+
+	assert.Panics(t, func() { postForm(router, form, nil) })
+	assert.Equal(t, http.StatusOK, postForm(router, form, nil).Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestGin_BodyTooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/notify/callback",
+		Gin(NewMemStore(), WithLogger(logger), WithFields("orderId"), WithMaxBodyBytes(16)),
+		func(c *gin.Context) {
+			c.String(http.StatusOK, "SUCCESS")
+		})
+
+	w := postForm(router, url.Values{"orderId": {strings.Repeat("1", 32)}}, nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"BODY_TOO_LARGE"`)
+}
+
+type fakeRedisEntry struct {
+	value []byte
+
+	expireAt time.Time
+}
+
+// fakeRedis 支持 Store 用到的 SET NX PX、GET、DEL.
+type fakeRedis struct {
+	redis.DummyContextConn
+
+	mu sync.Mutex
+
+	entries map[string]fakeRedisEntry
+
+	commands []string
+}
+
+func (fr *fakeRedis) Do(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.commands = append(fr.commands, commandName)
+	key := args[0].(string)
+	entry, ok := fr.entries[key]
+	if ok && !time.Now().Before(entry.expireAt) {
+		delete(fr.entries, key)
+		ok = false
+	}
+
+	switch commandName {
+	case "SET":
+		var nx bool
+		var px int64
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "NX":
+				nx = true
+			case "PX":
+				px = args[i+1].(int64)
+				i++
+			}
+		}
+		if nx && ok {
+			return nil, nil
+		}
+		fr.entries[key] = fakeRedisEntry{
+			value:    args[1].([]byte),
+			expireAt: time.Now().Add(time.Duration(px) * time.Millisecond),
+		}
+		return "OK", nil
+	case "GET":
+		if !ok {
+			return nil, nil
+		}
+		return entry.value, nil
+	case "DEL":
+		if !ok {
+			return int64(0), nil
+		}
+		delete(fr.entries, key)
+		return int64(1), nil
+	}
+
+	return nil, fmt.Errorf("unsupported command %s", commandName)
+}
+
+func newFakeRedisStore() (Store, *fakeRedis) {
+	fr := &fakeRedis{entries: make(map[string]fakeRedisEntry)}
+	return &redisStore{getConn: func() redis.ContextConn { return fr }}, fr
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	store, fr := newFakeRedisStore()
+
+	record, err := store.Acquire(ctx, "k", time.Minute)
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+
+	record, err = store.Acquire(ctx, "k", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, StateProcessing, record.State)
+
+	assert.Nil(t, store.Complete(ctx, "k", &Record{
+		State:  StateCompleted,
+		Status: http.StatusOK,
+		Header: map[string]string{"Content-Type": "text/plain"},
+		Body:   []byte("SUCCESS"),
+	}, time.Minute))
+
+	record, err = store.Acquire(ctx, "k", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, StateCompleted, record.State)
+	assert.Equal(t, http.StatusOK, record.Status)
+	assert.Equal(t, "SUCCESS", string(record.Body))
+
+	assert.Nil(t, store.Release(ctx, "k"))
+	record, err = store.Acquire(ctx, "k", 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+
+	// 处理中状态过期后可以重新抢占
+	time.Sleep(20 * time.Millisecond)
+	record, err = store.Acquire(ctx, "k", time.Minute)
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+
+	assert.Equal(t, []string{"SET", "SET", "GET", "SET", "SET", "GET", "DEL", "SET", "SET"}, fr.commands)
+}
+
+func TestGin_RedisStore(t *testing.T) {
+	store, _ := newFakeRedisStore()
+	var calls int32
+	router := newRouter(store, func(c *gin.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 1 {
+			c.String(http.StatusBadGateway, "")
+			return
+		}
+		c.String(http.StatusOK, "SUCCESS %d", n)
+	})
+
+	form := url.Values{"orderId": {"1"}, "txnType": {"01"}}
+
+	assert.Equal(t, http.StatusBadGateway, postForm(router, form, nil).Code)
+	assert.Equal(t, "SUCCESS 2", postForm(router, form, nil).Body.String())
+
+	w := postForm(router, form, nil)
+	assert.Equal(t, "SUCCESS 2", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get(ReplayedHeader))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestMemStore_Expire(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+
+	record, err := store.Acquire(ctx, "k", 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+
+	record, err = store.Acquire(ctx, "k", 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, StateProcessing, record.State)
+
+	time.Sleep(20 * time.Millisecond)
+	record, err = store.Acquire(ctx, "k", 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(NewMemStore(), WithLogger(logger),
+		WithFields("orderId", "txnType"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/pay.Pay/Notify"}
+
+	var calls int32
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 1 {
+			return nil, status.Error(codes.Unavailable, "bank unavailable")
+		}
+		return wrapperspb.String("SUCCESS"), nil
+	}
+
+	req, err := structpb.NewStruct(map[string]interface{}{"orderId": "1", "txnType": "01"})
+	assert.Nil(t, err)
+
+	_, err = interceptor(context.Background(), req, info, handler)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	for i := 0; i < 2; i++ {
+		resp, err := interceptor(context.Background(), req, info, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "SUCCESS", resp.(*wrapperspb.StringValue).GetValue())
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// metadata 中的幂等键
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("idempotency-key", "abc"))
+	_, err = interceptor(ctx, wrapperspb.String("x"), info, handler)
+	assert.Nil(t, err)
+	_, err = interceptor(ctx, wrapperspb.String("x"), info, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestUnaryServerInterceptor_Conflict(t *testing.T) {
+	store := NewMemStore()
+	interceptor := UnaryServerInterceptor(store, WithLogger(logger))
+	info := &grpc.UnaryServerInfo{FullMethod: "/pay.Pay/Notify"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("idempotency-key", "abc"))
+	_, err := store.Acquire(ctx, "idempotent:/pay.Pay/Notify:abc", time.Minute)
+	assert.Nil(t, err)
+
+	_, err = interceptor(ctx, wrapperspb.String("x"), info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return wrapperspb.String("SUCCESS"), nil
+		})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	// 经 errcode 转换后与 gin 中间件一致
+	assert.Equal(t, errcode.RecordDuplicate.Code, errcode.FromGRPCStatus(status.Convert(err)).Code)
+}
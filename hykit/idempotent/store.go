@@ -0,0 +1,154 @@
+package idempotent
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/redis"
+)
+
+const (
+	StateProcessing = "processing"
+
+	StateCompleted = "completed"
+)
+
+// Record 幂等键的处理状态和缓存的响应.
+type Record struct {
+	State string `json:"state"`
+
+	Status int `json:"status,omitempty"`
+
+	Header map[string]string `json:"header,omitempty"`
+
+	Body []byte `json:"body,omitempty"`
+}
+
+// Store 保存幂等键的状态.
+type Store interface {
+	// Acquire 幂等键不存在时标记为处理中并返回 nil, 否则返回已保存的记录.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (*Record, error)
+
+	// Complete 保存处理完成的响应.
+	Complete(ctx context.Context, key string, record *Record, ttl time.Duration) error
+
+	// Release 删除幂等键, 处理失败后允许重试.
+	Release(ctx context.Context, key string) error
+}
+
+type redisStore struct {
+	getConn func() redis.ContextConn
+}
+
+// NewRedisStore 使用 SET NX 抢占幂等键, 多个实例共享状态.
+func NewRedisStore(client *redis.Client) Store {
+	return &redisStore{getConn: client.GetCtxRedisConn}
+}
+
+func (rs *redisStore) Acquire(ctx context.Context, key string, ttl time.Duration) (*Record, error) {
+	data, err := json.Marshal(&Record{State: StateProcessing})
+	if err != nil {
+		return nil, err
+	}
+
+	conn := rs.getConn()
+	defer conn.Close()
+
+	reply, err := redis.String(conn.Do(ctx, "SET", key, data, "PX", ttl.Milliseconds(), "NX"))
+	if err != nil {
+		return nil, err
+	}
+
+	if reply == "OK" {
+		return nil, nil
+	}
+
+	data, err = redis.Bytes(conn.Do(ctx, "GET", key))
+	if err != nil {
+		return nil, err
+	}
+
+	// 在 SET 和 GET 之间过期, 按处理中返回, 由调用方重试
+	if data == nil {
+		return &Record{State: StateProcessing}, nil
+	}
+
+	record := &Record{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (rs *redisStore) Complete(ctx context.Context, key string, record *Record, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	conn := rs.getConn()
+	defer conn.Close()
+
+	_, err = conn.Do(ctx, "SET", key, data, "PX", ttl.Milliseconds())
+	return err
+}
+
+func (rs *redisStore) Release(ctx context.Context, key string) error {
+	conn := rs.getConn()
+	defer conn.Close()
+
+	_, err := conn.Do(ctx, "DEL", key)
+	return err
+}
+
+type memEntry struct {
+	record *Record
+
+	expireAt time.Time
+}
+
+type memStore struct {
+	mu sync.Mutex
+
+	entries map[string]memEntry
+}
+
+// NewMemStore 进程内的 Store, 用于单实例和测试.
+func NewMemStore() Store {
+	return &memStore{entries: make(map[string]memEntry)}
+}
+
+func (ms *memStore) Acquire(ctx context.Context, key string, ttl time.Duration) (*Record, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if entry, ok := ms.entries[key]; ok && time.Now().Before(entry.expireAt) {
+		return entry.record, nil
+	}
+
+	ms.entries[key] = memEntry{record: &Record{State: StateProcessing}, expireAt: time.Now().Add(ttl)}
+
+	return nil, nil
+}
+
+func (ms *memStore) Complete(ctx context.Context, key string, record *Record, ttl time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.entries[key] = memEntry{record: record, expireAt: time.Now().Add(ttl)}
+
+	return nil
+}
+
+func (ms *memStore) Release(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.entries, key)
+
+	return nil
+}
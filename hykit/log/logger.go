@@ -153,3 +153,13 @@ func (log *logger) WithFields(ctx context.Context, field Field) Logger {
 func SetFields(ctx context.Context, field Field) context.Context {
 	return context.WithValue(ctx, externalFieldKey, field)
 }
+
+// GetFields 取出 SetFields 设置的键值
+func GetFields(ctx context.Context) Field {
+	if ctx == nil {
+		return nil
+	}
+
+	fld, _ := ctx.Value(externalFieldKey).(Field)
+	return fld
+}
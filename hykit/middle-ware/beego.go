@@ -2,18 +2,23 @@ package middleware
 
 import (
 	"net/http"
-	"time"
-
-	"github.com/prometheus/client_golang/prometheus"
 )
 
-func Monitor(h http.Handler) http.HandlerFunc {
+// Monitor net/http 的 GinMonitor, 路由模板由 WithMonitorRoutes 或 WithMonitorRoute 指定,
+// 未指定时所有请求记为 unmatched.
+func Monitor(h http.Handler, options ...MonitorOption) http.HandlerFunc {
+	m := newMonitor(options...)
 	return func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		h.ServeHTTP(w, r)
-		duration := time.Since(start)
-		requestTotal.With(prometheus.Labels{"method": r.Method, "endpoint": r.URL.Path}).Inc()
-		requestDuration.With(prometheus.Labels{"method": r.Method,
-			"endpoint": r.URL.Path}).Observe(duration.Seconds())
+		endpoint := m.route(r)
+		start := m.start(r.Method, endpoint)
+
+		mw := &monitorResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(mw, r)
+
+		status := mw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.finish(start, r.Method, endpoint, status, r.ContentLength, mw.size)
 	}
 }
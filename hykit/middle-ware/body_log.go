@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	tracerid "code.jshyjdtech.com/godev/hykit/pkg/tracer-id"
+	"github.com/gin-gonic/gin"
+)
+
+const maskedBody = "******"
+
+type bodyLog struct {
+	logger log.Logger
+
+	maxBytes int
+
+	contentTypes []string
+
+	skipPaths map[string]struct{}
+
+	maskFields []string
+
+	mask func(contentType string, body []byte) []byte
+}
+
+type BodyLogOption func(*bodyLog)
+
+func WithBodyLogLogger(logger log.Logger) BodyLogOption {
+	return func(bl *bodyLog) {
+		bl.logger = logger
+	}
+}
+
+// WithBodyLogMaxBytes 请求体和响应体最多记录的字节数, 默认 4096.
+func WithBodyLogMaxBytes(maxBytes int) BodyLogOption {
+	return func(bl *bodyLog) {
+		bl.maxBytes = maxBytes
+	}
+}
+
+// WithBodyLogContentTypes 记录 body 的 content-type 前缀,
+// 默认 application/json, application/xml, application/x-www-form-urlencoded, text/.
+func WithBodyLogContentTypes(contentTypes ...string) BodyLogOption {
+	return func(bl *bodyLog) {
+		bl.contentTypes = contentTypes
+	}
+}
+
+// WithBodyLogSkipPaths 不记录访问日志的路径, e.g. /healthz.
+func WithBodyLogSkipPaths(paths ...string) BodyLogOption {
+	return func(bl *bodyLog) {
+		for _, path := range paths {
+			bl.skipPaths[path] = struct{}{}
+		}
+	}
+}
+
+// WithBodyLogMaskFields json 和表单中需要脱敏的字段,
+// 默认 password, token, secret, cvv, card_no, id_card.
+func WithBodyLogMaskFields(fields ...string) BodyLogOption {
+	return func(bl *bodyLog) {
+		bl.maskFields = fields
+	}
+}
+
+// WithBodyLogMask 自定义脱敏, 在字段脱敏之后调用.
+func WithBodyLogMask(mask func(contentType string, body []byte) []byte) BodyLogOption {
+	return func(bl *bodyLog) {
+		bl.mask = mask
+	}
+}
+
+// GinBodyLog 结构化访问日志, 包含 tracer id、耗时和截断、脱敏后的请求体和响应体.
+// 不在 content-type 白名单内的 body(e.g. 文件上传)不读取.
+func GinBodyLog(options ...BodyLogOption) gin.HandlerFunc {
+	bl := &bodyLog{
+		skipPaths: make(map[string]struct{}),
+	}
+
+	for _, option := range options {
+		option(bl)
+	}
+
+	if bl.logger == nil {
+		bl.logger = log.NewLogger()
+	}
+
+	if bl.maxBytes <= 0 {
+		bl.maxBytes = 4096
+	}
+
+	if len(bl.contentTypes) == 0 {
+		bl.contentTypes = []string{"application/json", "application/xml",
+			"application/x-www-form-urlencoded", "text/"}
+	}
+
+	if bl.maskFields == nil {
+		bl.maskFields = []string{"password", "token", "secret", "cvv", "card_no", "id_card"}
+	}
+
+	maskers := newFieldMaskers(bl.maskFields)
+
+	return func(c *gin.Context) {
+		if _, ok := bl.skipPaths[c.Request.URL.Path]; ok {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		ctx := c.Request.Context()
+
+		reqContentType := c.ContentType()
+		var reqBody []byte
+		if c.Request.Body != nil && bl.allowed(reqContentType) {
+			// 只读取 maxBytes+1 个字节, 剩余部分交给后续处理, 不会整个读入内存
+			reqBody, _ = ioutil.ReadAll(io.LimitReader(c.Request.Body, int64(bl.maxBytes+1)))
+			c.Request.Body = readCloser{
+				Reader: io.MultiReader(bytes.NewReader(reqBody), c.Request.Body),
+				Closer: c.Request.Body,
+			}
+		}
+
+		writer := &bodyLogWriter{ResponseWriter: c.Writer, limit: bl.maxBytes}
+		c.Writer = writer
+
+		c.Next()
+
+		respContentType := c.Writer.Header().Get("Content-Type")
+		fields := log.Field{
+			"tracer_id":  tracerid.ExtractTracerID(c.Request.Context()),
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"route":      c.FullPath(),
+			"status":     c.Writer.Status(),
+			"client_ip":  c.ClientIP(),
+			"latency_ms": time.Since(start).Milliseconds(),
+			"req_size":   c.Request.ContentLength,
+			"resp_size":  c.Writer.Size(),
+			"req_body":   bl.format(reqContentType, reqBody, maskers),
+		}
+
+		if bl.allowed(respContentType) {
+			fields["resp_body"] = bl.format(respContentType, writer.body.Bytes(), maskers)
+		} else {
+			fields["resp_body"] = bl.format(respContentType, nil, maskers)
+		}
+
+		bl.logger.WithFields(ctx, fields).Infoc(ctx, "access log")
+	}
+}
+
+func (bl *bodyLog) allowed(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, ct := range bl.contentTypes {
+		if strings.HasPrefix(contentType, ct) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (bl *bodyLog) format(contentType string, body []byte, maskers []fieldMasker) string {
+	if body == nil {
+		if contentType == "" || bl.allowed(contentType) {
+			return ""
+		}
+		return "[" + contentType + " skipped]"
+	}
+
+	truncated := len(body) > bl.maxBytes
+	if truncated {
+		body = body[:bl.maxBytes]
+	}
+
+	for _, fm := range maskers {
+		body = fm.re.ReplaceAll(body, fm.repl)
+	}
+
+	if bl.mask != nil {
+		body = bl.mask(contentType, body)
+	}
+
+	if truncated {
+		return string(body) + "...(truncated)"
+	}
+
+	return string(body)
+}
+
+type fieldMasker struct {
+	re *regexp.Regexp
+
+	repl []byte
+}
+
+// newFieldMaskers 匹配 json 的 "field": value 和表单的 field=value, json 脱敏后仍是字符串.
+func newFieldMaskers(fields []string) []fieldMasker {
+	maskers := make([]fieldMasker, 0, len(fields)*2)
+	for _, field := range fields {
+		quoted := regexp.QuoteMeta(field)
+		maskers = append(maskers,
+			fieldMasker{
+				re:   regexp.MustCompile(`("` + quoted + `"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\s]+)`),
+				repl: []byte(`${1}"` + maskedBody + `"`),
+			},
+			fieldMasker{
+				re:   regexp.MustCompile(`((?:^|&)` + quoted + `=)[^&]*`),
+				repl: []byte("${1}" + maskedBody),
+			})
+	}
+
+	return maskers
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyLogWriter 最多保留 limit+1 个字节, 多出的一个字节用于判断是否截断.
+type bodyLogWriter struct {
+	gin.ResponseWriter
+
+	body bytes.Buffer
+
+	limit int
+}
+
+func (w *bodyLogWriter) Write(buf []byte) (int, error) {
+	w.capture(buf)
+	return w.ResponseWriter.Write(buf)
+}
+
+func (w *bodyLogWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyLogWriter) capture(buf []byte) {
+	if remain := w.limit + 1 - w.body.Len(); remain > 0 {
+		if len(buf) > remain {
+			buf = buf[:remain]
+		}
+		w.body.Write(buf)
+	}
+}
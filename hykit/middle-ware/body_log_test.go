@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fieldsLogger 记录 WithFields 的字段, 用于断言访问日志.
+type fieldsLogger struct {
+	log.Logger
+
+	mu sync.Mutex
+
+	fields []log.Field
+}
+
+func (fl *fieldsLogger) WithFields(ctx context.Context, field log.Field) log.Logger {
+	fl.mu.Lock()
+	fl.fields = append(fl.fields, field)
+	fl.mu.Unlock()
+	return fl.Logger.WithFields(ctx, field)
+}
+
+func TestGinBodyLog_PassThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	en := gin.New()
+	en.Use(GinBodyLog(WithBodyLogMaxBytes(8)))
+	en.POST("/echo", func(c *gin.Context) {
+		body, _ := c.GetRawData()
+		c.Data(http.StatusOK, "application/json", body)
+	})
+
+	body := `{"order_no":"20221019","password":"123456"}`
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	en.ServeHTTP(w, req)
+
+	// 超过 maxBytes 的请求体完整传给 handler
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, body, w.Body.String())
+}
+
+func TestBodyLog_Format(t *testing.T) {
+	bl := &bodyLog{
+		maxBytes:     64,
+		contentTypes: []string{"application/json", "application/x-www-form-urlencoded"},
+	}
+	maskers := newFieldMaskers([]string{"password", "card_no"})
+
+	assert.Equal(t, `{"user":"a","password": "******","card_no":"******"}`,
+		bl.format("application/json", []byte(`{"user":"a","password": "p\"wd","card_no":6222}`), maskers))
+	assert.Equal(t, "user=a&password=******",
+		bl.format("application/x-www-form-urlencoded", []byte("user=a&password=secret"), maskers))
+	assert.Equal(t, "[multipart/form-data skipped]", bl.format("multipart/form-data", nil, maskers))
+
+	bl.maxBytes = 4
+	assert.Equal(t, "abcd...(truncated)", bl.format("application/json", []byte("abcdef"), maskers))
+
+	bl.mask = func(contentType string, body []byte) []byte {
+		return []byte(strings.ToUpper(string(body)))
+	}
+	assert.Equal(t, "AB", bl.format("application/json", []byte("ab"), maskers))
+}
+
+func TestGinBodyLog_MaskUnionNotify(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := &fieldsLogger{Logger: log.NewLogger()}
+	en := gin.New()
+	en.Use(GinBodyLog(WithBodyLogLogger(logger),
+		WithBodyLogMaskFields("accNo", "signature", "signPubKeyCert")))
+	en.POST("/notify/UnionJSCallback", func(c *gin.Context) {
+		c.String(http.StatusOK, "SUCCESS")
+	})
+
+	body := "accNo=6222021234567890&orderId=20221019&signature=aGVsbG8%3D&signPubKeyCert=-----BEGIN&txnAmt=100"
+	req := httptest.NewRequest(http.MethodPost, "/notify/UnionJSCallback", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	en.ServeHTTP(httptest.NewRecorder(), req)
+
+	if assert.Len(t, logger.fields, 1) {
+		fields := logger.fields[0]
+		assert.Equal(t, "accNo=******&orderId=20221019&signature=******&signPubKeyCert=******&txnAmt=100",
+			fields["req_body"])
+		assert.Equal(t, "SUCCESS", fields["resp_body"])
+		assert.Equal(t, "/notify/UnionJSCallback", fields["route"])
+		assert.Equal(t, http.StatusOK, fields["status"])
+	}
+}
@@ -15,18 +15,21 @@ import (
 	"github.com/gin-gonic/gin"
 	opentracing2 "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
-	"github.com/prometheus/client_golang/prometheus"
 )
 
-func GinMonitor() gin.HandlerFunc {
+// GinMonitor 按路由模板 c.FullPath()、method 和状态码分类统计请求.
+func GinMonitor(options ...MonitorOption) gin.HandlerFunc {
+	m := newMonitor(options...)
 	return func(c *gin.Context) {
-		start := time.Now()
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = unmatchedRoute
+		}
+
+		start := m.start(c.Request.Method, endpoint)
 		c.Next()
-		duration := time.Since(start)
-		requestTotal.With(prometheus.Labels{"method": c.Request.Method,
-			"endpoint": c.Request.Host}).Inc()
-		requestDuration.With(prometheus.Labels{"method": c.Request.Method,
-			"endpoint": c.Request.Host}).Observe(duration.Seconds())
+		m.finish(start, c.Request.Method, endpoint, c.Writer.Status(),
+			c.Request.ContentLength, int64(c.Writer.Size()))
 	}
 }
 
@@ -1,13 +1,18 @@
 package middleware
 
 import (
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-func init() {
-	prometheus.MustRegister(requestTotal)
-	prometheus.MustRegister(requestDuration)
-}
+var (
+	defaultDurationBuckets = []float64{0.1, 0.3, 0.5, 0.7, 0.9, 1, 3, 5, 10, 30, 100}
+
+	defaultSizeBuckets = prometheus.ExponentialBuckets(128, 4, 8)
+)
+
+var metricsOnce sync.Once
 
 // web_reqeust_total.
 var requestTotal = prometheus.NewCounterVec(
@@ -15,15 +20,61 @@ var requestTotal = prometheus.NewCounterVec(
 		Name: "web_reqeust_total",
 		Help: "Number of hello requests in total",
 	},
-	[]string{"method", "endpoint"},
+	[]string{"method", "endpoint", "status"},
 )
 
-// web_request_duration_seconds.
-var requestDuration = prometheus.NewHistogramVec(
-	prometheus.HistogramOpts{
-		Name:    "web_request_duration_seconds",
-		Help:    "web request duration distribution",
-		Buckets: []float64{0.1, 0.3, 0.5, 0.7, 0.9, 1, 3, 5, 10, 30, 100},
+// web_requests_in_flight.
+var requestInFlight = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "web_requests_in_flight",
+		Help: "Number of requests being served",
 	},
 	[]string{"method", "endpoint"},
 )
+
+// web_request_duration_seconds, web_request_size_bytes, web_response_size_bytes
+// 的分桶在第一次创建监控中间件时确定.
+var (
+	requestDuration *prometheus.HistogramVec
+
+	requestSize *prometheus.HistogramVec
+
+	responseSize *prometheus.HistogramVec
+)
+
+func registerMetrics(durationBuckets, sizeBuckets []float64) {
+	metricsOnce.Do(func() {
+		requestDuration = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "web_request_duration_seconds",
+				Help:    "web request duration distribution",
+				Buckets: durationBuckets,
+			},
+			[]string{"method", "endpoint", "status"},
+		)
+
+		requestSize = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "web_request_size_bytes",
+				Help:    "web request body size distribution",
+				Buckets: sizeBuckets,
+			},
+			[]string{"method", "endpoint"},
+		)
+
+		responseSize = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "web_response_size_bytes",
+				Help:    "web response body size distribution",
+				Buckets: sizeBuckets,
+			},
+			[]string{"method", "endpoint"},
+		)
+
+		prometheus.MustRegister(requestTotal)
+		prometheus.MustRegister(requestInFlight)
+		prometheus.MustRegister(requestDuration)
+		prometheus.MustRegister(requestSize)
+		prometheus.MustRegister(responseSize)
+	})
+}
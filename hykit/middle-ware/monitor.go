@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unmatchedRoute 没有匹配到路由的请求, 避免 404 扫描把原始路径写进 label.
+const unmatchedRoute = "unmatched"
+
+var idSegment = regexp.MustCompile(`^([0-9]+|[0-9a-fA-F-]{16,})$`)
+
+type monitor struct {
+	durationBuckets []float64
+
+	sizeBuckets []float64
+
+	route func(r *http.Request) string
+}
+
+type MonitorOption func(*monitor)
+
+// WithMonitorDurationBuckets 请求耗时分桶(秒), 进程内第一个监控中间件的配置生效.
+func WithMonitorDurationBuckets(buckets []float64) MonitorOption {
+	return func(m *monitor) {
+		m.durationBuckets = buckets
+	}
+}
+
+// WithMonitorSizeBuckets 请求和响应大小分桶(字节), 进程内第一个监控中间件的配置生效.
+func WithMonitorSizeBuckets(buckets []float64) MonitorOption {
+	return func(m *monitor) {
+		m.sizeBuckets = buckets
+	}
+}
+
+// WithMonitorRoute net/http 获取路由模板, 返回值直接作为 label, 必须是有限集合.
+// 默认所有请求都记为 unmatched.
+func WithMonitorRoute(route func(r *http.Request) string) MonitorOption {
+	return func(m *monitor) {
+		m.route = route
+	}
+}
+
+// WithMonitorRoutes net/http 已注册的路由模板, e.g. "/orders/:id/pay",
+// 路径中的数字和长 id 替换为 :id 后命中的记为该模板, 其余记为 unmatched.
+func WithMonitorRoutes(routes ...string) MonitorOption {
+	known := make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		known[route] = struct{}{}
+	}
+
+	return WithMonitorRoute(func(r *http.Request) string {
+		route := normalizePath(r.URL.Path)
+		if _, ok := known[route]; ok {
+			return route
+		}
+		return unmatchedRoute
+	})
+}
+
+func newMonitor(options ...MonitorOption) *monitor {
+	m := &monitor{}
+	for _, option := range options {
+		option(m)
+	}
+
+	if len(m.durationBuckets) == 0 {
+		m.durationBuckets = defaultDurationBuckets
+	}
+
+	if len(m.sizeBuckets) == 0 {
+		m.sizeBuckets = defaultSizeBuckets
+	}
+
+	if m.route == nil {
+		m.route = func(r *http.Request) string {
+			return unmatchedRoute
+		}
+	}
+
+	registerMetrics(m.durationBuckets, m.sizeBuckets)
+
+	return m
+}
+
+func (m *monitor) start(method, endpoint string) time.Time {
+	requestInFlight.With(prometheus.Labels{"method": method, "endpoint": endpoint}).Inc()
+	return time.Now()
+}
+
+func (m *monitor) finish(start time.Time, method, endpoint string, status int, reqSize, respSize int64) {
+	labels := prometheus.Labels{"method": method, "endpoint": endpoint}
+	requestInFlight.With(labels).Dec()
+	requestSize.With(labels).Observe(float64(nonNegative(reqSize)))
+	responseSize.With(labels).Observe(float64(nonNegative(respSize)))
+
+	labels["status"] = statusClass(status)
+	requestTotal.With(labels).Inc()
+	requestDuration.With(labels).Observe(time.Since(start).Seconds())
+}
+
+// statusClass 200 -> 2xx.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func nonNegative(n int64) int64 {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// normalizePath /users/123/orders -> /users/:id/orders.
+func normalizePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if idSegment.MatchString(segment) {
+			segments[i] = ":id"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+type monitorResponseWriter struct {
+	http.ResponseWriter
+
+	status int
+
+	size int64
+}
+
+func (mw *monitorResponseWriter) WriteHeader(status int) {
+	if mw.status == 0 {
+		mw.status = status
+	}
+	mw.ResponseWriter.WriteHeader(status)
+}
+
+func (mw *monitorResponseWriter) Write(b []byte) (int, error) {
+	if mw.status == 0 {
+		mw.status = http.StatusOK
+	}
+	n, err := mw.ResponseWriter.Write(b)
+	mw.size += int64(n)
+	return n, err
+}
+
+func (mw *monitorResponseWriter) Flush() {
+	if flusher, ok := mw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack websocket 等需要接管连接的 handler.
+func (mw *monitorResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := mw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: ResponseWriter does not implement http.Hijacker")
+	}
+
+	if mw.status == 0 {
+		mw.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
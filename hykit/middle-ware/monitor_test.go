@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGinMonitor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	en := gin.New()
+	en.Use(GinMonitor())
+	en.GET("/users/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/not_found"} {
+		en.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(requestTotal.With(prometheus.Labels{
+		"method": http.MethodGet, "endpoint": "/users/:id", "status": "2xx"})))
+	assert.Equal(t, float64(1), testutil.ToFloat64(requestTotal.With(prometheus.Labels{
+		"method": http.MethodGet, "endpoint": unmatchedRoute, "status": "4xx"})))
+	assert.Equal(t, float64(0), testutil.ToFloat64(requestInFlight.With(prometheus.Labels{
+		"method": http.MethodGet, "endpoint": "/users/:id"})))
+}
+
+func TestMonitor(t *testing.T) {
+	h := Monitor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}), WithMonitorRoutes("/orders/:id/pay"))
+
+	for _, path := range []string{"/orders/123456/pay", "/wp-login.php", "/.env"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(requestTotal.With(prometheus.Labels{
+		"method": http.MethodPost, "endpoint": "/orders/:id/pay", "status": "5xx"})))
+	assert.Equal(t, float64(2), testutil.ToFloat64(requestTotal.With(prometheus.Labels{
+		"method": http.MethodPost, "endpoint": unmatchedRoute, "status": "5xx"})))
+}
+
+func TestMonitor_DefaultUnmatched(t *testing.T) {
+	h := Monitor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/scan/123", nil))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(requestTotal.With(prometheus.Labels{
+		"method": http.MethodDelete, "endpoint": unmatchedRoute, "status": "2xx"})))
+}
+
+func TestMonitor_HijackAndFlush(t *testing.T) {
+	var hijacked, flushed bool
+	h := Monitor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stream" {
+			_, _ = w.Write([]byte("data"))
+			w.(http.Flusher).Flush()
+			flushed = true
+			return
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer conn.Close()
+		hijacked = true
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		_ = rw.Flush()
+	}))
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.True(t, flushed)
+
+	resp, err = http.Get(server.URL + "/ws")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.True(t, hijacked)
+
+	// httptest.ResponseRecorder 不支持 Hijack, 返回错误而不是 panic
+	_, _, err = (&monitorResponseWriter{ResponseWriter: httptest.NewRecorder()}).Hijack()
+	assert.NotNil(t, err)
+}
+
+func TestNormalizePath(t *testing.T) {
+	assert.Equal(t, "/users/:id/orders", normalizePath("/users/42/orders"))
+	assert.Equal(t, "/files/:id", normalizePath("/files/6ba7b810-9dad-11d1-80b4-00c04fd430c8"))
+	assert.Equal(t, "/v1/ping", normalizePath("/v1/ping"))
+	assert.Equal(t, "5xx", statusClass(503))
+}
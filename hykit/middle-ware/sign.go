@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"code.jshyjdtech.com/godev/hykit/errcode"
+	"code.jshyjdtech.com/godev/hykit/log"
+	"code.jshyjdtech.com/godev/hykit/pkg/security"
+	"github.com/gin-gonic/gin"
+)
+
+type verifySign struct {
+	logger log.Logger
+
+	signField string
+
+	signHeader string
+
+	maxBodyBytes int64
+}
+
+type VerifySignOption func(*verifySign)
+
+// WithVerifySignField 签名字段, 默认 signature.
+func WithVerifySignField(signField string) VerifySignOption {
+	return func(vs *verifySign) {
+		vs.signField = signField
+	}
+}
+
+// WithVerifySignHeader 从请求头读取签名.
+func WithVerifySignHeader(signHeader string) VerifySignOption {
+	return func(vs *verifySign) {
+		vs.signHeader = signHeader
+	}
+}
+
+// WithVerifySignMaxBodyBytes 参与验签的请求体上限, 超过时返回 413, 默认 1MB.
+func WithVerifySignMaxBodyBytes(maxBodyBytes int64) VerifySignOption {
+	return func(vs *verifySign) {
+		vs.maxBodyBytes = maxBodyBytes
+	}
+}
+
+func WithVerifySignLogger(logger log.Logger) VerifySignOption {
+	return func(vs *verifySign) {
+		vs.logger = logger
+	}
+}
+
+// GinVerifySign 验证 http.SignProxy 签名的请求, 验签失败返回 errcode.SignErr.
+func GinVerifySign(signer security.Signer, options ...VerifySignOption) gin.HandlerFunc {
+	vs := &verifySign{}
+	for _, option := range options {
+		option(vs)
+	}
+
+	if vs.logger == nil {
+		vs.logger = log.NewLogger()
+	}
+
+	if vs.signField == "" {
+		vs.signField = "signature"
+	}
+
+	if vs.maxBodyBytes <= 0 {
+		vs.maxBodyBytes = 1 << 20
+	}
+
+	return func(c *gin.Context) {
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, vs.maxBodyBytes))
+			if err != nil {
+				vs.logger.Warnc(c.Request.Context(), "verify sign %s read body : %s",
+					c.Request.URL.Path, err.Error())
+				errcode.Fail(c, BodyReadError(err))
+				return
+			}
+			c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		var fields map[string]string
+		var err error
+		if len(body) > 0 {
+			fields, err = security.SignFields(c.ContentType(), body)
+		} else {
+			fields, err = security.SignFields("", []byte(c.Request.URL.RawQuery))
+		}
+
+		if err == nil {
+			signature := fields[vs.signField]
+			if vs.signHeader != "" {
+				signature = c.GetHeader(vs.signHeader)
+			}
+			err = security.VerifyBase64(signer, security.SignBuffer(fields, vs.signField), signature)
+		}
+
+		if err != nil {
+			vs.logger.Warnc(c.Request.Context(), "verify sign %s : %s", c.Request.URL.Path, err.Error())
+			errcode.Fail(c, errcode.SignErr)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// BodyReadError 请求体超过上限返回 BodyTooLarge, 其他读取错误按报文格式错误处理.
+func BodyReadError(err error) error {
+	// http.MaxBytesReader 超限时的错误
+	if err.Error() == "http: request body too large" {
+		return errcode.BodyTooLarge
+	}
+
+	return errcode.FormatErr.WithDetail("%s", err.Error())
+}
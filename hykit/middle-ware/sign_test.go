@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"code.jshyjdtech.com/godev/hykit/pkg/security"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type rejectSigner struct{}
+
+func (rejectSigner) Sign(signBlock []byte) ([]byte, error) {
+	return signBlock, nil
+}
+
+func (rejectSigner) Verify(signBlock, signature []byte) error {
+	return security.ErrInvalidSignature
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func newSignEngine(options ...VerifySignOption) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	en := gin.New()
+	en.Use(GinVerifySign(rejectSigner{}, options...))
+	en.POST("/pay", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	return en
+}
+
+func TestGinVerifySign_Reject(t *testing.T) {
+	en := newSignEngine()
+
+	req := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(`{"order_no":"1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	en.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"code":"SIGNERR","msg":"验签失败","data":{}}`, w.Body.String())
+}
+
+func TestGinVerifySign_BodyTooLarge(t *testing.T) {
+	en := newSignEngine(WithVerifySignMaxBodyBytes(8))
+
+	req := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(`{"order_no":"20221019"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	en.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"BODY_TOO_LARGE"`)
+}
+
+func TestGinVerifySign_ReadError(t *testing.T) {
+	en := newSignEngine()
+
+	req := httptest.NewRequest(http.MethodPost, "/pay", errReader{})
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	en.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"FORMAT_ERR"`)
+}
@@ -0,0 +1,494 @@
+package mysql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"code.jshyjdtech.com/godev/hykit/kafka"
+	"code.jshyjdtech.com/godev/hykit/log"
+	tracerid "code.jshyjdtech.com/godev/hykit/pkg/tracer-id"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	auditBeforeKey = "hykit:audit_before"
+
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+type operatorKey struct{}
+
+// SetOperator 设置审计记录中的操作人.
+func SetOperator(ctx context.Context, operator string) context.Context {
+	return context.WithValue(ctx, operatorKey{}, operator)
+}
+
+// AuditRecord 一行数据的一次变更.
+type AuditRecord struct {
+	Id         int64     `gorm:"column:id;primaryKey;autoIncrement" json:"-"`
+	Table      string    `gorm:"column:table_name;type:varchar(64);not null;index" json:"table_name"`
+	Action     string    `gorm:"column:action;type:varchar(16);not null" json:"action"`
+	PrimaryKey string    `gorm:"column:primary_key;type:varchar(64);not null;index" json:"primary_key"`
+	Before     string    `gorm:"column:before_image;type:text" json:"before"`
+	After      string    `gorm:"column:after_image;type:text" json:"after"`
+	Operator   string    `gorm:"column:operator;type:varchar(64);not null;default:''" json:"operator"`
+	TracerId   string    `gorm:"column:tracer_id;type:varchar(64);not null;default:''" json:"tracer_id"`
+	CreatedAt  time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (AuditRecord) TableName() string {
+	return "sql_audit_log"
+}
+
+// AuditSink 审计记录的存储.
+type AuditSink interface {
+	Write(ctx context.Context, records []*AuditRecord) error
+}
+
+type auditTableSink struct {
+	db *gorm.DB
+}
+
+// NewAuditTableSink 写入 sql_audit_log 表, 表结构见 AuditRecord.
+func NewAuditTableSink(db *gorm.DB) AuditSink {
+	return &auditTableSink{db: db}
+}
+
+func (ats *auditTableSink) Write(ctx context.Context, records []*AuditRecord) error {
+	return ats.db.WithContext(ctx).CreateInBatches(records, len(records)).Error
+}
+
+type auditKafkaSink struct {
+	writer *kafka.Writer
+
+	topic string
+}
+
+// NewAuditKafkaSink 每条记录一条消息, key 为 表名:主键.
+func NewAuditKafkaSink(writer *kafka.Writer, topic string) AuditSink {
+	return &auditKafkaSink{writer: writer, topic: topic}
+}
+
+func (aks *auditKafkaSink) Write(ctx context.Context, records []*AuditRecord) error {
+	for _, record := range records {
+		body, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		err = aks.writer.PublishKeyMessage(ctx, aks.topic,
+			[]byte(record.Table+":"+record.PrimaryKey), body)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MaskFunc 脱敏函数.
+type MaskFunc func(value interface{}) interface{}
+
+// MaskCardNo 保留前 6 位和后 4 位.
+func MaskCardNo(value interface{}) interface{} {
+	str := cast.ToString(value)
+	if len(str) <= 10 {
+		return strings.Repeat("*", len(str))
+	}
+
+	return str[:6] + strings.Repeat("*", len(str)-10) + str[len(str)-4:]
+}
+
+// MaskAll 全部替换.
+func MaskAll(value interface{}) interface{} {
+	return "******"
+}
+
+// AuditPlugin gorm 插件, 记录指定表 update/delete 前后的数据.
+// 每条语句最多记录 mysql_audit_max_rows 行, 记录异步写入 AuditSink,
+// 缓冲区满时丢弃并打印错误日志, 不阻塞业务.
+type AuditPlugin struct {
+	conf config.Config
+
+	logger log.Logger
+
+	sink AuditSink
+
+	tables map[string]struct{}
+
+	// key 为 表名.字段 或 字段
+	masks map[string]MaskFunc
+
+	// log.SetFields 中操作人的键
+	operatorField string
+
+	maxRows int
+
+	records chan *AuditRecord
+
+	closeChan chan bool
+
+	wg sync.WaitGroup
+}
+
+type AuditOption func(*AuditPlugin)
+
+type AuditOptions struct{}
+
+func NewAuditPlugin(options ...AuditOption) *AuditPlugin {
+	ap := &AuditPlugin{
+		tables:        make(map[string]struct{}),
+		masks:         make(map[string]MaskFunc),
+		operatorField: "operator",
+		closeChan:     make(chan bool),
+	}
+
+	for _, option := range options {
+		option(ap)
+	}
+
+	if ap.conf == nil {
+		ap.conf = config.NewNullConfig()
+	}
+
+	if ap.logger == nil {
+		ap.logger = log.NewLogger()
+	}
+
+	if ap.sink == nil {
+		ap.logger.Panicf("[mysql] audit sink is nil")
+	}
+
+	bufferSize := ap.conf.GetInt("mysql_audit_buffer_size")
+	if bufferSize == 0 {
+		bufferSize = 1000
+	}
+	ap.records = make(chan *AuditRecord, bufferSize)
+
+	ap.maxRows = ap.conf.GetInt("mysql_audit_max_rows")
+	if ap.maxRows == 0 {
+		ap.maxRows = 100
+	}
+
+	ap.wg.Add(1)
+	go ap.run()
+
+	return ap
+}
+
+func (AuditOptions) WithConf(conf config.Config) AuditOption {
+	return func(ap *AuditPlugin) {
+		ap.conf = conf
+	}
+}
+
+func (AuditOptions) WithLogger(logger log.Logger) AuditOption {
+	return func(ap *AuditPlugin) {
+		ap.logger = logger
+	}
+}
+
+func (AuditOptions) WithSink(sink AuditSink) AuditOption {
+	return func(ap *AuditPlugin) {
+		ap.sink = sink
+	}
+}
+
+// WithTables 需要审计的表.
+func (AuditOptions) WithTables(tables ...string) AuditOption {
+	return func(ap *AuditPlugin) {
+		for _, table := range tables {
+			ap.tables[table] = struct{}{}
+		}
+	}
+}
+
+// WithMask field 为 表名.字段 时只作用于该表, 为 字段 时作用于所有表.
+func (AuditOptions) WithMask(field string, mask MaskFunc) AuditOption {
+	return func(ap *AuditPlugin) {
+		ap.masks[field] = mask
+	}
+}
+
+// WithOperatorField 未使用 SetOperator 时, 从 log.SetFields 的该键取操作人.
+func (AuditOptions) WithOperatorField(field string) AuditOption {
+	return func(ap *AuditPlugin) {
+		ap.operatorField = field
+	}
+}
+
+// Name implements gorm.Plugin.
+func (ap *AuditPlugin) Name() string {
+	return "hykit:audit"
+}
+
+// Initialize implements gorm.Plugin.
+func (ap *AuditPlugin) Initialize(db *gorm.DB) error {
+	err := db.Callback().Update().Before("gorm:update").Register("hykit:audit_before_update", ap.before)
+	if err != nil {
+		return err
+	}
+
+	err = db.Callback().Update().After("gorm:update").Register("hykit:audit_after_update", ap.afterUpdate)
+	if err != nil {
+		return err
+	}
+
+	err = db.Callback().Delete().Before("gorm:delete").Register("hykit:audit_before_delete", ap.before)
+	if err != nil {
+		return err
+	}
+
+	err = db.Callback().Delete().After("gorm:delete").Register("hykit:audit_after_delete", ap.afterDelete)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close 写完缓冲区中的记录后退出.
+func (ap *AuditPlugin) Close() {
+	close(ap.closeChan)
+	ap.wg.Wait()
+}
+
+func (ap *AuditPlugin) audited(db *gorm.DB) bool {
+	if db.Error != nil || db.DryRun || db.Statement.Table == "" {
+		return false
+	}
+
+	_, ok := ap.tables[db.Statement.Table]
+	return ok
+}
+
+// imageDb 与当前语句相同条件的查询.
+func (ap *AuditPlugin) imageDb(db *gorm.DB) *gorm.DB {
+	stmt := db.Statement
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true, Context: stmt.Context}).
+		Table(stmt.Table)
+
+	if where, ok := stmt.Clauses["WHERE"]; ok {
+		if expr, ok := where.Expression.(clause.Where); ok {
+			tx.Statement.AddClause(clause.Where{Exprs: expr.Exprs})
+		}
+	}
+
+	// db.Model(&user).Updates(...) 的主键条件在 gorm:update 中才加入
+	if stmt.Schema != nil && stmt.Schema.PrioritizedPrimaryField != nil &&
+		stmt.ReflectValue.Kind() == reflect.Struct {
+		field := stmt.Schema.PrioritizedPrimaryField
+		if value, zero := field.ValueOf(stmt.Context, stmt.ReflectValue); !zero {
+			tx = tx.Where(clause.Eq{Column: clause.Column{Name: field.DBName}, Value: value})
+		}
+	}
+
+	return tx
+}
+
+func (ap *AuditPlugin) priKey(db *gorm.DB) string {
+	if db.Statement.Schema != nil && db.Statement.Schema.PrioritizedPrimaryField != nil {
+		return db.Statement.Schema.PrioritizedPrimaryField.DBName
+	}
+
+	return "id"
+}
+
+func (ap *AuditPlugin) before(db *gorm.DB) {
+	if !ap.audited(db) {
+		return
+	}
+
+	// 在 gorm 默认事务中加行锁, 避免并发更新时记录到被其他事务改过的变更前数据.
+	// 关闭默认事务(SkipDefaultTransaction)时需要调用方自己开启事务
+	rows := make([]map[string]interface{}, 0)
+	err := ap.imageDb(db).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Limit(ap.maxRows).Find(&rows).Error
+	if err != nil {
+		ap.logger.Errorc(db.Statement.Context, "[mysql] audit %s before image error : %s",
+			db.Statement.Table, err.Error())
+		return
+	}
+
+	db.InstanceSet(auditBeforeKey, rows)
+}
+
+func (ap *AuditPlugin) afterUpdate(db *gorm.DB) {
+	before, ok := ap.beforeRows(db)
+	if !ok || len(before) == 0 {
+		return
+	}
+
+	priKey := ap.priKey(db)
+	ids := make([]interface{}, 0, len(before))
+	for _, row := range before {
+		ids = append(ids, row[priKey])
+	}
+
+	after := make([]map[string]interface{}, 0)
+	// 上下文须放在 NewDB 的 Session 中, 再调用 WithContext 会沿用已生成 UPDATE 语句的 Statement
+	err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true, Context: db.Statement.Context}).
+		Table(db.Statement.Table).
+		Where(clause.IN{Column: clause.Column{Name: priKey}, Values: ids}).
+		Find(&after).Error
+	if err != nil {
+		ap.logger.Errorc(db.Statement.Context, "[mysql] audit %s after image error : %s",
+			db.Statement.Table, err.Error())
+	}
+
+	afterById := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterById[cast.ToString(row[priKey])] = row
+	}
+
+	ap.emit(db, AuditActionUpdate, priKey, before, afterById)
+}
+
+func (ap *AuditPlugin) afterDelete(db *gorm.DB) {
+	before, ok := ap.beforeRows(db)
+	if !ok || len(before) == 0 {
+		return
+	}
+
+	ap.emit(db, AuditActionDelete, ap.priKey(db), before, nil)
+}
+
+func (ap *AuditPlugin) beforeRows(db *gorm.DB) ([]map[string]interface{}, bool) {
+	if !ap.audited(db) {
+		return nil, false
+	}
+
+	val, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return nil, false
+	}
+
+	rows, ok := val.([]map[string]interface{})
+	return rows, ok
+}
+
+func (ap *AuditPlugin) emit(db *gorm.DB, action, priKey string,
+	before []map[string]interface{}, afterById map[string]map[string]interface{}) {
+	ctx := db.Statement.Context
+	table := db.Statement.Table
+	operator := ap.operator(ctx)
+	tracerID := tracerid.ExtractTracerID(ctx)
+	now := time.Now()
+
+	for _, row := range before {
+		id := cast.ToString(row[priKey])
+		record := &AuditRecord{
+			Table:      table,
+			Action:     action,
+			PrimaryKey: id,
+			Before:     ap.image(table, row),
+			Operator:   operator,
+			TracerId:   tracerID,
+			CreatedAt:  now,
+		}
+
+		if afterRow, ok := afterById[id]; ok {
+			record.After = ap.image(table, afterRow)
+		}
+
+		select {
+		case ap.records <- record:
+		default:
+			ap.logger.Errorc(ctx, "[mysql] audit buffer full, drop %s %s [%s]", table, action, id)
+		}
+	}
+}
+
+// image 脱敏后序列化.
+func (ap *AuditPlugin) image(table string, row map[string]interface{}) string {
+	masked := make(map[string]interface{}, len(row))
+	for field, value := range row {
+		if value == nil {
+			masked[field] = nil
+			continue
+		}
+
+		if mask, ok := ap.masks[table+"."+field]; ok {
+			masked[field] = mask(value)
+		} else if mask, ok := ap.masks[field]; ok {
+			masked[field] = mask(value)
+		} else if bs, ok := value.([]byte); ok {
+			masked[field] = string(bs)
+		} else {
+			masked[field] = value
+		}
+	}
+
+	data, err := json.Marshal(masked)
+	if err != nil {
+		return fmt.Sprintf("%v", masked)
+	}
+
+	return string(data)
+}
+
+func (ap *AuditPlugin) operator(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	if operator, ok := ctx.Value(operatorKey{}).(string); ok {
+		return operator
+	}
+
+	if fields := log.GetFields(ctx); fields != nil {
+		return cast.ToString(fields[ap.operatorField])
+	}
+
+	return ""
+}
+
+func (ap *AuditPlugin) run() {
+	defer ap.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	batch := make([]*AuditRecord, 0, 100)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := ap.sink.Write(context.Background(), batch); err != nil {
+			ap.logger.Errorf("[mysql] audit write %d records error : %s", len(batch), err.Error())
+		}
+		batch = make([]*AuditRecord, 0, 100)
+	}
+
+	for {
+		select {
+		case record := <-ap.records:
+			batch = append(batch, record)
+			if len(batch) >= 100 {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ap.closeChan:
+			for {
+				select {
+				case record := <-ap.records:
+					batch = append(batch, record)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package mysql
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	tracerid "code.jshyjdtech.com/godev/hykit/pkg/tracer-id"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type spyAuditSink struct {
+	mu sync.Mutex
+
+	records []*AuditRecord
+}
+
+func (s *spyAuditSink) Write(ctx context.Context, records []*AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func TestMaskCardNo(t *testing.T) {
+	assert.Equal(t, "622588******1234", MaskCardNo("6225880000001234"))
+	assert.Equal(t, "****", MaskCardNo("1234"))
+}
+
+func TestAuditPlugin_Emit(t *testing.T) {
+	sink := &spyAuditSink{}
+
+	var options AuditOptions
+	audit := NewAuditPlugin(
+		options.WithSink(sink),
+		options.WithTables("tbl_pay"),
+		options.WithMask("card_no", MaskCardNo),
+		options.WithMask("tbl_pay.cvn", MaskAll),
+	)
+
+	ctx := context.WithValue(context.Background(), tracerid.ActiveEsimKey, "abc")
+	ctx = log.SetFields(ctx, log.Field{"operator": "admin"})
+
+	db := &gorm.DB{Statement: &gorm.Statement{Context: ctx, Table: "tbl_pay"}}
+	before := []map[string]interface{}{
+		{"id": int64(1), "card_no": "6225880000001234", "cvn": "123", "status": []byte("00")},
+	}
+	after := map[string]map[string]interface{}{
+		"1": {"id": int64(1), "card_no": "6225880000001234", "cvn": "123", "status": []byte("01")},
+	}
+	audit.emit(db, AuditActionUpdate, "id", before, after)
+
+	audit.Close()
+
+	assert.Len(t, sink.records, 1)
+	record := sink.records[0]
+	assert.Equal(t, "tbl_pay", record.Table)
+	assert.Equal(t, "1", record.PrimaryKey)
+	assert.Equal(t, "admin", record.Operator)
+	assert.Equal(t, "abc", record.TracerId)
+	assert.Equal(t, `{"card_no":"622588******1234","cvn":"******","id":1,"status":"00"}`, record.Before)
+	assert.Equal(t, `{"card_no":"622588******1234","cvn":"******","id":1,"status":"01"}`, record.After)
+}
+
+func TestAuditPlugin_Operator(t *testing.T) {
+	audit := NewAuditPlugin(AuditOptions{}.WithSink(&spyAuditSink{}),
+		AuditOptions{}.WithOperatorField("user_id"))
+
+	ctx := log.SetFields(context.Background(), log.Field{"user_id": 10})
+	assert.Equal(t, "10", audit.operator(ctx))
+
+	ctx = SetOperator(ctx, "admin")
+	assert.Equal(t, "admin", audit.operator(ctx))
+}
+
+type auditPay struct {
+	Id     int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	CardNo string `gorm:"column:card_no"`
+	Status string `gorm:"column:status"`
+}
+
+func (auditPay) TableName() string {
+	return "tbl_pay"
+}
+
+type auditLog struct {
+	Id      int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	Content string `gorm:"column:content"`
+}
+
+func (auditLog) TableName() string {
+	return "tbl_log"
+}
+
+// newSqliteAuditClient sqlite 内存库, 审计 tbl_pay.
+func newSqliteAuditClient(t *testing.T) (*gorm.DB, *AuditPlugin, *spyAuditSink) {
+	clientOnce = sync.Once{}
+
+	sink := &spyAuditSink{}
+	var auditOptions AuditOptions
+	audit := NewAuditPlugin(
+		auditOptions.WithSink(sink),
+		auditOptions.WithTables("tbl_pay"),
+		auditOptions.WithMask("card_no", MaskCardNo),
+	)
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithDbConfig([]DbConfig{{Driver: DriverSqlite, Db: t.Name()}}),
+		clientOptions.WithAudit(audit),
+	)
+	t.Cleanup(func() {
+		client.Close()
+		clientOnce = sync.Once{}
+	})
+
+	assert.Nil(t, client.AutoMigrate(t.Name(), &auditPay{}, &auditLog{}))
+
+	db := client.GetDb(t.Name())
+	assert.Nil(t, db.Create([]*auditPay{
+		{CardNo: "6225880000001234", Status: "00"},
+		{CardNo: "6225880000005678", Status: "00"},
+		{CardNo: "6225880000009012", Status: "01"},
+	}).Error)
+	assert.Nil(t, db.Create(&auditLog{Content: "a"}).Error)
+
+	return db, audit, sink
+}
+
+func TestAuditPlugin_SqliteUpdate(t *testing.T) {
+	db, audit, sink := newSqliteAuditClient(t)
+
+	ctx := SetOperator(context.Background(), "admin")
+	assert.Nil(t, db.WithContext(ctx).Model(&auditPay{Id: 1}).Update("status", "02").Error)
+	assert.Nil(t, db.WithContext(ctx).Model(&auditPay{}).Where("status = ?", "00").
+		Updates(map[string]interface{}{"status": "03"}).Error)
+	// 未审计的表
+	assert.Nil(t, db.Model(&auditLog{Id: 1}).Update("content", "b").Error)
+	// 未命中任何行
+	assert.Nil(t, db.Model(&auditPay{}).Where("status = ?", "99").Update("status", "00").Error)
+
+	audit.Close()
+
+	assert.Len(t, sink.records, 2)
+
+	record := sink.records[0]
+	assert.Equal(t, "tbl_pay", record.Table)
+	assert.Equal(t, AuditActionUpdate, record.Action)
+	assert.Equal(t, "1", record.PrimaryKey)
+	assert.Equal(t, "admin", record.Operator)
+	assert.Equal(t, `{"card_no":"622588******1234","id":1,"status":"00"}`, record.Before)
+	assert.Equal(t, `{"card_no":"622588******1234","id":1,"status":"02"}`, record.After)
+
+	record = sink.records[1]
+	assert.Equal(t, "2", record.PrimaryKey)
+	assert.Equal(t, `{"card_no":"622588******5678","id":2,"status":"00"}`, record.Before)
+	assert.Equal(t, `{"card_no":"622588******5678","id":2,"status":"03"}`, record.After)
+}
+
+func TestAuditPlugin_SqliteDelete(t *testing.T) {
+	db, audit, sink := newSqliteAuditClient(t)
+
+	assert.Nil(t, db.Where("status = ?", "01").Delete(&auditPay{}).Error)
+	assert.Nil(t, db.Delete(&auditLog{Id: 1}).Error)
+
+	audit.Close()
+
+	assert.Len(t, sink.records, 1)
+	record := sink.records[0]
+	assert.Equal(t, AuditActionDelete, record.Action)
+	assert.Equal(t, "3", record.PrimaryKey)
+	assert.Equal(t, `{"card_no":"622588******9012","id":3,"status":"01"}`, record.Before)
+	assert.Equal(t, "", record.After)
+}
+
+func TestAuditPlugin_BeforeImageLock(t *testing.T) {
+	db, audit, _ := newSqliteAuditClient(t)
+	defer audit.Close()
+
+	// sqlite 不生成 FOR UPDATE, 检查语句中的锁子句
+	var locked bool
+	assert.Nil(t, db.Callback().Query().Before("gorm:query").Register("test:lock", func(tx *gorm.DB) {
+		if tx.Statement.Table != "tbl_pay" {
+			return
+		}
+		if c, ok := tx.Statement.Clauses["FOR"]; ok {
+			if locking, ok := c.Expression.(clause.Locking); ok && locking.Strength == "UPDATE" {
+				locked = true
+			}
+		}
+	}))
+	defer func() {
+		_ = db.Callback().Query().Remove("test:lock")
+	}()
+
+	assert.Nil(t, db.Model(&auditPay{Id: 1}).Update("status", "02").Error)
+	assert.True(t, locked)
+}
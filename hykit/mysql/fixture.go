@@ -0,0 +1,96 @@
+package mysql
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// AutoMigrate 按 db2entity 生成的实体建表, 用于 sqlite 单元测试.
+func (c *Client) AutoMigrate(dbName string, entities ...interface{}) error {
+	db := c.GetDb(dbName)
+	if db == nil {
+		return fmt.Errorf("[db] %s not found", dbName)
+	}
+
+	return db.AutoMigrate(entities...)
+}
+
+// fixtureTable fixture 文件中一张表的数据.
+type fixtureTable struct {
+	table string
+
+	rows []map[string]interface{}
+}
+
+// parseFixtures 按文件中的顺序返回表, 有外键时父表写在前面.
+func parseFixtures(content []byte) ([]fixtureTable, error) {
+	var slice yaml.MapSlice
+	if err := yaml.Unmarshal(content, &slice); err != nil {
+		return nil, err
+	}
+
+	tables := make([]fixtureTable, 0, len(slice))
+	for _, item := range slice {
+		value, err := yaml.Marshal(item.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		rows := make([]map[string]interface{}, 0)
+		if err = yaml.Unmarshal(value, &rows); err != nil {
+			return nil, err
+		}
+
+		tables = append(tables, fixtureTable{table: fmt.Sprint(item.Key), rows: rows})
+	}
+
+	return tables, nil
+}
+
+// LoadFixtures 清空 fixture 中出现的表并写入数据, 按文件中的顺序写入, 逆序清空, 文件格式:
+//
+//	user:
+//	  - {id: 1, username: test}
+//	  - {id: 2, username: test2}
+func (c *Client) LoadFixtures(dbName string, files ...string) error {
+	db := c.GetDb(dbName)
+	if db == nil {
+		return fmt.Errorf("[db] %s not found", dbName)
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		fixtures, err := parseFixtures(content)
+		if err != nil {
+			return fmt.Errorf("%s : %s", file, err.Error())
+		}
+
+		// 先清空子表再清空父表
+		for i := len(fixtures) - 1; i >= 0; i-- {
+			table := fixtures[i].table
+			err = db.Exec("DELETE FROM " + db.Statement.Quote(table)).Error
+			if err != nil {
+				return fmt.Errorf("%s clean %s : %s", file, table, err.Error())
+			}
+		}
+
+		for _, fixture := range fixtures {
+			if len(fixture.rows) == 0 {
+				continue
+			}
+
+			err = db.Table(fixture.table).Create(&fixture.rows).Error
+			if err != nil {
+				return fmt.Errorf("%s load %s : %s", file, fixture.table, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package mysql
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fixtureUser struct {
+	Id       int64  `gorm:"column:id;primary_key"`
+	Username string `gorm:"column:username"`
+}
+
+func (fixtureUser) TableName() string {
+	return "user"
+}
+
+type fixtureTest struct {
+	Id    int64  `gorm:"column:id;primary_key"`
+	Title string `gorm:"column:title"`
+}
+
+func (fixtureTest) TableName() string {
+	return "test"
+}
+
+func TestClient_SqliteFixtures(t *testing.T) {
+	clientOnce = sync.Once{}
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithDbConfig([]DbConfig{{Driver: DriverSqlite, Db: "fixture_db"}}),
+	)
+	defer func() {
+		client.Close()
+		clientOnce = sync.Once{}
+	}()
+
+	assert.Nil(t, client.AutoMigrate("fixture_db", &fixtureUser{}, &fixtureTest{}))
+	assert.Nil(t, client.LoadFixtures("fixture_db", "testdata/fixtures.yaml"))
+	// 重复加载先清空再写入
+	assert.Nil(t, client.LoadFixtures("fixture_db", "testdata/fixtures.yaml"))
+
+	ctx := context.Background()
+	repo := NewRepository[fixtureUser](client, "fixture_db")
+
+	count, err := repo.Count(ctx, "1 = 1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	user, err := repo.FindById(ctx, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "test2", user.Username)
+
+	ts := &fixtureTest{}
+	assert.Nil(t, client.GetDb("fixture_db").First(ts).Error)
+	assert.Equal(t, "title1", ts.Title)
+
+	assert.NotNil(t, client.LoadFixtures("fixture_db", "testdata/not_exists.yaml"))
+}
+
+func TestParseFixtures_Order(t *testing.T) {
+	content := []byte(`
+order:
+  - {id: 1}
+order_item:
+  - {id: 1, order_id: 1}
+  - {id: 2, order_id: 1}
+refund:
+  - {id: 1, order_id: 1}
+refund_item:
+empty: []
+`)
+
+	fixtures, err := parseFixtures(content)
+	assert.Nil(t, err)
+
+	tables := make([]string, 0, len(fixtures))
+	for _, fixture := range fixtures {
+		tables = append(tables, fixture.table)
+	}
+	assert.Equal(t, []string{"order", "order_item", "refund", "refund_item", "empty"}, tables)
+	assert.Len(t, fixtures[1].rows, 2)
+	assert.Equal(t, 1, fixtures[1].rows[1]["order_id"])
+	assert.Len(t, fixtures[3].rows, 0)
+}
@@ -29,8 +29,17 @@ var mysqlStats = prometheus.NewGaugeVec(
 	[]string{"db", "stats"},
 )
 
+var mysqlPoolTune = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mysql_pool_tune_total",
+		Help: "Number of pool size adjustments",
+	},
+	[]string{"db", "action"},
+)
+
 func init() {
 	prometheus.MustRegister(mysqlTotal)
 	prometheus.MustRegister(mysqlDuration)
 	prometheus.MustRegister(mysqlStats)
+	prometheus.MustRegister(mysqlPoolTune)
 }
@@ -9,6 +9,8 @@ import (
 
 	"code.jshyjdtech.com/godev/hykit/config"
 	"code.jshyjdtech.com/godev/hykit/log"
+	"code.jshyjdtech.com/godev/hykit/pkg/wxalarm"
+	"github.com/glebarez/sqlite"
 	"github.com/prometheus/client_golang/prometheus"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -18,6 +20,13 @@ var clientOnce sync.Once
 
 var onceClient *Client
 
+const (
+	DriverMysql = "mysql"
+
+	// DriverSqlite 纯 Go 实现的 sqlite, 用于单元测试, dsn 为空时使用内存库
+	DriverSqlite = "sqlite"
+)
+
 type Client struct {
 	gdbs map[string]*gorm.DB
 
@@ -34,6 +43,12 @@ type Client struct {
 	stateTicker time.Duration
 
 	gormConfig *gorm.Config
+
+	tuners map[string]*poolTuner
+
+	alarm *wxalarm.WXAlarm
+
+	audit *AuditPlugin
 }
 
 type Option func(c *Client)
@@ -41,17 +56,29 @@ type Option func(c *Client)
 type ClientOptions struct{}
 
 type DbConfig struct {
+	// Driver mysql | sqlite, 默认 mysql
+	Driver      string `json:"driver" yaml:"driver"`
 	Db          string `json:"db" yaml:"db"`
 	Dsn         string `json:"dsn" yaml:"dsn"`
 	MaxIdle     int    `json:"max_idle" yaml:"maxidle"`
 	MaxOpen     int    `json:"max_open" yaml:"maxopen"`
 	MaxLifetime int    `json:"max_lifetime" yaml:"maxlifetime"`
+
+	// AutoTune 根据等待次数在 [MinOpen, MaxOpenLimit] 内自动调整 MaxOpen,
+	// MaxIdle 按初始比例跟随, MaxOpenLimit 未配置或小于 MaxOpen 时上限为 MaxOpen
+	AutoTune     bool `json:"auto_tune" yaml:"autotune"`
+	MinOpen      int  `json:"min_open" yaml:"minopen"`
+	MaxOpenLimit int  `json:"max_open_limit" yaml:"maxopenlimit"`
+
+	// SaturatedIntervals 连续饱和多少个统计周期后告警, 默认 3
+	SaturatedIntervals int `json:"saturated_intervals" yaml:"saturatedintervals"`
 }
 
 func NewClient(options ...Option) *Client {
 	clientOnce.Do(func() {
 		onceClient = &Client{
 			gdbs:        make(map[string]*gorm.DB),
+			tuners:      make(map[string]*poolTuner),
 			proxy:       make([]func() interface{}, 0),
 			stateTicker: 10 * time.Second,
 			closeChan:   make(chan bool, 1),
@@ -69,6 +96,10 @@ func NewClient(options ...Option) *Client {
 			onceClient.logger = log.NewLogger()
 		}
 
+		if onceClient.gormConfig == nil {
+			onceClient.gormConfig = &gorm.Config{}
+		}
+
 		onceClient.init()
 	})
 
@@ -105,6 +136,20 @@ func (ClientOptions) WithStateTicker(stateTicker time.Duration) Option {
 	}
 }
 
+// WithAlarm 连接池饱和时通过企业微信告警
+func (ClientOptions) WithAlarm(alarm *wxalarm.WXAlarm) Option {
+	return func(m *Client) {
+		m.alarm = alarm
+	}
+}
+
+// WithAudit 为所有库注册审计插件
+func (ClientOptions) WithAudit(audit *AuditPlugin) Option {
+	return func(m *Client) {
+		m.audit = audit
+	}
+}
+
 func (ClientOptions) WithGormConfig(gormConfig *gorm.Config) Option {
 	/*增加gorm配置*/
 	return func(m *Client) {
@@ -129,7 +174,7 @@ func (c *Client) init() {
 	for _, dbConfig := range dbConfigs {
 		var DB *gorm.DB
 		var dbc *sql.DB
-		DB, err = gorm.Open(mysql.Open(dbConfig.Dsn), c.gormConfig)
+		DB, err = gorm.Open(dialector(dbConfig), c.gormConfig)
 		if err != nil {
 			c.logger.Panicf("[db] %s open error : %s", dbConfig.Db, err.Error())
 			return
@@ -140,6 +185,11 @@ func (c *Client) init() {
 			return
 		}
 
+		// sqlite 内存库在最后一个连接关闭后销毁, 至少保留一个空闲连接
+		if strings.ToLower(dbConfig.Driver) == DriverSqlite && dbConfig.MaxIdle == 0 {
+			dbConfig.MaxIdle = 1
+		}
+
 		dbc.SetMaxOpenConns(dbConfig.MaxOpen)
 		dbc.SetMaxIdleConns(dbConfig.MaxIdle)
 		dbc.SetConnMaxLifetime(time.Duration(dbConfig.MaxLifetime) * time.Minute)
@@ -155,10 +205,46 @@ func (c *Client) init() {
 		}*/
 
 		c.setDb(dbConfig.Db, DB)
+		c.tuners[strings.ToLower(dbConfig.Db)] = newPoolTuner(dbConfig, c.logger, c.sendAlarm)
 
-		go c.Stats()
 		c.logger.Infof("[mysql] %s init success", dbConfig.Db)
 	}
+
+	if c.audit != nil {
+		for dbName, db := range c.gdbs {
+			// 多个库共用同一个 gorm.Config 时插件只需注册一次
+			err = db.Use(c.audit)
+			if err != nil && err != gorm.ErrRegistered {
+				c.logger.Panicf("[db] %s use audit error : %s", dbName, err.Error())
+			}
+		}
+	}
+
+	go c.Stats()
+}
+
+func (c *Client) sendAlarm(ctx context.Context, message string) {
+	if c.alarm == nil {
+		return
+	}
+
+	_, err := c.alarm.SendTextMessage(ctx, message, nil, nil)
+	if err != nil {
+		c.logger.Errorc(ctx, "[mysql] send alarm error : %s", err.Error())
+	}
+}
+
+func dialector(dbConfig DbConfig) gorm.Dialector {
+	if strings.ToLower(dbConfig.Driver) == DriverSqlite {
+		dsn := dbConfig.Dsn
+		if dsn == "" {
+			// 同一个库的多个连接共享同一个内存库
+			dsn = "file:" + dbConfig.Db + "?mode=memory&cache=shared"
+		}
+		return sqlite.Open(dsn)
+	}
+
+	return mysql.Open(dbConfig.Dsn)
 }
 
 func (c *Client) setDb(dbName string, gdb *gorm.DB) {
@@ -237,6 +323,11 @@ func (c *Client) Close() {
 			c.logger.Errorf(err.Error())
 		}
 	}
+
+	select {
+	case c.closeChan <- true:
+	default:
+	}
 }
 
 func (c *Client) Stats() {
@@ -256,20 +347,11 @@ func (c *Client) Stats() {
 				sqldb, _ := db.DB()
 				stats = sqldb.Stats()
 
-				maxOpenConnLab := prometheus.Labels{"db": dbName, "stats": "max_open_conn"}
-				mysqlStats.With(maxOpenConnLab).Set(float64(stats.MaxOpenConnections))
-
-				openConnLab := prometheus.Labels{"db": dbName, "stats": "open_conn"}
-				mysqlStats.With(openConnLab).Set(float64(stats.OpenConnections))
+				c.exportStats(dbName, stats)
 
-				inUseLab := prometheus.Labels{"db": dbName, "stats": "in_use"}
-				mysqlStats.With(inUseLab).Set(float64(stats.InUse))
-
-				idleLab := prometheus.Labels{"db": dbName, "stats": "idle"}
-				mysqlStats.With(idleLab).Set(float64(stats.Idle))
-
-				waitCountLab := prometheus.Labels{"db": dbName, "stats": "wait_count"}
-				mysqlStats.With(waitCountLab).Set(float64(stats.WaitCount))
+				if tuner, ok := c.tuners[dbName]; ok {
+					tuner.observe(sqldb, stats)
+				}
 			}
 		case <-c.closeChan:
 			c.logger.Infof("stop stats")
@@ -280,3 +362,32 @@ func (c *Client) Stats() {
 Stop:
 	ticker.Stop()
 }
+
+func (c *Client) exportStats(dbName string, stats sql.DBStats) {
+	maxOpenConnLab := prometheus.Labels{"db": dbName, "stats": "max_open_conn"}
+	mysqlStats.With(maxOpenConnLab).Set(float64(stats.MaxOpenConnections))
+
+	openConnLab := prometheus.Labels{"db": dbName, "stats": "open_conn"}
+	mysqlStats.With(openConnLab).Set(float64(stats.OpenConnections))
+
+	inUseLab := prometheus.Labels{"db": dbName, "stats": "in_use"}
+	mysqlStats.With(inUseLab).Set(float64(stats.InUse))
+
+	idleLab := prometheus.Labels{"db": dbName, "stats": "idle"}
+	mysqlStats.With(idleLab).Set(float64(stats.Idle))
+
+	waitCountLab := prometheus.Labels{"db": dbName, "stats": "wait_count"}
+	mysqlStats.With(waitCountLab).Set(float64(stats.WaitCount))
+
+	waitDurationLab := prometheus.Labels{"db": dbName, "stats": "wait_duration_seconds"}
+	mysqlStats.With(waitDurationLab).Set(stats.WaitDuration.Seconds())
+
+	maxIdleClosedLab := prometheus.Labels{"db": dbName, "stats": "max_idle_closed"}
+	mysqlStats.With(maxIdleClosedLab).Set(float64(stats.MaxIdleClosed))
+
+	maxIdleTimeClosedLab := prometheus.Labels{"db": dbName, "stats": "max_idle_time_closed"}
+	mysqlStats.With(maxIdleTimeClosedLab).Set(float64(stats.MaxIdleTimeClosed))
+
+	maxLifetimeClosedLab := prometheus.Labels{"db": dbName, "stats": "max_lifetime_closed"}
+	mysqlStats.With(maxLifetimeClosedLab).Set(float64(stats.MaxLifetimeClosed))
+}
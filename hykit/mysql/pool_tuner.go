@@ -0,0 +1,194 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"code.jshyjdtech.com/godev/hykit/pkg/wxalarm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// 连续多少个空闲周期后才开始收缩连接池
+	tuneCalmIntervals = 6
+
+	defaultSaturatedIntervals = 3
+)
+
+// poolSetter *sql.DB 的连接池设置.
+type poolSetter interface {
+	SetMaxOpenConns(n int)
+
+	SetMaxIdleConns(n int)
+}
+
+// poolTuner 根据等待次数在 [minOpen, maxOpen] 区间内调整连接池大小,
+// 连续 saturatedIntervals 个周期饱和时发出告警.
+type poolTuner struct {
+	db string
+
+	autoTune bool
+
+	minOpen int
+
+	maxOpen int
+
+	// MaxIdle/MaxOpen 的初始比例, 调整 MaxOpen 时 MaxIdle 等比例跟随
+	idleRatio float64
+
+	curOpen int
+
+	saturatedIntervals int
+
+	lastWaitCount int64
+
+	saturated int
+
+	calm int
+
+	logger log.Logger
+
+	alarm func(ctx context.Context, message string)
+}
+
+func newPoolTuner(dbConfig DbConfig, logger log.Logger,
+	alarm func(ctx context.Context, message string)) *poolTuner {
+	pt := &poolTuner{
+		db:                 dbConfig.Db,
+		autoTune:           dbConfig.AutoTune,
+		minOpen:            dbConfig.MinOpen,
+		maxOpen:            dbConfig.MaxOpenLimit,
+		curOpen:            dbConfig.MaxOpen,
+		saturatedIntervals: dbConfig.SaturatedIntervals,
+		logger:             logger,
+		alarm:              alarm,
+	}
+
+	if pt.saturatedIntervals == 0 {
+		pt.saturatedIntervals = defaultSaturatedIntervals
+	}
+
+	// MaxOpen 为 0 表示不限制连接数, 没有调整的基准
+	if pt.curOpen <= 0 {
+		if pt.autoTune {
+			logger.Warnf("[mysql] %s max_open is unlimited, auto tune disabled", pt.db)
+		}
+		pt.autoTune = false
+		return pt
+	}
+
+	if pt.minOpen <= 0 || pt.minOpen > pt.curOpen {
+		pt.minOpen = pt.curOpen
+	}
+
+	// 未配置或小于 MaxOpen 时以 MaxOpen 为上限, 不超过 DBA 设置的连接数
+	if pt.maxOpen < pt.curOpen {
+		if pt.autoTune {
+			logger.Warnf("[mysql] %s max_open_limit %d is less than max_open %d, use max_open as limit",
+				pt.db, pt.maxOpen, pt.curOpen)
+		}
+		pt.maxOpen = pt.curOpen
+	}
+
+	pt.idleRatio = float64(dbConfig.MaxIdle) / float64(dbConfig.MaxOpen)
+
+	return pt
+}
+
+// observe 每个统计周期调用一次.
+func (pt *poolTuner) observe(setter poolSetter, stats sql.DBStats) {
+	waits := stats.WaitCount - pt.lastWaitCount
+	pt.lastWaitCount = stats.WaitCount
+
+	if waits > 0 {
+		pt.calm = 0
+		pt.saturated++
+		pt.grow(setter)
+	} else {
+		pt.saturated = 0
+		if stats.InUse <= stats.MaxOpenConnections/2 {
+			pt.calm++
+		} else {
+			pt.calm = 0
+		}
+
+		if pt.calm >= tuneCalmIntervals {
+			pt.calm = 0
+			pt.shrink(setter)
+		}
+	}
+
+	if pt.saturated >= pt.saturatedIntervals {
+		pt.saturated = 0
+		pt.warn(stats, waits)
+	}
+}
+
+func (pt *poolTuner) grow(setter poolSetter) {
+	if !pt.autoTune || pt.curOpen >= pt.maxOpen {
+		return
+	}
+
+	step := pt.curOpen / 4
+	if step == 0 {
+		step = 1
+	}
+
+	pt.resize(setter, pt.curOpen+step)
+}
+
+func (pt *poolTuner) shrink(setter poolSetter) {
+	if !pt.autoTune || pt.curOpen <= pt.minOpen {
+		return
+	}
+
+	step := pt.curOpen / 8
+	if step == 0 {
+		step = 1
+	}
+
+	pt.resize(setter, pt.curOpen-step)
+}
+
+func (pt *poolTuner) resize(setter poolSetter, open int) {
+	if open > pt.maxOpen {
+		open = pt.maxOpen
+	}
+
+	if open < pt.minOpen {
+		open = pt.minOpen
+	}
+
+	idle := int(float64(open) * pt.idleRatio)
+
+	pt.logger.Infof("[mysql] %s tune max_open %d -> %d, max_idle -> %d",
+		pt.db, pt.curOpen, open, idle)
+
+	action := "grow"
+	if open < pt.curOpen {
+		action = "shrink"
+	}
+	mysqlPoolTune.With(prometheus.Labels{"db": pt.db, "action": action}).Inc()
+
+	// 先调 MaxOpen 再调 MaxIdle, 避免 MaxIdle 被截断
+	setter.SetMaxOpenConns(open)
+	setter.SetMaxIdleConns(idle)
+	pt.curOpen = open
+}
+
+func (pt *poolTuner) warn(stats sql.DBStats, waits int64) {
+	message := fmt.Sprintf(wxalarm.NotifyTemplate, "mysql",
+		time.Now().Format("2006-01-02 15:04:05"), pt.db+" 连接池饱和",
+		fmt.Sprintf("连续 %d 个周期等待连接, 本周期等待 %d 次, max_open %d, in_use %d, wait_duration %s",
+			pt.saturatedIntervals, waits, stats.MaxOpenConnections, stats.InUse,
+			stats.WaitDuration.String()))
+
+	pt.logger.Warnf(message)
+
+	if pt.alarm != nil {
+		pt.alarm(context.Background(), message)
+	}
+}
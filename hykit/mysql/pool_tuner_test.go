@@ -0,0 +1,94 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type spySetter struct {
+	maxOpen int
+	maxIdle int
+}
+
+func (s *spySetter) SetMaxOpenConns(n int) { s.maxOpen = n }
+
+func (s *spySetter) SetMaxIdleConns(n int) { s.maxIdle = n }
+
+func TestPoolTuner_GrowAndAlarm(t *testing.T) {
+	var alarms int
+	tuner := newPoolTuner(DbConfig{
+		Db:                 "test",
+		MaxOpen:            8,
+		MaxIdle:            4,
+		AutoTune:           true,
+		MaxOpenLimit:       12,
+		SaturatedIntervals: 3,
+	}, log.NewLogger(), func(ctx context.Context, message string) {
+		alarms++
+	})
+
+	setter := &spySetter{}
+	tuner.observe(setter, sql.DBStats{MaxOpenConnections: 8, InUse: 8, WaitCount: 5})
+	assert.Equal(t, 10, setter.maxOpen)
+	assert.Equal(t, 5, setter.maxIdle)
+
+	tuner.observe(setter, sql.DBStats{MaxOpenConnections: 10, InUse: 10, WaitCount: 9})
+	assert.Equal(t, 12, setter.maxOpen)
+	assert.Equal(t, 0, alarms)
+
+	tuner.observe(setter, sql.DBStats{MaxOpenConnections: 12, InUse: 12, WaitCount: 20})
+	assert.Equal(t, 12, setter.maxOpen)
+	assert.Equal(t, 1, alarms)
+}
+
+func TestPoolTuner_Shrink(t *testing.T) {
+	tuner := newPoolTuner(DbConfig{
+		Db:       "test",
+		MaxOpen:  16,
+		MaxIdle:  16,
+		AutoTune: true,
+		MinOpen:  15,
+	}, log.NewLogger(), nil)
+	assert.Equal(t, 16, tuner.maxOpen)
+
+	setter := &spySetter{}
+	for i := 0; i < tuneCalmIntervals; i++ {
+		tuner.observe(setter, sql.DBStats{MaxOpenConnections: 16, InUse: 1})
+	}
+	assert.Equal(t, 15, setter.maxOpen)
+	assert.Equal(t, 15, setter.maxIdle)
+
+	setter = &spySetter{}
+	for i := 0; i < tuneCalmIntervals; i++ {
+		tuner.observe(setter, sql.DBStats{MaxOpenConnections: 15, InUse: 1})
+	}
+	assert.Equal(t, 0, setter.maxOpen)
+}
+
+func TestPoolTuner_Unlimited(t *testing.T) {
+	tuner := newPoolTuner(DbConfig{Db: "test", AutoTune: true}, log.NewLogger(), nil)
+	assert.False(t, tuner.autoTune)
+
+	setter := &spySetter{}
+	tuner.observe(setter, sql.DBStats{WaitCount: 3})
+	assert.Equal(t, 0, setter.maxOpen)
+}
+
+func TestPoolTuner_NoLimit(t *testing.T) {
+	tuner := newPoolTuner(DbConfig{
+		Db:       "test",
+		MaxOpen:  8,
+		MaxIdle:  8,
+		AutoTune: true,
+	}, log.NewLogger(), nil)
+	assert.Equal(t, 8, tuner.maxOpen)
+
+	// 未配置 MaxOpenLimit 时不超过 MaxOpen
+	setter := &spySetter{}
+	tuner.observe(setter, sql.DBStats{MaxOpenConnections: 8, InUse: 8, WaitCount: 5})
+	assert.Equal(t, 0, setter.maxOpen)
+}
@@ -0,0 +1,527 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// List 最多返回的条数
+	defaultListLimit = 10
+
+	defaultPageSize = 20
+
+	maxPageSize = 1000
+
+	defaultBatchSize = 500
+)
+
+var (
+	ErrNoDelField = errors.New("not found is_del / is_deleted / is_delete")
+
+	ErrNoVersionField = errors.New("not found version field")
+
+	// ErrOptimisticLock 版本号不匹配, 记录已被其他请求修改或不存在
+	ErrOptimisticLock = errors.New("optimistic lock conflict")
+
+	// ErrCursorKey 游标分页只支持整数主键
+	ErrCursorKey = errors.New("cursor requires an integer primary key")
+)
+
+// DelKeyer db2entity 为含软删除字段的表生成 DelKey().
+type DelKeyer interface {
+	DelKey() string
+}
+
+// CurTimeStamper db2entity 为默认值是 CURRENT_TIMESTAMP 的列生成 CurTimeStampKeys().
+type CurTimeStamper interface {
+	CurTimeStampKeys() []string
+}
+
+// OnUpdateStamper db2entity 为 on update CURRENT_TIMESTAMP 的列生成 OnUpdateKeys().
+type OnUpdateStamper interface {
+	OnUpdateKeys() []string
+}
+
+// Repository 基于 gorm 的泛型 DAO, T 为 db2entity 生成的实体.
+// 软删除字段存在时, 查询自动过滤已删除的记录, DelById 只做逻辑删除.
+type Repository[T any] struct {
+	client *Client
+
+	dbName string
+
+	slaveDbName string
+
+	table string
+
+	priKey string
+
+	delKey string
+
+	versionKey string
+
+	// 写入时零值填当前时间的列
+	curTimeKeys []string
+
+	// 更新时填当前时间的列
+	onUpdateKeys []string
+
+	schema *schema.Schema
+}
+
+type repositoryConfig struct {
+	table string
+
+	slaveDbName string
+
+	versionKey string
+}
+
+type RepositoryOption func(*repositoryConfig)
+
+type RepositoryOptions struct{}
+
+// WithTable 默认使用实体的 TableName().
+func (RepositoryOptions) WithTable(table string) RepositoryOption {
+	return func(rc *repositoryConfig) {
+		rc.table = table
+	}
+}
+
+// WithSlave 读操作使用的从库, 从库未配置时使用主库.
+func (RepositoryOptions) WithSlave(slaveDbName string) RepositoryOption {
+	return func(rc *repositoryConfig) {
+		rc.slaveDbName = slaveDbName
+	}
+}
+
+// WithVersionField 乐观锁版本号字段, 默认 version.
+func (RepositoryOptions) WithVersionField(versionKey string) RepositoryOption {
+	return func(rc *repositoryConfig) {
+		rc.versionKey = versionKey
+	}
+}
+
+func NewRepository[T any](client *Client, dbName string, options ...RepositoryOption) *Repository[T] {
+	rc := &repositoryConfig{}
+	for _, option := range options {
+		option(rc)
+	}
+
+	r := &Repository[T]{
+		client:      client,
+		dbName:      strings.ToLower(dbName),
+		slaveDbName: strings.ToLower(rc.slaveDbName),
+		table:       rc.table,
+	}
+
+	db, ok := client.gdbs[r.dbName]
+	if !ok {
+		client.logger.Panicf("[db] %s not found", dbName)
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		client.logger.Panicf("[db] %s parse %T error : %s", dbName, *new(T), err.Error())
+	}
+	r.schema = stmt.Schema
+
+	if r.table == "" {
+		r.table = r.schema.Table
+	}
+
+	if r.schema.PrioritizedPrimaryField != nil {
+		r.priKey = r.schema.PrioritizedPrimaryField.DBName
+	} else {
+		r.priKey = "id"
+	}
+
+	r.delKey = delKeyOf[T](r.schema)
+	r.curTimeKeys, r.onUpdateKeys = timeKeysOf[T]()
+
+	versionKey := rc.versionKey
+	if versionKey == "" {
+		versionKey = "version"
+	}
+	if _, ok := r.schema.FieldsByDBName[versionKey]; ok {
+		r.versionKey = versionKey
+	}
+
+	return r
+}
+
+// delKeyOf 优先使用实体的 DelKey(), 否则按 db2entity CheckDelField 的规则查找字段.
+func delKeyOf[T any](s *schema.Schema) string {
+	var t T
+	if dk, ok := interface{}(t).(DelKeyer); ok {
+		return dk.DelKey()
+	}
+
+	if dk, ok := interface{}(&t).(DelKeyer); ok {
+		return dk.DelKey()
+	}
+
+	for _, name := range s.DBNames {
+		if strings.Contains(name, "del") && strings.Contains(name, "is") {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// timeKeysOf 时间戳列只取实体声明的, 其他时间字段(业务日期, 可空列)不自动填充.
+func timeKeysOf[T any]() ([]string, []string) {
+	var t T
+	var curTimeKeys, onUpdateKeys []string
+
+	if cs, ok := interface{}(t).(CurTimeStamper); ok {
+		curTimeKeys = cs.CurTimeStampKeys()
+	} else if cs, ok := interface{}(&t).(CurTimeStamper); ok {
+		curTimeKeys = cs.CurTimeStampKeys()
+	}
+
+	if us, ok := interface{}(t).(OnUpdateStamper); ok {
+		onUpdateKeys = us.OnUpdateKeys()
+	} else if us, ok := interface{}(&t).(OnUpdateStamper); ok {
+		onUpdateKeys = us.OnUpdateKeys()
+	}
+
+	return curTimeKeys, onUpdateKeys
+}
+
+// GetDb master.
+func (r *Repository[T]) GetDb(ctx context.Context) *gorm.DB {
+	return r.client.GetCtxDb(ctx, r.dbName).Table(r.table)
+}
+
+// GetSlaveDb slave, 未配置从库时返回主库.
+func (r *Repository[T]) GetSlaveDb(ctx context.Context) *gorm.DB {
+	if r.slaveDbName != "" {
+		if _, ok := r.client.gdbs[r.slaveDbName]; ok {
+			return r.client.GetCtxDb(ctx, r.slaveDbName).Table(r.table)
+		}
+	}
+
+	return r.GetDb(ctx)
+}
+
+// notDeleted 过滤已软删除的记录.
+func (r *Repository[T]) notDeleted(db *gorm.DB) *gorm.DB {
+	if r.delKey == "" {
+		return db
+	}
+
+	return db.Where(clause.Eq{Column: clause.Column{Name: r.delKey}, Value: 0})
+}
+
+// fillTimeStamp CURRENT_TIMESTAMP 和 on update CURRENT_TIMESTAMP 列为零值时填当前时间.
+func (r *Repository[T]) fillTimeStamp(ctx context.Context, e *T) {
+	now := time.Now()
+	rv := reflect.ValueOf(e).Elem()
+	for _, keys := range [][]string{r.curTimeKeys, r.onUpdateKeys} {
+		for _, key := range keys {
+			field := r.schema.LookUpField(key)
+			if field == nil {
+				continue
+			}
+
+			if _, zero := field.ValueOf(ctx, rv); zero {
+				_ = field.Set(ctx, rv, now)
+			}
+		}
+	}
+}
+
+// withUpdateTime 复制 update, 未指定的 on update CURRENT_TIMESTAMP 列填当前时间.
+func (r *Repository[T]) withUpdateTime(update map[string]interface{}) map[string]interface{} {
+	updates := make(map[string]interface{}, len(update)+len(r.onUpdateKeys)+1)
+	for k, v := range update {
+		updates[k] = v
+	}
+
+	now := time.Now()
+	for _, key := range r.onUpdateKeys {
+		if _, ok := updates[key]; !ok {
+			updates[key] = now
+		}
+	}
+
+	return updates
+}
+
+// Create 写入后主键回填到 e.
+func (r *Repository[T]) Create(ctx context.Context, e *T) error {
+	r.fillTimeStamp(ctx, e)
+	return r.GetDb(ctx).Create(e).Error
+}
+
+// BatchCreate batchSize 为 0 时每批 500 条.
+func (r *Repository[T]) BatchCreate(ctx context.Context, es []*T, batchSize int) error {
+	if len(es) == 0 {
+		return nil
+	}
+
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	for _, e := range es {
+		r.fillTimeStamp(ctx, e)
+	}
+
+	return r.GetDb(ctx).CreateInBatches(es, batchSize).Error
+}
+
+// Upsert 唯一键冲突时更新 updateColumns, 未指定时更新全部字段.
+func (r *Repository[T]) Upsert(ctx context.Context, es []*T, updateColumns ...string) error {
+	if len(es) == 0 {
+		return nil
+	}
+
+	for _, e := range es {
+		r.fillTimeStamp(ctx, e)
+	}
+
+	onConflict := clause.OnConflict{UpdateAll: true}
+	if len(updateColumns) > 0 {
+		onConflict = clause.OnConflict{DoUpdates: clause.AssignmentColumns(updateColumns)}
+	}
+
+	return r.GetDb(ctx).Clauses(onConflict).CreateInBatches(es, defaultBatchSize).Error
+}
+
+// FindById 记录不存在时返回 gorm.ErrRecordNotFound.
+func (r *Repository[T]) FindById(ctx context.Context, id interface{}) (T, error) {
+	var e T
+	err := r.notDeleted(r.GetSlaveDb(ctx)).
+		Where(clause.Eq{Column: clause.Column{Name: r.priKey}, Value: id}).
+		First(&e).Error
+
+	return e, err
+}
+
+// Find ctx, "id,name", "name = ?", "test".
+func (r *Repository[T]) Find(ctx context.Context, squery,
+	wquery interface{}, args ...interface{}) (T, error) {
+	var e T
+	err := r.notDeleted(r.GetSlaveDb(ctx)).Select(squery).
+		Where(wquery, args...).First(&e).Error
+
+	return e, err
+}
+
+// List ctx, "id,name", "name = ?", "test"
+// return a max of 10 pieces of data.
+func (r *Repository[T]) List(ctx context.Context, squery,
+	wquery interface{}, args ...interface{}) ([]T, error) {
+	es := make([]T, 0)
+	err := r.notDeleted(r.GetSlaveDb(ctx)).Select(squery).
+		Where(wquery, args...).Limit(defaultListLimit).Find(&es).Error
+
+	return es, err
+}
+
+// Count ctx, "name = ?", "test".
+func (r *Repository[T]) Count(ctx context.Context,
+	query interface{}, args ...interface{}) (int64, error) {
+	var count int64
+	err := r.notDeleted(r.GetSlaveDb(ctx)).Where(query, args...).Count(&count).Error
+
+	return count, err
+}
+
+// PageQuery 偏移分页, Page 从 1 开始, Order 默认主键升序.
+type PageQuery struct {
+	Page int
+
+	PageSize int
+
+	Order string
+}
+
+type PageResult[T any] struct {
+	List []T
+
+	Total int64
+
+	Page int
+
+	PageSize int
+}
+
+// Page ctx, PageQuery{Page: 1, PageSize: 20}, "name = ?", "test".
+func (r *Repository[T]) Page(ctx context.Context, page PageQuery,
+	wquery interface{}, args ...interface{}) (*PageResult[T], error) {
+	if page.Page <= 0 {
+		page.Page = 1
+	}
+
+	if page.PageSize <= 0 {
+		page.PageSize = defaultPageSize
+	}
+
+	if page.PageSize > maxPageSize {
+		page.PageSize = maxPageSize
+	}
+
+	if page.Order == "" {
+		page.Order = r.priKey
+	}
+
+	result := &PageResult[T]{
+		List:     make([]T, 0),
+		Page:     page.Page,
+		PageSize: page.PageSize,
+	}
+
+	db := r.notDeleted(r.GetSlaveDb(ctx))
+	if wquery != nil {
+		db = db.Where(wquery, args...)
+	}
+
+	err := db.Session(&gorm.Session{}).Count(&result.Total).Error
+	if err != nil {
+		return result, err
+	}
+
+	if result.Total == 0 {
+		return result, nil
+	}
+
+	err = db.Order(page.Order).Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).Find(&result.List).Error
+
+	return result, err
+}
+
+// CursorQuery 以整数主键为游标分页, Cursor 为上一页最后一条的主键, 首页传 0.
+type CursorQuery struct {
+	Cursor int64
+
+	Limit int
+
+	Desc bool
+}
+
+type CursorResult[T any] struct {
+	List []T
+
+	NextCursor int64
+
+	HasMore bool
+}
+
+// Cursor ctx, CursorQuery{Limit: 20}, "name = ?", "test".
+func (r *Repository[T]) Cursor(ctx context.Context, cursor CursorQuery,
+	wquery interface{}, args ...interface{}) (*CursorResult[T], error) {
+	if field := r.schema.PrioritizedPrimaryField; field != nil &&
+		field.DataType != schema.Int && field.DataType != schema.Uint {
+		return nil, ErrCursorKey
+	}
+
+	if cursor.Limit <= 0 {
+		cursor.Limit = defaultPageSize
+	}
+
+	if cursor.Limit > maxPageSize {
+		cursor.Limit = maxPageSize
+	}
+
+	result := &CursorResult[T]{List: make([]T, 0)}
+
+	db := r.notDeleted(r.GetSlaveDb(ctx))
+	if wquery != nil {
+		db = db.Where(wquery, args...)
+	}
+
+	column := clause.Column{Name: r.priKey}
+	if cursor.Desc {
+		if cursor.Cursor > 0 {
+			db = db.Where(clause.Lt{Column: column, Value: cursor.Cursor})
+		}
+		db = db.Order(clause.OrderByColumn{Column: column, Desc: true})
+	} else {
+		db = db.Where(clause.Gt{Column: column, Value: cursor.Cursor}).
+			Order(clause.OrderByColumn{Column: column})
+	}
+
+	// 多取一条判断是否还有下一页
+	err := db.Limit(cursor.Limit + 1).Find(&result.List).Error
+	if err != nil {
+		return result, err
+	}
+
+	if len(result.List) > cursor.Limit {
+		result.HasMore = true
+		result.List = result.List[:cursor.Limit]
+	}
+
+	if len(result.List) > 0 && r.schema.PrioritizedPrimaryField != nil {
+		last := reflect.ValueOf(&result.List[len(result.List)-1]).Elem()
+		priValue, _ := r.schema.PrioritizedPrimaryField.ValueOf(ctx, last)
+		result.NextCursor = cast.ToInt64(priValue)
+	}
+
+	return result, nil
+}
+
+// Update ctx, map[string]interface{}{"name": "hello"}, "name = ?", "test"
+// return RowsAffected, error.
+func (r *Repository[T]) Update(ctx context.Context,
+	update map[string]interface{}, query interface{}, args ...interface{}) (int64, error) {
+	db := r.notDeleted(r.GetDb(ctx)).Where(query, args...).Updates(r.withUpdateTime(update))
+
+	return db.RowsAffected, db.Error
+}
+
+// UpdateByVersion 乐观锁更新, 版本号匹配时更新并把版本号加 1,
+// 否则返回 ErrOptimisticLock.
+func (r *Repository[T]) UpdateByVersion(ctx context.Context, id interface{},
+	version int64, update map[string]interface{}) error {
+	if r.versionKey == "" {
+		return ErrNoVersionField
+	}
+
+	// 不修改调用方的 update, 重试时可以复用
+	updates := r.withUpdateTime(update)
+	updates[r.versionKey] = gorm.Expr(r.versionKey+" + ?", 1)
+
+	db := r.notDeleted(r.GetDb(ctx)).
+		Where(clause.Eq{Column: clause.Column{Name: r.priKey}, Value: id}).
+		Where(clause.Eq{Column: clause.Column{Name: r.versionKey}, Value: version}).
+		Updates(updates)
+	if db.Error != nil {
+		return db.Error
+	}
+
+	if db.RowsAffected == 0 {
+		return ErrOptimisticLock
+	}
+
+	return nil
+}
+
+// DelById 逻辑删除, 没有软删除字段时返回 ErrNoDelField.
+func (r *Repository[T]) DelById(ctx context.Context, id interface{}) (bool, error) {
+	if r.delKey == "" {
+		return false, ErrNoDelField
+	}
+
+	db := r.GetDb(ctx).
+		Where(clause.Eq{Column: clause.Column{Name: r.priKey}, Value: id}).
+		Updates(r.withUpdateTime(map[string]interface{}{r.delKey: 1}))
+	if db.Error != nil {
+		return false, db.Error
+	}
+
+	return db.RowsAffected > 0, nil
+}
@@ -0,0 +1,300 @@
+package mysql
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type repoUser struct {
+	Id        int64     `gorm:"column:id;primary_key"`
+	Username  string    `gorm:"column:username"`
+	IsDeleted int       `gorm:"column:is_deleted"`
+	Version   int64     `gorm:"column:version"`
+	CreatedAt time.Time `gorm:"column:create_time"`
+	UpdatedAt time.Time `gorm:"column:update_time"`
+	Birthday  time.Time `gorm:"column:birthday"`
+}
+
+func (repoUser) TableName() string {
+	return "user"
+}
+
+func (repoUser) CurTimeStampKeys() []string {
+	return []string{"create_time"}
+}
+
+func (repoUser) OnUpdateKeys() []string {
+	return []string{"update_time"}
+}
+
+type repoLog struct {
+	Id      int64  `gorm:"column:id;primary_key"`
+	Content string `gorm:"column:content"`
+}
+
+// newDryRunClient 只生成 sql 不连接数据库.
+func newDryRunClient(t *testing.T) (*Client, *[]string) {
+	sqls := make([]string, 0)
+
+	gdb, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "root:root@tcp(localhost:3306)/test_db",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true,
+		SkipDefaultTransaction: true})
+	assert.Nil(t, err)
+
+	capture := func(db *gorm.DB) {
+		sqls = append(sqls, db.Dialector.Explain(db.Statement.SQL.String(), db.Statement.Vars...))
+	}
+	assert.Nil(t, gdb.Callback().Query().After("gorm:query").Register("test:capture", capture))
+	assert.Nil(t, gdb.Callback().Update().After("gorm:update").Register("test:capture", capture))
+	assert.Nil(t, gdb.Callback().Create().After("gorm:create").Register("test:capture", capture))
+
+	client := &Client{
+		gdbs:   map[string]*gorm.DB{"test_db": gdb},
+		logger: log.NewLogger(),
+	}
+
+	return client, &sqls
+}
+
+func TestRepository_SoftDelete(t *testing.T) {
+	client, sqls := newDryRunClient(t)
+	ctx := context.Background()
+
+	var options RepositoryOptions
+	repo := NewRepository[repoUser](client, "test_db", options.WithSlave("test_db_slave"))
+	assert.Equal(t, "is_deleted", repo.delKey)
+	assert.Equal(t, "version", repo.versionKey)
+
+	_, _ = repo.FindById(ctx, 1)
+	assert.Equal(t, "SELECT * FROM `user` WHERE `is_deleted` = 0 AND `id` = 1 "+
+		"ORDER BY `user`.`id` LIMIT 1", (*sqls)[0])
+
+	_, _ = repo.Count(ctx, "username = ?", "test")
+	assert.Equal(t, "SELECT count(*) FROM `user` WHERE `is_deleted` = 0 AND username = 'test'", (*sqls)[1])
+
+	_, _ = repo.DelById(ctx, 1)
+	assert.Regexp(t, "^UPDATE `user` SET `is_deleted`=1,`update_time`='[^']+' WHERE `id` = 1$", (*sqls)[2])
+}
+
+func TestRepository_Create(t *testing.T) {
+	client, _ := newDryRunClient(t)
+
+	repo := NewRepository[repoUser](client, "test_db")
+	user := &repoUser{Username: "test"}
+	assert.Nil(t, repo.Create(context.Background(), user))
+	assert.False(t, user.CreatedAt.IsZero())
+	assert.False(t, user.UpdatedAt.IsZero())
+	// 未声明为 CURRENT_TIMESTAMP 的时间字段保持零值
+	assert.True(t, user.Birthday.IsZero())
+
+	createdAt := time.Now().Add(-time.Hour)
+	user = &repoUser{Username: "test", CreatedAt: createdAt}
+	assert.Nil(t, repo.Create(context.Background(), user))
+	assert.Equal(t, createdAt, user.CreatedAt)
+}
+
+func TestRepository_Update(t *testing.T) {
+	client, sqls := newDryRunClient(t)
+
+	repo := NewRepository[repoUser](client, "test_db")
+	update := map[string]interface{}{"username": "test"}
+	_, _ = repo.Update(context.Background(), update, "id = ?", 1)
+	assert.Regexp(t, "^UPDATE `user` SET `update_time`='[^']+',`username`='test' "+
+		"WHERE `is_deleted` = 0 AND id = 1$", (*sqls)[0])
+	assert.Equal(t, map[string]interface{}{"username": "test"}, update)
+
+	birthday := time.Date(2000, 1, 2, 0, 0, 0, 0, time.Local)
+	_, _ = repo.Update(context.Background(),
+		map[string]interface{}{"update_time": birthday}, "id = ?", 1)
+	assert.Equal(t, "UPDATE `user` SET `update_time`='2000-01-02 00:00:00' "+
+		"WHERE `is_deleted` = 0 AND id = 1", (*sqls)[1])
+}
+
+func TestRepository_UpdateByVersion(t *testing.T) {
+	client, sqls := newDryRunClient(t)
+
+	repo := NewRepository[repoUser](client, "test_db")
+	update := map[string]interface{}{"username": "test"}
+	err := repo.UpdateByVersion(context.Background(), 1, 3, update)
+	assert.Equal(t, ErrOptimisticLock, err)
+	assert.Regexp(t, "^UPDATE `user` SET `update_time`='[^']+',`username`='test',`version`=version \\+ 1 "+
+		"WHERE `is_deleted` = 0 AND `id` = 1 AND `version` = 3$", (*sqls)[0])
+
+	// 调用方的 update 不被修改, 重试时版本号只加 1
+	assert.Equal(t, map[string]interface{}{"username": "test"}, update)
+	_ = repo.UpdateByVersion(context.Background(), 1, 4, update)
+	assert.Regexp(t, "`version`=version \\+ 1 WHERE", (*sqls)[1])
+
+	logRepo := NewRepository[repoLog](client, "test_db", RepositoryOptions{}.WithTable("log_2022"))
+	err = logRepo.UpdateByVersion(context.Background(), 1, 3, map[string]interface{}{})
+	assert.Equal(t, ErrNoVersionField, err)
+
+	_, err = logRepo.DelById(context.Background(), 1)
+	assert.Equal(t, ErrNoDelField, err)
+}
+
+func TestRepository_Cursor(t *testing.T) {
+	client, sqls := newDryRunClient(t)
+
+	repo := NewRepository[repoLog](client, "test_db")
+	result, err := repo.Cursor(context.Background(), CursorQuery{Cursor: 10, Limit: 5}, nil)
+	assert.Nil(t, err)
+	assert.False(t, result.HasMore)
+	assert.Equal(t, "SELECT * FROM `repo_logs` WHERE `id` > 10 ORDER BY `id` LIMIT 6", (*sqls)[0])
+
+	_, _ = repo.Cursor(context.Background(), CursorQuery{Cursor: 10, Limit: 5, Desc: true},
+		"content = ?", "a")
+	assert.Equal(t, "SELECT * FROM `repo_logs` WHERE content = 'a' AND `id` < 10 "+
+		"ORDER BY `id` DESC LIMIT 6", (*sqls)[1])
+}
+
+type repoToken struct {
+	Token string `gorm:"column:token;primaryKey"`
+}
+
+func TestRepository_CursorStringKey(t *testing.T) {
+	client, sqls := newDryRunClient(t)
+
+	repo := NewRepository[repoToken](client, "test_db")
+	_, err := repo.Cursor(context.Background(), CursorQuery{Limit: 5}, nil)
+	assert.Equal(t, ErrCursorKey, err)
+	assert.Len(t, *sqls, 0)
+}
+
+type repoOrder struct {
+	Id        int64     `gorm:"column:id;primaryKey;autoIncrement"`
+	OrderNo   string    `gorm:"column:order_no;uniqueIndex"`
+	Amount    int64     `gorm:"column:amount"`
+	IsDel     int       `gorm:"column:is_del"`
+	CreatedAt time.Time `gorm:"column:create_time"`
+}
+
+func (repoOrder) TableName() string {
+	return "order"
+}
+
+func (repoOrder) CurTimeStampKeys() []string {
+	return []string{"create_time"}
+}
+
+func newSqliteRepo(t *testing.T) *Repository[repoOrder] {
+	clientOnce = sync.Once{}
+
+	clientOptions := ClientOptions{}
+	client := NewClient(
+		clientOptions.WithDbConfig([]DbConfig{{Driver: DriverSqlite, Db: t.Name()}}),
+	)
+	t.Cleanup(func() {
+		client.Close()
+		clientOnce = sync.Once{}
+	})
+
+	assert.Nil(t, client.AutoMigrate(t.Name(), &repoOrder{}))
+
+	return NewRepository[repoOrder](client, t.Name())
+}
+
+func TestRepository_BatchCreate(t *testing.T) {
+	repo := newSqliteRepo(t)
+	ctx := context.Background()
+
+	assert.Nil(t, repo.BatchCreate(ctx, nil, 0))
+
+	orders := make([]*repoOrder, 0)
+	for i := 1; i <= 5; i++ {
+		orders = append(orders, &repoOrder{OrderNo: "no" + strconv.Itoa(i), Amount: int64(i)})
+	}
+	assert.Nil(t, repo.BatchCreate(ctx, orders, 2))
+
+	for i, order := range orders {
+		assert.Equal(t, int64(i+1), order.Id)
+		assert.False(t, order.CreatedAt.IsZero())
+	}
+
+	count, err := repo.Count(ctx, "amount > ?", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), count)
+
+	// 唯一键冲突时整批失败
+	err = repo.BatchCreate(ctx, []*repoOrder{{OrderNo: "no6"}, {OrderNo: "no1"}}, 0)
+	assert.NotNil(t, err)
+}
+
+func TestRepository_Upsert(t *testing.T) {
+	repo := newSqliteRepo(t)
+	ctx := context.Background()
+
+	assert.Nil(t, repo.Upsert(ctx, nil))
+	assert.Nil(t, repo.Upsert(ctx, []*repoOrder{{OrderNo: "no1", Amount: 1}, {OrderNo: "no2", Amount: 2}}))
+
+	order, err := repo.FindById(ctx, 1)
+	assert.Nil(t, err)
+	createdAt := order.CreatedAt
+
+	// 只更新指定的列
+	assert.Nil(t, repo.Upsert(ctx, []*repoOrder{{Id: 1, OrderNo: "no1", Amount: 10,
+		CreatedAt: time.Now().Add(time.Hour)}}, "amount"))
+	order, err = repo.FindById(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), order.Amount)
+	assert.True(t, createdAt.Equal(order.CreatedAt))
+
+	// 未指定时更新全部字段
+	assert.Nil(t, repo.Upsert(ctx, []*repoOrder{{Id: 2, OrderNo: "no2", Amount: 20, IsDel: 1}}))
+	_, err = repo.FindById(ctx, 2)
+	assert.Equal(t, gorm.ErrRecordNotFound, err)
+
+	count, err := repo.Count(ctx, "1 = 1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestRepository_Page(t *testing.T) {
+	repo := newSqliteRepo(t)
+	ctx := context.Background()
+
+	result, err := repo.Page(ctx, PageQuery{}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), result.Total)
+	assert.Equal(t, 1, result.Page)
+	assert.Equal(t, defaultPageSize, result.PageSize)
+	assert.Len(t, result.List, 0)
+
+	orders := make([]*repoOrder, 0)
+	for i := 1; i <= 7; i++ {
+		orders = append(orders, &repoOrder{OrderNo: "no" + strconv.Itoa(i), Amount: int64(i)})
+	}
+	assert.Nil(t, repo.BatchCreate(ctx, orders, 0))
+	_, err = repo.DelById(ctx, 7)
+	assert.Nil(t, err)
+
+	result, err = repo.Page(ctx, PageQuery{Page: 2, PageSize: 4}, nil)
+	assert.Nil(t, err)
+	// 已软删除的记录不计入
+	assert.Equal(t, int64(6), result.Total)
+	assert.Len(t, result.List, 2)
+	assert.Equal(t, int64(5), result.List[0].Id)
+	assert.Equal(t, int64(6), result.List[1].Id)
+
+	result, err = repo.Page(ctx, PageQuery{Page: 1, PageSize: 2, Order: "amount desc"}, "amount < ?", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), result.Total)
+	assert.Len(t, result.List, 2)
+	assert.Equal(t, int64(4), result.List[0].Amount)
+	assert.Equal(t, int64(3), result.List[1].Amount)
+
+	result, err = repo.Page(ctx, PageQuery{Page: 3, PageSize: maxPageSize + 1}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, maxPageSize, result.PageSize)
+	assert.Len(t, result.List, 0)
+}
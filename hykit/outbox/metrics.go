@@ -0,0 +1,36 @@
+package outbox
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var outboxPublishTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "outbox_publish_total",
+		Help: "Number of outbox publish in total",
+	},
+	[]string{"topic", "result"},
+)
+
+var outboxPending = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "outbox_pending",
+		Help: "Number of pending outbox messages",
+	},
+	[]string{"topic"},
+)
+
+// outbox_lag_seconds 最早一条待发送消息距今的时间.
+var outboxLag = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "outbox_lag_seconds",
+		Help: "Age of the oldest pending outbox message",
+	},
+	[]string{"topic"},
+)
+
+func init() {
+	prometheus.MustRegister(outboxPublishTotal)
+	prometheus.MustRegister(outboxPending)
+	prometheus.MustRegister(outboxLag)
+}
@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StatusPending = 0
+	StatusSent    = 1
+	StatusFailed  = 2
+)
+
+// Message 发件箱中的一条待发送消息, 与业务数据在同一个事务中写入.
+type Message struct {
+	Id             int64     `gorm:"column:id;primaryKey;autoIncrement"`
+	IdempotencyKey string    `gorm:"column:idempotency_key;type:varchar(128);not null;uniqueIndex"`
+	Topic          string    `gorm:"column:topic;type:varchar(128);not null;index:idx_outbox_topic_status"`
+	Tag            string    `gorm:"column:tag;type:varchar(64);not null;default:''"`
+	Body           string    `gorm:"column:body;type:mediumtext"`
+	Status         int       `gorm:"column:status;not null;default:0;index:idx_outbox_topic_status;index:idx_outbox_status_retry"`
+	Attempts       int       `gorm:"column:attempts;not null;default:0"`
+	LastError      string    `gorm:"column:last_error;type:varchar(512);not null;default:''"`
+	NextRetryAt    time.Time `gorm:"column:next_retry_at;index:idx_outbox_status_retry"`
+	CreatedAt      time.Time `gorm:"column:created_at"`
+	UpdatedAt      time.Time `gorm:"column:updated_at"`
+}
+
+func (Message) TableName() string {
+	return "outbox_message"
+}
+
+var ErrEmptyIdempotencyKey = errors.New("outbox: idempotency key is empty")
+
+// Save 在业务事务 tx 中写入一条发件箱消息.
+// 相同 IdempotencyKey 的消息只会保存一次, 重复写入直接忽略.
+func Save(ctx context.Context, tx *gorm.DB, msg *Message) error {
+	if msg.IdempotencyKey == "" {
+		return ErrEmptyIdempotencyKey
+	}
+
+	if msg.Topic == "" {
+		return errors.New("outbox: topic is empty")
+	}
+
+	now := time.Now()
+	msg.Status = StatusPending
+	if msg.NextRetryAt.IsZero() {
+		msg.NextRetryAt = now
+	}
+
+	return tx.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(msg).Error
+}
+
+// AutoMigrate 创建或更新发件箱表.
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Message{})
+}
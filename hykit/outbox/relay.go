@@ -0,0 +1,419 @@
+package outbox
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxLastErrorLen = 512
+
+// Relay 轮询发件箱表, 把待发送消息投递到消息队列.
+// 投递失败按指数退避重试, 超过最大次数标记为失败; 已发送的消息超过保留时间后清理.
+type Relay struct {
+	db *gorm.DB
+
+	sender Sender
+
+	conf config.Config
+
+	logger log.Logger
+
+	batchSize int
+
+	pollInterval time.Duration
+
+	statsInterval time.Duration
+
+	maxAttempts int
+
+	retryBase time.Duration
+
+	retryMax time.Duration
+
+	retention time.Duration
+
+	// 取出的消息在租约期内不会被再次取出, 投递中进程退出时租约到期后重新投递
+	claimTimeout time.Duration
+
+	// 多实例部署时使用 SELECT ... FOR UPDATE SKIP LOCKED 避免争抢同一批消息
+	lockRows bool
+
+	topicsMu sync.Mutex
+
+	topics map[string]struct{}
+
+	closeChan chan bool
+
+	wg sync.WaitGroup
+}
+
+type RelayOption func(*Relay)
+
+type RelayOptions struct{}
+
+func NewRelay(options ...RelayOption) *Relay {
+	r := &Relay{
+		topics:    make(map[string]struct{}),
+		closeChan: make(chan bool),
+	}
+
+	for _, option := range options {
+		option(r)
+	}
+
+	if r.conf == nil {
+		r.conf = config.NewNullConfig()
+	}
+
+	if r.logger == nil {
+		r.logger = log.NewLogger()
+	}
+
+	if r.db == nil {
+		r.logger.Panicf("[outbox] db is nil")
+	}
+
+	if r.sender == nil {
+		r.logger.Panicf("[outbox] sender is nil")
+	}
+
+	r.batchSize = r.conf.GetInt("outbox_batch_size")
+	if r.batchSize == 0 {
+		r.batchSize = 100
+	}
+
+	r.pollInterval = time.Duration(r.conf.GetInt64("outbox_poll_interval")) * time.Millisecond
+	if r.pollInterval == 0 {
+		r.pollInterval = time.Second
+	}
+
+	r.statsInterval = time.Duration(r.conf.GetInt64("outbox_stats_interval")) * time.Second
+	if r.statsInterval == 0 {
+		r.statsInterval = 10 * time.Second
+	}
+
+	r.maxAttempts = r.conf.GetInt("outbox_max_attempts")
+	if r.maxAttempts == 0 {
+		r.maxAttempts = 10
+	}
+
+	r.retryBase = time.Duration(r.conf.GetInt64("outbox_retry_base")) * time.Millisecond
+	if r.retryBase == 0 {
+		r.retryBase = time.Second
+	}
+
+	r.retryMax = time.Duration(r.conf.GetInt64("outbox_retry_max")) * time.Millisecond
+	if r.retryMax == 0 {
+		r.retryMax = 5 * time.Minute
+	}
+
+	r.retention = time.Duration(r.conf.GetInt64("outbox_retention")) * time.Hour
+	if r.retention == 0 {
+		r.retention = 72 * time.Hour
+	}
+
+	r.claimTimeout = time.Duration(r.conf.GetInt64("outbox_claim_timeout")) * time.Millisecond
+	if r.claimTimeout == 0 {
+		r.claimTimeout = time.Minute
+	}
+
+	r.lockRows = r.conf.GetBool("outbox_lock_rows")
+
+	return r
+}
+
+func (RelayOptions) WithConf(conf config.Config) RelayOption {
+	return func(r *Relay) {
+		r.conf = conf
+	}
+}
+
+func (RelayOptions) WithLogger(logger log.Logger) RelayOption {
+	return func(r *Relay) {
+		r.logger = logger
+	}
+}
+
+// WithDb 发件箱表所在的库, 必须与业务写入使用同一个库.
+func (RelayOptions) WithDb(db *gorm.DB) RelayOption {
+	return func(r *Relay) {
+		r.db = db
+	}
+}
+
+func (RelayOptions) WithSender(sender Sender) RelayOption {
+	return func(r *Relay) {
+		r.sender = sender
+	}
+}
+
+// Start 启动后台投递协程.
+func (r *Relay) Start() {
+	r.wg.Add(1)
+	go r.run()
+	r.logger.Infof("[outbox] relay start")
+}
+
+// Close 停止投递并等待当前批次完成.
+func (r *Relay) Close() {
+	close(r.closeChan)
+	r.wg.Wait()
+	r.logger.Infof("[outbox] relay stop")
+}
+
+func (r *Relay) run() {
+	defer r.wg.Done()
+
+	ctx := context.Background()
+
+	pollTicker := time.NewTicker(r.pollInterval)
+	defer pollTicker.Stop()
+
+	statsTicker := time.NewTicker(r.statsInterval)
+	defer statsTicker.Stop()
+
+	cleanupTicker := time.NewTicker(time.Hour)
+	defer cleanupTicker.Stop()
+
+	for {
+		select {
+		case <-pollTicker.C:
+			// 取满一批说明还有积压, 继续投递直到取不满
+			for {
+				n, err := r.RelayOnce(ctx)
+				if err != nil || n < r.batchSize {
+					break
+				}
+
+				select {
+				case <-r.closeChan:
+					return
+				default:
+				}
+			}
+		case <-statsTicker.C:
+			r.Stats(ctx)
+		case <-cleanupTicker.C:
+			_, _ = r.Cleanup(ctx)
+		case <-r.closeChan:
+			return
+		}
+	}
+}
+
+// RelayOnce 投递一批到期的待发送消息, 返回本批取到的条数.
+// 先在短事务中取出并续租这批消息, 提交后再逐条投递, 投递期间不占用数据库事务.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	msgs, err := r.claim(ctx)
+	if err != nil {
+		r.logger.Errorc(ctx, "[outbox] relay error : %s", err.Error())
+		return 0, err
+	}
+
+	// 单条失败不影响本批其他消息, 否则剩余的消息要等租约到期才会重新投递
+	var firstErr error
+	for _, msg := range msgs {
+		if err = r.deliver(ctx, msg); err != nil {
+			r.logger.Errorc(ctx, "[outbox] relay %s [%s] error : %s",
+				msg.Topic, msg.IdempotencyKey, err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return len(msgs), firstErr
+}
+
+// claim 取出一批到期的消息, 把 next_retry_at 推迟到租约结束.
+// 未开启 outbox_lock_rows 时多个实例可能取到相同的消息, 只保留续租成功的消息.
+func (r *Relay) claim(ctx context.Context) ([]*Message, error) {
+	msgs := make([]*Message, 0)
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		query := tx.Where("status = ? AND next_retry_at <= ?", StatusPending, now).
+			Order("id").Limit(r.batchSize)
+		if r.lockRows {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+
+		if err := query.Find(&msgs).Error; err != nil {
+			return err
+		}
+
+		var err error
+		msgs, err = r.lease(tx, msgs, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
+// lease 逐条续租, 已被其他实例续租(next_retry_at 已推迟)或已投递的消息不再返回.
+func (r *Relay) lease(tx *gorm.DB, msgs []*Message, now time.Time) ([]*Message, error) {
+	leased := make([]*Message, 0, len(msgs))
+	for _, msg := range msgs {
+		result := tx.Model(&Message{}).
+			Where("id = ? AND status = ? AND next_retry_at <= ?", msg.Id, StatusPending, now).
+			Update("next_retry_at", now.Add(r.claimTimeout))
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		if result.RowsAffected == 1 {
+			leased = append(leased, msg)
+		}
+	}
+
+	return leased, nil
+}
+
+func (r *Relay) deliver(ctx context.Context, msg *Message) error {
+	db := r.db.WithContext(ctx)
+
+	err := r.sender.Send(ctx, msg)
+	if err == nil {
+		outboxPublishTotal.With(prometheus.Labels{"topic": msg.Topic, "result": "success"}).Inc()
+		return db.Model(msg).Updates(map[string]interface{}{
+			"status":   StatusSent,
+			"attempts": msg.Attempts + 1,
+		}).Error
+	}
+
+	attempts := msg.Attempts + 1
+	lastError := err.Error()
+	if len(lastError) > maxLastErrorLen {
+		lastError = lastError[:maxLastErrorLen]
+	}
+
+	updates := map[string]interface{}{
+		"attempts":   attempts,
+		"last_error": lastError,
+	}
+
+	if attempts >= r.maxAttempts {
+		updates["status"] = StatusFailed
+		outboxPublishTotal.With(prometheus.Labels{"topic": msg.Topic, "result": "failed"}).Inc()
+		r.logger.Errorc(ctx, "[outbox] %s [%s] give up after %d attempts : %s",
+			msg.Topic, msg.IdempotencyKey, attempts, lastError)
+	} else {
+		updates["next_retry_at"] = time.Now().Add(r.backoff(attempts))
+		outboxPublishTotal.With(prometheus.Labels{"topic": msg.Topic, "result": "retry"}).Inc()
+		r.logger.Warnc(ctx, "[outbox] %s [%s] attempt %d failed : %s",
+			msg.Topic, msg.IdempotencyKey, attempts, lastError)
+	}
+
+	return db.Model(msg).Updates(updates).Error
+}
+
+// backoff 第 attempts 次失败后的等待时间, 在 [d/2, d] 内随机抖动.
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.retryBase
+	for i := 1; i < attempts && d < r.retryMax; i++ {
+		d *= 2
+	}
+
+	if d > r.retryMax {
+		d = r.retryMax
+	}
+
+	half := int64(d / 2)
+	if half == 0 {
+		return d
+	}
+
+	//nolint:gosec
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// Cleanup 删除超过保留时间的已发送消息.
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("status = ? AND updated_at < ?", StatusSent, time.Now().Add(-r.retention)).
+		Delete(&Message{})
+	if result.Error != nil {
+		r.logger.Errorc(ctx, "[outbox] cleanup error : %s", result.Error.Error())
+		return 0, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		r.logger.Infoc(ctx, "[outbox] cleanup %d messages", result.RowsAffected)
+	}
+
+	return result.RowsAffected, nil
+}
+
+type topicLag struct {
+	Topic    string
+	Pending  int64
+	OldestId int64
+}
+
+// Stats 按 topic 导出待发送数量和积压时间.
+func (r *Relay) Stats(ctx context.Context) {
+	db := r.db.WithContext(ctx)
+
+	lags := make([]topicLag, 0)
+	err := db.Model(&Message{}).
+		Select("topic, count(*) AS pending, min(id) AS oldest_id").
+		Where("status = ?", StatusPending).
+		Group("topic").
+		Scan(&lags).Error
+	if err != nil {
+		r.logger.Errorc(ctx, "[outbox] stats error : %s", err.Error())
+		return
+	}
+
+	// 按主键取最早一条的创建时间, 不依赖各数据库对 min(datetime) 的返回类型
+	oldest := make(map[int64]time.Time, len(lags))
+	if len(lags) > 0 {
+		ids := make([]int64, 0, len(lags))
+		for _, lag := range lags {
+			ids = append(ids, lag.OldestId)
+		}
+
+		msgs := make([]*Message, 0, len(lags))
+		err = db.Select("id, created_at").Where("id IN ?", ids).Find(&msgs).Error
+		if err != nil {
+			r.logger.Errorc(ctx, "[outbox] stats error : %s", err.Error())
+			return
+		}
+
+		for _, msg := range msgs {
+			oldest[msg.Id] = msg.CreatedAt
+		}
+	}
+
+	r.topicsMu.Lock()
+	defer r.topicsMu.Unlock()
+
+	now := time.Now()
+	seen := make(map[string]struct{}, len(lags))
+	for _, lag := range lags {
+		seen[lag.Topic] = struct{}{}
+		r.topics[lag.Topic] = struct{}{}
+		outboxPending.With(prometheus.Labels{"topic": lag.Topic}).Set(float64(lag.Pending))
+		if createdAt, ok := oldest[lag.OldestId]; ok {
+			outboxLag.With(prometheus.Labels{"topic": lag.Topic}).Set(now.Sub(createdAt).Seconds())
+		}
+	}
+
+	for topic := range r.topics {
+		if _, ok := seen[topic]; !ok {
+			outboxPending.With(prometheus.Labels{"topic": topic}).Set(0)
+			outboxLag.With(prometheus.Labels{"topic": topic}).Set(0)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"code.jshyjdtech.com/godev/hykit/config"
+	"github.com/glebarez/sqlite"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type stubSender struct {
+	mu sync.Mutex
+
+	sent []string
+
+	err error
+
+	onSend func(msg *Message)
+}
+
+func (ss *stubSender) Send(ctx context.Context, msg *Message) error {
+	if ss.onSend != nil {
+		ss.onSend(msg)
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.err != nil {
+		return ss.err
+	}
+	ss.sent = append(ss.sent, msg.IdempotencyKey)
+	return nil
+}
+
+func newTestDb(t *testing.T) *gorm.DB {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	assert.Nil(t, err)
+
+	sqlDb, err := db.DB()
+	assert.Nil(t, err)
+	// 内存库在最后一个连接关闭后销毁
+	sqlDb.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		sqlDb.Close()
+	})
+
+	assert.Nil(t, AutoMigrate(db))
+	return db
+}
+
+func newTestRelay(db *gorm.DB, sender Sender, conf config.Config) *Relay {
+	relayOptions := RelayOptions{}
+	return NewRelay(
+		relayOptions.WithDb(db),
+		relayOptions.WithSender(sender),
+		relayOptions.WithConf(conf),
+	)
+}
+
+func saveMessages(t *testing.T, db *gorm.DB, topic string, keys ...string) {
+	for _, key := range keys {
+		assert.Nil(t, Save(context.Background(), db, &Message{
+			IdempotencyKey: key,
+			Topic:          topic,
+			Body:           "body_" + key,
+		}))
+	}
+}
+
+func findMessage(t *testing.T, db *gorm.DB, key string) *Message {
+	msg := &Message{}
+	assert.Nil(t, db.Where("idempotency_key = ?", key).First(msg).Error)
+	return msg
+}
+
+func TestRelay_Backoff(t *testing.T) {
+	r := &Relay{retryBase: 100 * time.Millisecond, retryMax: time.Second}
+
+	d := r.backoff(1)
+	assert.True(t, d >= 50*time.Millisecond && d <= 100*time.Millisecond)
+
+	d = r.backoff(3)
+	assert.True(t, d >= 200*time.Millisecond && d <= 400*time.Millisecond)
+
+	d = r.backoff(20)
+	assert.True(t, d >= 500*time.Millisecond && d <= time.Second)
+}
+
+func TestSave_EmptyIdempotencyKey(t *testing.T) {
+	err := Save(context.Background(), nil, &Message{Topic: "test"})
+	assert.Equal(t, ErrEmptyIdempotencyKey, err)
+}
+
+func TestSave_InTransaction(t *testing.T) {
+	db := newTestDb(t)
+	ctx := context.Background()
+
+	errRollback := errors.New("rollback")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		assert.Nil(t, Save(ctx, tx, &Message{IdempotencyKey: "k1", Topic: "order"}))
+		return errRollback
+	})
+	assert.Equal(t, errRollback, err)
+
+	var count int64
+	assert.Nil(t, db.Model(&Message{}).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return Save(ctx, tx, &Message{IdempotencyKey: "k1", Topic: "order"})
+	})
+	assert.Nil(t, err)
+
+	// 相同 IdempotencyKey 重复写入被忽略
+	assert.Nil(t, Save(ctx, db, &Message{IdempotencyKey: "k1", Topic: "order", Body: "again"}))
+	assert.Nil(t, db.Model(&Message{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	msg := findMessage(t, db, "k1")
+	assert.Equal(t, StatusPending, msg.Status)
+	assert.Equal(t, "", msg.Body)
+}
+
+func TestRelay_RelayOnce(t *testing.T) {
+	db := newTestDb(t)
+	sender := &stubSender{}
+	r := newTestRelay(db, sender, config.NewMemConfig())
+
+	saveMessages(t, db, "order", "k1", "k2", "k3")
+
+	n, err := r.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"k1", "k2", "k3"}, sender.sent)
+
+	for _, key := range []string{"k1", "k2", "k3"} {
+		msg := findMessage(t, db, key)
+		assert.Equal(t, StatusSent, msg.Status)
+		assert.Equal(t, 1, msg.Attempts)
+	}
+
+	n, err = r.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Len(t, sender.sent, 3)
+}
+
+func TestRelay_RelayOnceBatchSize(t *testing.T) {
+	db := newTestDb(t)
+	sender := &stubSender{}
+	conf := config.NewMemConfig()
+	conf.Set("outbox_batch_size", 2)
+	r := newTestRelay(db, sender, conf)
+
+	saveMessages(t, db, "order", "k1", "k2", "k3")
+
+	n, err := r.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = r.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"k1", "k2", "k3"}, sender.sent)
+}
+
+func TestRelay_RetryAndGiveUp(t *testing.T) {
+	db := newTestDb(t)
+	sender := &stubSender{err: errors.New("broker unavailable")}
+	conf := config.NewMemConfig()
+	conf.Set("outbox_max_attempts", 2)
+	conf.Set("outbox_retry_base", 1000)
+	r := newTestRelay(db, sender, conf)
+
+	saveMessages(t, db, "order", "k1")
+
+	start := time.Now()
+	n, err := r.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	msg := findMessage(t, db, "k1")
+	assert.Equal(t, StatusPending, msg.Status)
+	assert.Equal(t, 1, msg.Attempts)
+	assert.Equal(t, "broker unavailable", msg.LastError)
+	// 退避时间写回数据库, 未到期前不会再次投递
+	assert.True(t, msg.NextRetryAt.After(start.Add(400*time.Millisecond)))
+	assert.True(t, msg.NextRetryAt.Before(start.Add(2*time.Second)))
+
+	n, err = r.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.Nil(t, db.Model(msg).Update("next_retry_at", time.Now().Add(-time.Second)).Error)
+	n, err = r.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	msg = findMessage(t, db, "k1")
+	assert.Equal(t, StatusFailed, msg.Status)
+	assert.Equal(t, 2, msg.Attempts)
+
+	n, err = r.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRelay_ClaimBeforeSend(t *testing.T) {
+	db := newTestDb(t)
+	sender := &stubSender{}
+	r := newTestRelay(db, sender, config.NewMemConfig())
+
+	saveMessages(t, db, "order", "k1")
+
+	var claimed []*Message
+	var claimErr error
+	sender.onSend = func(msg *Message) {
+		// 只有一个连接, 取出消息的事务未提交时这里会阻塞
+		claimed, claimErr = r.claim(context.Background())
+	}
+
+	n, err := r.RelayOnce(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Nil(t, claimErr)
+	assert.Len(t, claimed, 0)
+	assert.Equal(t, StatusSent, findMessage(t, db, "k1").Status)
+}
+
+func TestRelay_ClaimTimeout(t *testing.T) {
+	db := newTestDb(t)
+	r := newTestRelay(db, &stubSender{}, config.NewMemConfig())
+
+	saveMessages(t, db, "order", "k1")
+
+	msgs, err := r.claim(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+
+	// 投递中进程退出, 租约到期前不会被再次取出
+	msgs, err = r.claim(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 0)
+
+	assert.Nil(t, db.Model(&Message{}).Where("idempotency_key = ?", "k1").
+		Update("next_retry_at", time.Now().Add(-time.Second)).Error)
+	msgs, err = r.claim(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, 0, msgs[0].Attempts)
+}
+
+func TestRelay_Cleanup(t *testing.T) {
+	db := newTestDb(t)
+	r := newTestRelay(db, &stubSender{}, config.NewMemConfig())
+
+	old := time.Now().Add(-100 * time.Hour)
+	assert.Nil(t, db.Create(&Message{IdempotencyKey: "k1", Topic: "order", Status: StatusSent,
+		NextRetryAt: old, CreatedAt: old, UpdatedAt: old}).Error)
+	assert.Nil(t, db.Create(&Message{IdempotencyKey: "k2", Topic: "order", Status: StatusFailed,
+		NextRetryAt: old, CreatedAt: old, UpdatedAt: old}).Error)
+	saveMessages(t, db, "order", "k3")
+	assert.Nil(t, db.Model(&Message{}).Where("idempotency_key = ?", "k3").
+		Update("status", StatusSent).Error)
+
+	n, err := r.Cleanup(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	var keys []string
+	assert.Nil(t, db.Model(&Message{}).Order("id").Pluck("idempotency_key", &keys).Error)
+	assert.Equal(t, []string{"k2", "k3"}, keys)
+}
+
+func TestRelay_Stats(t *testing.T) {
+	db := newTestDb(t)
+	r := newTestRelay(db, &stubSender{}, config.NewMemConfig())
+
+	saveMessages(t, db, "stats_order", "k1", "k2")
+	saveMessages(t, db, "stats_pay", "k3")
+	assert.Nil(t, db.Model(&Message{}).Where("idempotency_key = ?", "k1").
+		Update("created_at", time.Now().Add(-time.Hour)).Error)
+
+	r.Stats(context.Background())
+	assert.True(t, testutil.ToFloat64(outboxLag.WithLabelValues("stats_order")) >= 3600)
+	assert.Equal(t, float64(2), testutil.ToFloat64(outboxPending.WithLabelValues("stats_order")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(outboxPending.WithLabelValues("stats_pay")))
+
+	assert.Nil(t, db.Model(&Message{}).Where("topic = ?", "stats_pay").
+		Update("status", StatusSent).Error)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Stats(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(outboxPending.WithLabelValues("stats_order")))
+	// 已无积压的 topic 归零
+	assert.Equal(t, float64(0), testutil.ToFloat64(outboxPending.WithLabelValues("stats_pay")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(outboxLag.WithLabelValues("stats_pay")))
+}
+
+func TestRelay_LeaseClaimedByOther(t *testing.T) {
+	db := newTestDb(t)
+	r := newTestRelay(db, &stubSender{}, config.NewMemConfig())
+
+	saveMessages(t, db, "order", "k1", "k2")
+
+	now := time.Now()
+	msgs := make([]*Message, 0)
+	assert.Nil(t, db.Where("status = ? AND next_retry_at <= ?", StatusPending, now).
+		Order("id").Find(&msgs).Error)
+	assert.Len(t, msgs, 2)
+
+	// 其他实例在本实例查询后先续租了 k1
+	assert.Nil(t, db.Model(&Message{}).Where("idempotency_key = ?", "k1").
+		Update("next_retry_at", now.Add(time.Minute)).Error)
+
+	leased, err := r.lease(db, msgs, now)
+	assert.Nil(t, err)
+	assert.Len(t, leased, 1)
+	assert.Equal(t, "k2", leased[0].IdempotencyKey)
+}
+
+func TestRelay_RelayOnceContinueOnError(t *testing.T) {
+	db := newTestDb(t)
+	sender := &stubSender{}
+	r := newTestRelay(db, sender, config.NewMemConfig())
+
+	saveMessages(t, db, "order", "k1", "k2")
+
+	assert.Nil(t, db.Callback().Update().Before("gorm:update").Register("test:fail_k1",
+		func(tx *gorm.DB) {
+			if msg, ok := tx.Statement.Model.(*Message); ok && msg.IdempotencyKey == "k1" {
+				_ = tx.AddError(errors.New("update failed"))
+			}
+		}))
+
+	n, err := r.RelayOnce(context.Background())
+	assert.EqualError(t, err, "update failed")
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"k1", "k2"}, sender.sent)
+	assert.Equal(t, StatusSent, findMessage(t, db, "k2").Status)
+}
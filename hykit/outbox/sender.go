@@ -0,0 +1,39 @@
+package outbox
+
+import (
+	"context"
+
+	"code.jshyjdtech.com/godev/hykit/kafka"
+	"code.jshyjdtech.com/godev/hykit/rocketmq"
+)
+
+// Sender 把发件箱消息投递到消息队列.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+type kafkaSender struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaSender IdempotencyKey 作为 kafka 消息的 key, 消费端据此去重.
+func NewKafkaSender(writer *kafka.Writer) Sender {
+	return &kafkaSender{writer: writer}
+}
+
+func (ks *kafkaSender) Send(ctx context.Context, msg *Message) error {
+	return ks.writer.PublishKeyMessage(ctx, msg.Topic, []byte(msg.IdempotencyKey), []byte(msg.Body))
+}
+
+type rocketmqSender struct {
+	publisher *rocketmq.Publisher
+}
+
+// NewRocketMQSender IdempotencyKey 作为 rocketmq 消息的 MessageKey, 消费端据此去重.
+func NewRocketMQSender(publisher *rocketmq.Publisher) Sender {
+	return &rocketmqSender{publisher: publisher}
+}
+
+func (rs *rocketmqSender) Send(ctx context.Context, msg *Message) error {
+	return rs.publisher.PublishMsgWithKeyTag(msg.Topic, msg.Body, msg.Tag, msg.IdempotencyKey)
+}
@@ -0,0 +1,138 @@
+package security
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Signer 签名和验签, ECDSACert 可以直接使用, RSA 证书使用 NewRSASigner.
+type Signer interface {
+	Sign(signBlock []byte) ([]byte, error)
+
+	Verify(signBlock, signature []byte) error
+}
+
+type rsaSigner struct {
+	cert *Cert
+
+	algo int
+}
+
+// NewRSASigner algo e.g. SHA256WithRSA.
+func NewRSASigner(cert *Cert, algo int) Signer {
+	return &rsaSigner{cert: cert, algo: algo}
+}
+
+func (rs *rsaSigner) Sign(signBlock []byte) ([]byte, error) {
+	return rs.cert.Sign(rs.algo, signBlock)
+}
+
+func (rs *rsaSigner) Verify(signBlock, signature []byte) error {
+	return rs.cert.Verify(rs.algo, signBlock, signature)
+}
+
+/*SignBuffer 字段按名称排序拼接为 k1=v1&k2=v2, 忽略空值和签名字段.*/
+func SignBuffer(fields map[string]string, signField string) string {
+	names := make([]string, 0, len(fields))
+	for name, value := range fields {
+		if name == signField || name == "" || value == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var signBuf bytes.Buffer
+	for _, name := range names {
+		signBuf.WriteString(name)
+		signBuf.WriteString("=")
+		signBuf.WriteString(fields[name])
+		signBuf.WriteString("&")
+	}
+	if signBuf.Len() > 0 {
+		signBuf.Truncate(signBuf.Len() - 1)
+	}
+
+	return signBuf.String()
+}
+
+/*SignFields 解析 json 或表单请求体的第一层字段, json 的对象和数组保留原始的紧凑格式.*/
+func SignFields(contentType string, body []byte) (map[string]string, error) {
+	fields := make(map[string]string)
+	if len(bytes.TrimSpace(body)) == 0 {
+		return fields, nil
+	}
+
+	if strings.Contains(contentType, "json") {
+		raw := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, errors.Errorf("解析签名字段失败[%s]", err)
+		}
+
+		for name, value := range raw {
+			if string(value) == "null" {
+				continue
+			}
+
+			var str string
+			if err := json.Unmarshal(value, &str); err == nil {
+				fields[name] = str
+				continue
+			}
+
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, value); err != nil {
+				return nil, errors.Errorf("解析签名字段失败[%s]", err)
+			}
+			fields[name] = compact.String()
+		}
+
+		return fields, nil
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errors.Errorf("解析签名字段失败[%s]", err)
+	}
+	for name := range values {
+		fields[name] = values.Get(name)
+	}
+
+	return fields, nil
+}
+
+/*SignBase64 签名后 base64 编码.*/
+func SignBase64(signer Signer, signBuf string) (string, error) {
+	signature, err := signer.Sign([]byte(signBuf))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+/*VerifyBase64 验证 base64 编码的签名, 失败返回 ErrInvalidSignature.*/
+func VerifyBase64(signer Signer, signBuf, signature string) error {
+	if signature == "" {
+		return errors.WithMessage(ErrInvalidSignature, "签名为空")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.WithMessage(ErrInvalidSignature, err.Error())
+	}
+
+	if err = signer.Verify([]byte(signBuf), raw); err != nil {
+		return errors.WithMessage(ErrInvalidSignature, err.Error())
+	}
+
+	return nil
+}
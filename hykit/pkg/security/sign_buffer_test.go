@@ -0,0 +1,26 @@
+package security
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignBuffer(t *testing.T) {
+	fields := map[string]string{"b": "2", "a": "1", "empty": "", "signature": "xxx"}
+	assert.Equal(t, "a=1&b=2", SignBuffer(fields, "signature"))
+	assert.Equal(t, "", SignBuffer(map[string]string{}, "signature"))
+}
+
+func TestSignFields(t *testing.T) {
+	fields, err := SignFields("application/json", []byte(`{"a":"x","b":10,"c":{"d": 1},"e":null}`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "x", "b": "10", "c": `{"d":1}`}, fields)
+
+	fields, err = SignFields("application/x-www-form-urlencoded", []byte("a=x&b=10"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "x", "b": "10"}, fields)
+
+	_, err = SignFields("application/json", []byte("{"))
+	assert.NotNil(t, err)
+}
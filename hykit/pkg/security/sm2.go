@@ -181,3 +181,13 @@ func sm2Decrypt(privateKey *sm2.PrivateKey, cipherByte []byte) ([]byte, error) {
 
 	return dataByte, nil
 }
+
+/*RawCertificate 获取证书 DER 编码.*/
+func (cert *ECDSACert) RawCertificate() []byte {
+	return cert.certificate.Raw
+}
+
+/*PrivateKey 获取私钥, cer 证书为 nil.*/
+func (cert *ECDSACert) PrivateKey() *sm2.PrivateKey {
+	return cert.privateKey
+}
@@ -233,6 +233,7 @@ func (c *Client) Close() error {
 
 func (c *Client) Ping() error {
 	conn := c.client.Get()
+	defer conn.Close()
 
 	return conn.Err()
 }
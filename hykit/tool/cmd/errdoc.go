@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"code.jshyjdtech.com/godev/hykit/tool/errdoc"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var errdocCmd = &cobra.Command{
+	Use:   "errdoc",
+	Short: "生成错误码文档",
+	Long: `需要在项目根目录下执行, 导入 --pkg 指定的包后输出 errcode 注册的错误码和渠道应答码映射,
+e.g. esim errdoc --pkg ./internal/infra/errcodes -o docs/errcode.md
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// out 与 ifacer 同名, 不绑定到全局的 viper, 直接读取当前命令的 flag
+		pkg, _ := cmd.Flags().GetString("pkg")
+		out, _ := cmd.Flags().GetString("out")
+
+		ev := viper.New()
+		ev.Set("pkg", pkg)
+		ev.Set("out", out)
+
+		errDocer := errdoc.NewErrDocer(
+			errdoc.WithErrDocLogger(logger),
+		)
+		err := errDocer.Run(ev)
+		if err != nil {
+			logger.Errorf(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(errdocCmd)
+
+	errdocCmd.Flags().StringP("pkg", "", "", "注册错误码的包")
+
+	errdocCmd.Flags().StringP("out", "o", "errcode.md", "输出文件")
+}
@@ -11,6 +11,8 @@ var protocCmd = &cobra.Command{
 	Long: `1：在执行前需要注意，先把proto 文件 复制到项目下，
 2：需要在项目根目录下执行
 生成的protobuf文件会被放到项目的 internal/infra/third_party/package/*.pb.go,
+3：--gateway 生成 *_gateway.go, 把 gRPC 服务注册到 gin 提供 HTTP/JSON 接口,
+使用 google.api.http 注解时需要把 google/api/annotations.proto 放到 proto 文件目录下
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		protocer := protoc.NewProtocer(
@@ -31,6 +33,8 @@ func init() {
 
 	protocCmd.Flags().StringP("package", "p", "", "package名称")
 
+	protocCmd.Flags().BoolP("gateway", "g", false, "生成 gateway 注册代码")
+
 	err := v.BindPFlags(protocCmd.Flags())
 	if err != nil {
 		logger.Errorf(err.Error())
@@ -10,7 +10,6 @@ import (
 	"code.jshyjdtech.com/godev/hykit/pkg"
 	filedir "code.jshyjdtech.com/godev/hykit/pkg/file-dir"
 	"code.jshyjdtech.com/godev/hykit/pkg/templates"
-	"github.com/serenize/snaker"
 	"github.com/spf13/viper"
 )
 
@@ -112,43 +111,10 @@ func (ddf *daoDomainFile) ParseCloumns(cs Columns, shareInfo *ShareInfo) {
 	ddf.tableName = shareInfo.DbConf.Table
 
 	daoTpl.Imports = append(daoTpl.Imports,
-		pkg.Import{Path: "context"},
-		pkg.Import{Path: "gorm.io/gorm"},
-		pkg.Import{Path: "errors"},
 		pkg.Import{Path: "code.jshyjdtech.com/godev/hykit/mysql"},
 		pkg.Import{Path: filedir.GetGoProPath() +
 			pkg.DirPathToImportPath(shareInfo.WithEntityTarget)})
 
-	var hastTime bool
-	for i := range cs {
-		column := (&cs[i])
-
-		fieldName := snaker.SnakeToCamel(column.ColumnName)
-
-		nullable := false
-		if column.IsNullAble == yesNull {
-			nullable = true
-		}
-
-		if column.ColumnKey == pri {
-			daoTpl.PriKeyType = column.GetGoType(nullable)
-		}
-
-		if column.IsOnUpdate() {
-			hastTime = true
-			daoTpl.OnUpdateTimeStamp = append(daoTpl.OnUpdateTimeStamp, fieldName)
-			daoTpl.OnUpdateTimeStampStr = append(daoTpl.OnUpdateTimeStampStr,
-				column.ColumnName)
-		} else if column.IsCurrentTimeStamp() {
-			hastTime = true
-			daoTpl.CurTimeStamp = append(daoTpl.CurTimeStamp, fieldName)
-		}
-	}
-
-	if hastTime {
-		daoTpl.Imports = append(daoTpl.Imports, pkg.Import{Path: "time"})
-	}
-
 	ddf.data = daoTpl
 }
 
@@ -24,14 +24,6 @@ func TestDaoTemplate(t *testing.T) {
 	daoTmp.Imports = imports
 	daoTmp.DataBaseName = database
 	daoTmp.TableName = userTable
-	daoTmp.PriKeyType = "int"
-
-	daoTmp.CurTimeStamp = append(daoTmp.CurTimeStamp, "CreateTime1")
-	daoTmp.CurTimeStamp = append(daoTmp.CurTimeStamp, "CreateTime2")
-	daoTmp.OnUpdateTimeStamp = append(daoTmp.OnUpdateTimeStamp, "UpdateTime")
-	daoTmp.OnUpdateTimeStampStr = append(daoTmp.OnUpdateTimeStampStr,
-		"last_update_time1", "last_update_time2")
-
 	err = tmpl.Execute(&buf, daoTmp)
 	println(buf.String())
 
@@ -153,6 +153,7 @@ func (edf *entityDomainFile) ParseCloumns(cs Columns, info *ShareInfo) {
 
 		if column.IsCurrentTimeStamp() {
 			tpl.CurTimeStamp = append(tpl.CurTimeStamp, fieldName)
+			tpl.CurTimeStampStr = append(tpl.CurTimeStampStr, column.ColumnName)
 		}
 
 		if column.IsOnUpdate() {
@@ -15,6 +15,8 @@ type entityTpl struct {
 	// CURRENT_TIMESTAMP
 	CurTimeStamp []string
 
+	CurTimeStampStr []string
+
 	// on update CURRENT_TIMESTAMP
 	OnUpdateTimeStamp []string
 
@@ -38,6 +40,20 @@ func ({{.StructName | shorten}} {{.StructName}}) DelKey() string {
 }
 {{end}}
 
+{{if .CurTimeStampStr}}
+// CURRENT_TIMESTAMP fields
+func ({{.StructName | shorten}} {{.StructName}}) CurTimeStampKeys() []string {
+	return []string{ {{range $i, $key := .CurTimeStampStr}}{{if $i}}, {{end}}"{{$key}}"{{end}} }
+}
+{{end}}
+
+{{if .OnUpdateTimeStampStr}}
+// on update CURRENT_TIMESTAMP fields
+func ({{.StructName | shorten}} {{.StructName}}) OnUpdateKeys() []string {
+	return []string{ {{range $i, $key := .OnUpdateTimeStampStr}}{{if $i}}, {{end}}"{{$key}}"{{end}} }
+}
+{{end}}
+
 {{if .EntitySign}}
 func ({{.StructName | shorten}} {{.StructName}}) IsEmpty() bool {
 	return {{.StructName | shorten}}.{{.EntitySign}} == 0
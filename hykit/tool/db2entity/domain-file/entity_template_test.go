@@ -34,6 +34,7 @@ func TestEntityTemplate(t *testing.T) {
 	tpl := entityTpl{}
 	tpl.StructName = "Entity"
 	tpl.CurTimeStamp = append(tpl.CurTimeStamp, "CreateTime1", "CreateTime2")
+	tpl.CurTimeStampStr = append(tpl.CurTimeStampStr, "create_time1", "create_time2")
 
 	tpl.OnUpdateTimeStamp = append(tpl.OnUpdateTimeStamp, "LastUpdateTime")
 
@@ -53,4 +54,6 @@ func TestEntityTemplate(t *testing.T) {
 	err = tmpl.Execute(&buf, tpl)
 	println(buf.String())
 	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `return []string{ "create_time1", "create_time2" }`)
+	assert.Contains(t, buf.String(), `return []string{ "last_update_time1", "last_update_time2" }`)
 }
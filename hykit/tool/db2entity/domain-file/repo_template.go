@@ -48,7 +48,7 @@ func ({{.StructName | shorten}} *{{.StructName}}) FindById(ctx context.Context,
 	var {{.TableName | snakeToCamelLower}} entity.{{.EntityName}}
 	var err error
 
-	{{.TableName | snakeToCamelLower}}, err = {{.StructName | shorten}}.{{.EntityName| snakeToCamelLower | firstToLower}}Dao.Find(ctx, "*", "id = ? and {{.DelField}} = ?", id, 0)
+	{{.TableName | snakeToCamelLower}}, err = {{.StructName | shorten}}.{{.EntityName| snakeToCamelLower | firstToLower}}Dao.FindById(ctx, id)
 	if err != nil {
 		{{.StructName | shorten}}.logger.Errorc(ctx, err.Error())
 	}
@@ -0,0 +1,149 @@
+package errdoc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/spf13/viper"
+)
+
+const mainTpl = `package main
+
+import (
+	"os"
+
+	"code.jshyjdtech.com/godev/hykit/errcode"
+	_ "%s"
+)
+
+func main() {
+	if err := errcode.WriteMarkdown(os.Stdout); err != nil {
+		panic(err)
+	}
+}
+`
+
+// ErrDocer 在项目中生成一个临时的 main 包, 导入注册错误码的包后调用 errcode.WriteMarkdown,
+// 这样 Register 和 NewMapper 的结果与运行时完全一致.
+type ErrDocer struct {
+	logger log.Logger
+
+	// 注册错误码的包, 相对项目根目录或完整的 import path
+	pkg string
+
+	out string
+}
+
+type Option func(*ErrDocer)
+
+func NewErrDocer(options ...Option) *ErrDocer {
+	ed := &ErrDocer{}
+
+	for _, option := range options {
+		option(ed)
+	}
+
+	if ed.logger == nil {
+		ed.logger = log.NewLogger()
+	}
+
+	return ed
+}
+
+func WithErrDocLogger(logger log.Logger) Option {
+	return func(ed *ErrDocer) {
+		ed.logger = logger
+	}
+}
+
+func (ed *ErrDocer) Run(v *viper.Viper) error {
+	ed.pkg = v.GetString("pkg")
+	if ed.pkg == "" {
+		return errors.New("请指定错误码所在的包 --pkg")
+	}
+
+	ed.out = v.GetString("out")
+	if ed.out == "" {
+		ed.out = "errcode.md"
+	}
+
+	importPath, err := ed.importPath()
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := ioutil.TempDir(".", ".esim_errdoc_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	err = ioutil.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(mainContent(importPath)), 0644)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("go", "run", "./"+filepath.ToSlash(tmpDir))
+	cmd.Stderr = os.Stderr
+	doc, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("go run %s : %w", tmpDir, err)
+	}
+
+	err = ioutil.WriteFile(ed.out, doc, 0644)
+	if err != nil {
+		return err
+	}
+
+	ed.logger.Infof("wrote success : %s", ed.out)
+
+	return nil
+}
+
+// importPath ./internal/infra/errcodes -> module/internal/infra/errcodes.
+func (ed *ErrDocer) importPath() (string, error) {
+	if !strings.HasPrefix(ed.pkg, ".") {
+		return ed.pkg, nil
+	}
+
+	module, err := modulePath("go.mod")
+	if err != nil {
+		return "", err
+	}
+
+	rel := filepath.ToSlash(filepath.Clean(ed.pkg))
+	if rel == "." {
+		return module, nil
+	}
+
+	return module + "/" + rel, nil
+}
+
+func modulePath(goMod string) (string, error) {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return "", fmt.Errorf("请在项目根目录下执行 : %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module ")), `"`), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s 中没有 module", goMod)
+}
+
+func mainContent(importPath string) string {
+	return fmt.Sprintf(mainTpl, importPath)
+}
@@ -0,0 +1,32 @@
+package errdoc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModulePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errdoc")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	goMod := filepath.Join(dir, "go.mod")
+	assert.Nil(t, ioutil.WriteFile(goMod, []byte("module example.com/pay\n\ngo 1.18\n"), 0644))
+
+	module, err := modulePath(goMod)
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com/pay", module)
+
+	_, err = modulePath(filepath.Join(dir, "none.mod"))
+	assert.NotNil(t, err)
+}
+
+func TestMainContent(t *testing.T) {
+	content := mainContent("example.com/pay/internal/infra/errcodes")
+	assert.Contains(t, content, `_ "example.com/pay/internal/infra/errcodes"`)
+	assert.Contains(t, content, "errcode.WriteMarkdown(os.Stdout)")
+}
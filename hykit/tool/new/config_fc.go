@@ -17,6 +17,27 @@ grpc_server_kp_time : 60
 grpc_server_kp_time_out : 5
 #链接超时
 grpc_server_conn_time_out : 3
+#tls, 配置 ca 时要求客户端证书(mTLS), 证书文件更新后自动加载
+#grpc_server_tls_cert : 'conf/tls/server.pem'
+#grpc_server_tls_key : 'conf/tls/server.key'
+#grpc_server_tls_ca : 'conf/tls/ca.pem'
+#不使用 tls, 仅用于开发环境
+grpc_server_insecure : true
+#grpc.health.v1 依赖检查间隔 单位：ms
+grpc_server_health_interval : 5000
+#生产环境关闭 reflection
+grpc_server_disable_reflection : false
+#注册中心: 实例过期时间 单位：s, 下线后等待客户端更新的时间 单位：ms
+#grpc_server_register_ttl : 10
+#grpc_server_deregister_delay : 3000
+#grpc_server_advertise_addr : ''
+#并发限制: vegas(按延迟自适应) | fixed, 为空时不限制, 超过限制返回 RESOURCE_EXHAUSTED
+#优先级通过 metadata x-priority 传递: critical, high, normal, low
+#grpc_server_limiter : vegas
+#grpc_server_init_inflight : 20
+#grpc_server_max_inflight : 1000
+#grpc_server_method_limits:
+#- {method: '/pay.Pay/Query', limit: 100}
 
 #客户端
 grpc_client_kp_time : 60
@@ -24,6 +45,31 @@ grpc_client_kp_time_out : 5
 #链接超时 单位：ms
 grpc_client_conn_time_out : 300
 grpc_client_permit_without_stream: true
+#tls
+#grpc_client_tls_cert : 'conf/tls/client.pem'
+#grpc_client_tls_key : 'conf/tls/client.key'
+#grpc_client_tls_ca : 'conf/tls/ca.pem'
+#grpc_client_tls_server_name : ''
+#不使用 tls, 仅用于开发环境
+grpc_client_insecure : true
+#负载均衡: round_robin, least_request, consistent_hash, 使用服务发现时默认 round_robin
+#grpc_client_balancer : round_robin
+#调用下游时为上游保留的时间, 下游超时 = min(策略超时, 上游剩余时间 - 保留时间) 单位：ms
+#grpc_client_deadline_reserve : 50
+#调用策略, method 为空时作为默认策略, 以 / 结尾时匹配整个服务, 时间单位：ms
+#grpc_client_call_policies:
+#- {method: '', timeout: 3000}
+#- {method: '/pay.Pay/', timeout: 5000, maxattempts: 3, retrycodes: ['UNAVAILABLE'], backoff: 50, maxbackoff: 1000}
+#- {method: '/pay.Pay/Query', timeout: 1000, maxattempts: 2, hedgingdelay: 200}
+#连接池, name 为空时作为默认配置, healthinterval: 检查连接状态的间隔 单位：ms, 消息大小 单位：byte 默认 16MB
+#grpc_client_pools:
+#- {name: '', maxidle: 8, maxactive: 64, maxconcurrentstreams: 64, reuse: true, healthinterval: 5000}
+#- {name: 'report', maxidle: 2, maxactive: 16, maxsendmsgsize: 67108864, maxrecvmsgsize: 67108864}
+#地址变化或删除的连接池延迟关闭 单位：ms
+#grpc_client_pool_close_delay : 3000
+#并发限制, 与服务端相同
+#grpc_client_limiter : vegas
+#grpc_client_max_inflight : 1000
 
 jaeger_disabled: '${JAEGER_DISABLED}'
 jaeger_local_agent_host_port: '0.0.0.0:6831'
@@ -32,6 +78,12 @@ jaeger_local_agent_host_port: '0.0.0.0:6831'
 dbs:
 #- {db: 'test', dsn: 'root:123456@tcp(:3306)/config?charset=utf8&parseTime=True&loc=Local',
 #  maxidle: 10, maxopen: 100}
+#单元测试使用纯 Go 的 sqlite 内存库: driver: sqlite, dsn 为空时使用内存库
+#- {driver: 'sqlite', db: 'test'}
+#连接池自适应: 按等待次数在 [minopen, maxopenlimit] 内调整 maxopen, 连续 saturatedintervals 个统计周期饱和时告警
+#maxopenlimit 未配置或小于 maxopen 时以 maxopen 为上限, 只会收缩不会扩容
+#- {db: 'test_tune', dsn: 'root:123456@tcp(:3306)/config?charset=utf8&parseTime=True&loc=Local',
+#  maxidle: 10, maxopen: 50, autotune: true, minopen: 20, maxopenlimit: 200, saturatedintervals: 3}
 #- {db: 'test_slave', dsn: 'root:123456@tcp(:3306)/config?charset=utf8&parseTime=True&loc=Local',
 
 
@@ -85,94 +85,28 @@ func RegisterGinServer(en *gin.Engine, ctl *controllers.Controllers)  {
 		Content: `package http
 
 import (
-	"strings"
-	"net/http"
-	"context"
-	"time"
-
 	"github.com/gin-gonic/gin"
-	"code.jshyjdtech.com/godev/hykit/log"
-	middleware "code.jshyjdtech.com/godev/hykit/middle-ware"
+	hyhttp "code.jshyjdtech.com/godev/hykit/http"
 	{{.PackageName}} "{{.ProPath}}{{.ServerName}}/internal"
 	"{{.ProPath}}{{.ServerName}}/internal/transports/http/routers"
 	"{{.ProPath}}{{.ServerName}}/internal/transports/http/controllers"
 )
 
-type GinServer struct{
-	en *gin.Engine
-
-	addr string
-
-	logger log.Logger
-
-	server *http.Server
-
-	app *{{.PackageName}}.App
-}
-
-func NewGinServer(app *{{.PackageName}}.App) *GinServer {
-	httpport := app.Conf.GetString("httpport")
-
-	in := strings.Index(httpport, ":")
-	if in < 0 {
-		httpport = ":"+httpport
-	}
-
-	if app.Conf.GetBool("debug") {
-		gin.SetMode(gin.DebugMode)
-	} else {
-		gin.SetMode(gin.ReleaseMode)
-	}
-
-	en := gin.New()
-	en.Use(gin.Recovery())
-
-	if app.Conf.GetBool("http_trace") {
-		en.Use(middleware.GinTracer(app.Tracer))
-	}
-
-	en.Use(middleware.GinTracerID())
-
-	en.Use(gin.LoggerWithFormatter(middleware.GinLogFormatter))
-
-	en.Use(middleware.GinRecovery(app.Logger))
-
-	if app.Conf.GetBool("http_metrics") {
-		en.Use(middleware.GinMonitor())
-	}
-
-	server := &GinServer{
-		en : en,
-		addr : httpport,
-		logger: app.Logger,
-		app: app,
-	}
-
-	return server
-}
-
-
-func (gs *GinServer) Start(){
-	routers.RegisterGinServer(gs.en, controllers.NewControllers(gs.app))
-
-	server := &http.Server{Addr: gs.addr, Handler: gs.en}
-	gs.server = server
-	go func() {
-		if err := server.ListenAndServe(); err != nil{
-			if err != http.ErrServerClosed {
-				gs.logger.Fatalf("start http server err %s", err.Error())
-			}
-			return
-		}
-	}()
-}
-
-func (gs *GinServer) GracefulShutDown()  {
-	ctx, cannel := context.WithTimeout(context.Background(), 3 * time.Second)
-	defer cannel()
-	if err := gs.server.Shutdown(ctx); err != nil {
-		gs.logger.Errorf("stop http server error %s", err.Error())
-	}
+// NewGinServer 默认中间件、优雅关闭、/healthz 和 /readyz 由 hykit/http.GinServer 提供
+func NewGinServer(app *{{.PackageName}}.App) *hyhttp.GinServer {
+	serverOptions := hyhttp.GinServerOptions{}
+
+	return hyhttp.NewGinServer(
+		serverOptions.WithConf(app.Conf),
+		serverOptions.WithLogger(app.Logger),
+		serverOptions.WithTracer(app.Tracer),
+		serverOptions.WithMultiPinger("mysql", app.Infra.DB),
+		serverOptions.WithPinger("redis", app.Infra.Redis),
+		serverOptions.WithMultiPinger("mongodb", app.Infra.Mongo),
+		serverOptions.WithRouter(func(en *gin.Engine) {
+			routers.RegisterGinServer(en, controllers.NewControllers(app))
+		}),
+	)
 }
 `,
 	}
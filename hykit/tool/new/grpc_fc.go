@@ -86,6 +86,9 @@ func NewGrpcServer(app *{{.PackageName}}.App) *grpc.Server {
 		serverOptions.WithUnarySrvItcp(),
 		serverOptions.WithServerOption(),
 		serverOptions.WithTracer(app.Tracer),
+		serverOptions.WithMultiPinger("", "mysql", app.Infra.DB),
+		serverOptions.WithPinger("", "redis", app.Infra.Redis),
+		serverOptions.WithMultiPinger("", "mongodb", app.Infra.Mongo),
 	)
 
 	// 注册grpc路由
@@ -105,23 +108,23 @@ import (
 	"context"
 	"testing"
 
-	egrpc "code.jshyjdtech.com/godev/hykit/grpc"
 	"code.jshyjdtech.com/godev/hykit/log"
 	"github.com/stretchr/testify/assert"
 	gp "{{.ProPath}}{{.ServerName}}/internal/infra/third_party/protobuf/passport"
 )
 
 // go test
+// 使用 grpctest.AssertGolden(t, "get_user_by_user_name", req, reply, err) 比较 testdata 中的请求和响应,
+// go test -grpctest.update 更新
 func TestUserService_GetUserByUserName(t *testing.T) {
 	logger := log.NewLogger()
 
 	ctx := context.Background()
 
-	grpcClient := egrpc.NewClient(egrpc.NewClientOptions())
-	conn := grpcClient.DialContext(ctx, ":50055")
-	defer conn.Close()
+	conn, err := harness.Dial(ctx)
+	assert.Nil(t, err)
 
-	client := gp.NewUserInfoClient(conn)
+	client := gp.NewUserInfoClient(conn.Conn())
 
 	req := &gp.GetUserByUserNameRequest{}
 	req.Username = "demo"
@@ -257,16 +260,18 @@ func NewUserInfo(user entity.User) *passport.Info {
 import (
 	"os"
 	"testing"
-	"context"
 
-	"{{.ProPath}}{{.ServerName}}/internal/transports/grpc"
-	"{{.ProPath}}{{.ServerName}}/internal/infra"
+	"code.jshyjdtech.com/godev/hykit/grpc/grpctest"
 	ggrpc "google.golang.org/grpc"
-	egrpc "code.jshyjdtech.com/godev/hykit/grpc"
-	"code.jshyjdtech.com/godev/hykit/container"
 	{{.PackageName}} "{{.ProPath}}{{.ServerName}}/internal"
+	"{{.ProPath}}{{.ServerName}}/internal/infra"
+	"{{.ProPath}}{{.ServerName}}/internal/transports/grpc/controllers"
+	"{{.ProPath}}{{.ServerName}}/internal/transports/grpc/routers"
 )
 
+// harness 在 bufconn 上启动 grpc 服务, 不占用端口
+var harness *grpctest.Harness
+
 func TestMain(m *testing.M) {
 	appOptions := {{.PackageName}}.AppOptions{}
 	app := {{.PackageName}}.NewApp(appOptions.WithConfPath("../../../../conf/"))
@@ -280,33 +285,18 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
-func provideStubsGrpcClient(esim *container.Esim) *egrpc.Client {
-	clientOptional := egrpc.ClientOptionals{}
-	clientOptions := egrpc.NewClientOptions(
-		clientOptional.WithLogger(esim.Logger),
-		clientOptional.WithConf(esim.Conf),
-		clientOptional.WithDialOptions(ggrpc.WithUnaryInterceptor(
-			egrpc.ClientStubs(func(ctx context.Context, method string, req,
-			reply interface{}, cc *ggrpc.ClientConn, invoker ggrpc.UnaryInvoker,
-			opts ...ggrpc.CallOption) error {
-				esim.Logger.Infof(method)
-				err := invoker(ctx, method, req, reply, cc, opts...)
-				return err
-			}),
-		)),
-	)
-
-	grpcClient := egrpc.NewClient(clientOptions)
-
-	return grpcClient
-}
-
 func setUp(app *{{.PackageName}}.App) {
-	app.Infra = infra.NewStubsInfra(provideStubsGrpcClient(app.Esim))
+	harnessOpt := grpctest.HarnessOptions{}
+	harness = grpctest.NewHarness(
+		harnessOpt.WithConf(app.Conf),
+		harnessOpt.WithLogger(app.Logger),
+	)
 
-	app.RegisterTran(grpc.NewGrpcServer(app))
+	app.Infra = infra.NewStubsInfra(harness.Client)
 
-	app.Start()
+	harness.Start(func(s *ggrpc.Server) {
+		routers.RegisterGrpcServer(s, controllers.NewControllers(app))
+	})
 
 	errs := app.Infra.HealthCheck()
 	if len(errs) > 0 {
@@ -317,6 +307,7 @@ func setUp(app *{{.PackageName}}.App) {
 }
 
 func tearDown(app *{{.PackageName}}.App) {
+	harness.Close()
 	app.Infra.Close()
 }`,
 	}
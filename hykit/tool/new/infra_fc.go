@@ -12,6 +12,8 @@ import (
 	"github.com/google/wire"
 	"code.jshyjdtech.com/godev/hykit/container"
 	"code.jshyjdtech.com/godev/hykit/mysql"
+	"code.jshyjdtech.com/godev/hykit/redis"
+	"code.jshyjdtech.com/godev/hykit/mongodb"
 	"code.jshyjdtech.com/godev/hykit/grpc"
 	"code.jshyjdtech.com/godev/hykit/pkg/uid"
 	"code.jshyjdtech.com/godev/hykit/pkg/validate"
@@ -34,6 +36,10 @@ type Infra struct {
 
 	DB *mysql.Client
 
+	Redis *redis.Client
+
+	Mongo *mongodb.Client
+
 	GrpcClient *grpc.Client
 
 	Validate validate.ValidateRepo
@@ -47,6 +53,8 @@ type Infra struct {
 var infraSet = wire.NewSet(
 	wire.Struct(new(Infra), "*"),
 	provideDb,
+	provideRedis,
+	provideMongo,
 	provideValidate,
 	provideUid,
 	provideUserRepo,
@@ -74,6 +82,8 @@ func NewStubsInfra(grpcClient *grpc.Client) *Infra {
 // Close close the infra when app stop
 func (infraer *Infra) Close()  {
 	infraer.DB.Close()
+	infraer.Redis.Close()
+	infraer.Mongo.Close()
 }
 
 func (infraer *Infra) HealthCheck() []error {
@@ -84,6 +94,15 @@ func (infraer *Infra) HealthCheck() []error {
 		errs = append(errs, dbErrs...)
 	}
 
+	if err := infraer.Redis.Ping(); err != nil {
+		errs = append(errs, err)
+	}
+
+	mgoErrs := infraer.Mongo.Ping()
+	if mgoErrs != nil{
+		errs = append(errs, mgoErrs...)
+	}
+
 	return errs
 }
 
@@ -104,6 +123,26 @@ func provideDb(esim *container.Esim) *mysql.Client {
 	return mysqlClent
 }
 
+func provideRedis(esim *container.Esim) *redis.Client {
+	clientOptions := redis.ClientOptions{}
+	redisClient := redis.NewClient(
+		clientOptions.WithConf(esim.Conf),
+		clientOptions.WithLogger(esim.Logger),
+	)
+
+	return redisClient
+}
+
+// provideMongo 未配置 mgos 时不建立连接
+func provideMongo(esim *container.Esim) *mongodb.Client {
+	clientOptions := mongodb.ClientOptions{}
+	mongoClient := mongodb.NewClient(
+		clientOptions.WithConf(esim.Conf),
+		clientOptions.WithLogger(esim.Logger),
+	)
+
+	return mongoClient
+}
 
 func provideUserRepo(esim *container.Esim) repo.UserRepo {
 	return repo.NewDBUserRepo(esim.Logger)
@@ -168,10 +207,14 @@ import (
 // Injectors from wire.go:
 func initInfra(esim *container.Esim, grpc2 *grpc.Client) *Infra {
 	mysqlClient := provideDb(esim)
+	redisClient := provideRedis(esim)
+	mongoClient := provideMongo(esim)
 	userRepo := provideUserRepo(esim)
 	infra := &Infra{
 		Esim:     esim,
 		DB:       mysqlClient,
+		Redis:    redisClient,
+		Mongo:    mongoClient,
 		GrpcClient: grpc2,
 		UserRepo: userRepo,
 	}
@@ -0,0 +1,111 @@
+package protoc
+
+import (
+	"bufio"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	filedir "code.jshyjdtech.com/godev/hykit/pkg/file-dir"
+)
+
+var gatewayTemplate = `// Code generated by esim protoc --gateway. DO NOT EDIT.
+// source: {{.Source}}
+
+package {{.GoPackage}}
+
+import (
+	"code.jshyjdtech.com/godev/hykit/grpc/gateway"
+	"github.com/gin-gonic/gin"
+)
+{{range .Services}}
+// Register{{.}}Gateway 把 {{.}} 注册到 gin, 按 google.api.http 注解或 POST /package.Service/Method 映射.
+func Register{{.}}Gateway(gw *gateway.Gateway, router gin.IRouter, srv {{.}}Server) error {
+	return gw.Register(router, &{{.}}_ServiceDesc, srv)
+}
+{{end}}`
+
+type gatewayFile struct {
+	Source string
+
+	GoPackage string
+
+	Services []string
+}
+
+var (
+	serviceReg   = regexp.MustCompile(`^\s*service\s+(\w+)`)
+	goPackageReg = regexp.MustCompile(`^\s*option\s+go_package\s*=\s*"([^"]+)"`)
+)
+
+// genGateway 为 proto 中的 service 生成 Register{Service}Gateway, 与 *_grpc.pb.go 放在同一目录.
+func (p *Protocer) genGateway() bool {
+	gf, err := p.parseGateway(p.fromProto)
+	if err != nil {
+		p.logger.Fatalf(err.Error())
+	}
+
+	if len(gf.Services) == 0 {
+		p.logger.Warnf("not found service in %s", p.fromProto)
+		return false
+	}
+
+	content, err := p.gatewayContent(gf)
+	if err != nil {
+		p.logger.Fatalf(err.Error())
+	}
+
+	name := strings.TrimSuffix(filepath.Base(p.fromProto), ".proto") + "_gateway.go"
+	file := p.target + string(filepath.Separator) + p.packageName + string(filepath.Separator) + name
+	if err = filedir.EsimWrite(file, string(content)); err != nil {
+		p.logger.Fatalf(err.Error())
+	}
+	p.logger.Infof("gateway:%s;", file)
+
+	return true
+}
+
+// parseGateway 解析 service 和 go_package, 没有 go_package 时使用包名.
+func (p *Protocer) parseGateway(protoFile string) (*gatewayFile, error) {
+	f, err := os.Open(protoFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gf := &gatewayFile{Source: filepath.Base(protoFile), GoPackage: p.packageName}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strs := serviceReg.FindStringSubmatch(line); len(strs) > 1 {
+			gf.Services = append(gf.Services, strs[1])
+			continue
+		}
+
+		// e.g. "github.com/example/pb;pb"
+		if strs := goPackageReg.FindStringSubmatch(line); len(strs) > 1 {
+			goPackage := strs[1]
+			if idx := strings.LastIndex(goPackage, ";"); idx >= 0 {
+				goPackage = goPackage[idx+1:]
+			} else {
+				goPackage = filepath.Base(goPackage)
+			}
+			gf.GoPackage = strings.ReplaceAll(goPackage, "-", "_")
+		}
+	}
+
+	return gf, scanner.Err()
+}
+
+func (p *Protocer) gatewayContent(gf *gatewayFile) ([]byte, error) {
+	content, err := p.tpl.Execute("gateway", gatewayTemplate, gf)
+	if err != nil {
+		return nil, err
+	}
+
+	return format.Source([]byte(content))
+}
@@ -0,0 +1,60 @@
+package protoc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.jshyjdtech.com/godev/hykit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+const libraryProto = `syntax = "proto3";
+
+package library;
+
+option go_package = "code.jshyjdtech.com/godev/library/pb;librarypb";
+
+import "google/api/annotations.proto";
+
+service Library {
+  rpc GetBook (Book) returns (Book) {
+    option (google.api.http) = {get: "/v1/books/{name}"};
+  }
+}
+
+service Admin {
+  rpc Ping (Book) returns (Book) {}
+}
+
+message Book {
+  string name = 1;
+}
+`
+
+func TestProtoc_GenGateway(t *testing.T) {
+	dir := t.TempDir()
+	protoFile := filepath.Join(dir, "library.proto")
+	assert.Nil(t, os.WriteFile(protoFile, []byte(libraryProto), 0600))
+
+	protocer := NewProtocer(
+		WithProtocLogger(log.NewLogger()),
+	)
+	protocer.target = dir
+	protocer.fromProto = protoFile
+	protocer.packageName = "library"
+
+	gf, err := protocer.parseGateway(protoFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "librarypb", gf.GoPackage)
+	assert.Equal(t, []string{"Library", "Admin"}, gf.Services)
+
+	assert.True(t, protocer.genGateway())
+
+	content, err := os.ReadFile(filepath.Join(dir, "library", "library_gateway.go"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "package librarypb")
+	assert.Contains(t, string(content),
+		"func RegisterLibraryGateway(gw *gateway.Gateway, router gin.IRouter, srv LibraryServer) error {")
+	assert.Contains(t, string(content), "return gw.Register(router, &Admin_ServiceDesc, srv)")
+}
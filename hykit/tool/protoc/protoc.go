@@ -12,6 +12,7 @@ import (
 
 	"code.jshyjdtech.com/godev/hykit/log"
 	filedir "code.jshyjdtech.com/godev/hykit/pkg/file-dir"
+	"code.jshyjdtech.com/godev/hykit/pkg/templates"
 	"github.com/spf13/viper"
 )
 
@@ -28,6 +29,11 @@ type Protocer struct {
 
 	packageName string
 
+	// 生成 gateway 注册代码
+	gateway bool
+
+	tpl templates.Tpl
+
 	logger log.Logger
 }
 
@@ -40,6 +46,10 @@ func NewProtocer(options ...Option) *Protocer {
 		option(p)
 	}
 
+	if p.tpl == nil {
+		p.tpl = templates.NewTextTpl()
+	}
+
 	return p
 }
 
@@ -49,6 +59,12 @@ func WithProtocLogger(logger log.Logger) Option {
 	}
 }
 
+func WithProtocTpl(tpl templates.Tpl) Option {
+	return func(p *Protocer) {
+		p.tpl = tpl
+	}
+}
+
 func (p *Protocer) Run(v *viper.Viper) bool {
 	p.bindInput(v)
 
@@ -58,6 +74,10 @@ func (p *Protocer) Run(v *viper.Viper) bool {
 
 	p.execCmd()
 
+	if p.gateway {
+		p.genGateway()
+	}
+
 	return true
 }
 
@@ -93,6 +113,8 @@ func (p *Protocer) bindInput(v *viper.Viper) bool {
 	}
 	p.packageName = pkgName
 
+	p.gateway = v.GetBool("gateway")
+
 	err = filedir.CreateDir(target + string(filepath.Separator) + pkgName)
 	if err != nil {
 		p.logger.Fatalf("Create fail % : %s", target+string(filepath.Separator)+pkgName, err.Error())
@@ -1,8 +1,8 @@
+
 package example
 
 // example.
 func example() bool {
 	return true
 }
-
-// 1594862793017252000
+// 1792418324634959520
\ No newline at end of file
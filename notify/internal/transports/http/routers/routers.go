@@ -2,22 +2,32 @@ package routers
 
 import (
 	"notify/internal/transports/http/controllers"
-	"notify/internal/transports/http/middlewares"
 
+	"code.jshyjdtech.com/godev/hykit/idempotent"
+	middleware "code.jshyjdtech.com/godev/hykit/middle-ware"
 	"github.com/gin-gonic/gin"
 )
 
 func RegisterGinServer(en *gin.Engine, ctl *controllers.Controllers) {
 
-	en.Use(gin.Recovery(), middlewares.ReporterParams(ctl.App.Logger))
+	// 银联通知带有卡号、签名和证书, 默认脱敏字段不覆盖
+	en.Use(gin.Recovery(), middleware.GinBodyLog(middleware.WithBodyLogLogger(ctl.App.Logger),
+		middleware.WithBodyLogMaskFields("password", "token", "secret", "cvv", "card_no", "id_card",
+			"accNo", "signature", "signPubKeyCert", "encryptCertId", "customerInfo", "phoneNo")))
+
+	// 银联会重复推送异步通知, 按 orderId + txnType 去重, 处理失败(502)时允许重推
+	unionIdempotent := idempotent.Gin(idempotent.NewRedisStore(ctl.App.Infra.RedisClient),
+		idempotent.WithLogger(ctl.App.Logger),
+		idempotent.WithFields("orderId", "txnType"),
+		idempotent.WithPrefix("notify:idempotent:"))
 
 	en.GET("/ping", ctl.Ping.Ping)
 	en.POST("/ping", ctl.Ping.Ping)
 
-	en.POST("/notify", ctl.Call.Notify)                                    // 异步通知, 响应200
-	en.POST("/notify/success", ctl.Call.NotifyWithSUCCESS)                 // 异步通知, 响应200, SUCCESS
-	en.POST("/notify/ok", ctl.Call.NotifyWithOK)                           // 异步通知, 响应200, ok
-	en.POST("/notify/502", ctl.Call.NotifyWith502)                         // 异步通知, 响应502
-	en.POST("/notify/UnionJSCallback", ctl.Call.UnionJSCallback)           // 解析江苏银联异步通知, 响应200, SUCCESS
-	en.POST("/notify/UnionJSCallback502", ctl.Call.UnionJSCallbackWith502) // 解析江苏银联异步通知, 响应502
+	en.POST("/notify", ctl.Call.Notify)                                                     // 异步通知, 响应200
+	en.POST("/notify/success", ctl.Call.NotifyWithSUCCESS)                                  // 异步通知, 响应200, SUCCESS
+	en.POST("/notify/ok", ctl.Call.NotifyWithOK)                                            // 异步通知, 响应200, ok
+	en.POST("/notify/502", ctl.Call.NotifyWith502)                                          // 异步通知, 响应502
+	en.POST("/notify/UnionJSCallback", unionIdempotent, ctl.Call.UnionJSCallback)           // 解析江苏银联异步通知, 响应200, SUCCESS
+	en.POST("/notify/UnionJSCallback502", unionIdempotent, ctl.Call.UnionJSCallbackWith502) // 解析江苏银联异步通知, 响应502
 }